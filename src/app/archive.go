@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/sketch-home-task/src/pkg/archive"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+func (a *App) exportCanvases(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+	resp.SetHeader("Content-Disposition",
+		`attachment; filename="canvases-`+time.Now().UTC().Format("20060102T150405Z")+`.ndjson"`)
+	resp.SetStream(func(w io.Writer) (err error) {
+		summary, err := archive.Export(req.Context, a.storage, w)
+		logExportSkipped(&summary)
+		return
+	}, archive.ContentType, http.StatusOK)
+	return
+}
+
+func (a *App) importCanvases(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	summary, err := archive.Import(req.Context, a.storage, req.Body.(io.Reader), a.checkCanvas)
+	if err != nil {
+		if errors.Is(err, archive.ErrInvalidArchive) {
+			resp.SetText(err.Error(), http.StatusBadRequest)
+		} else {
+			setStorageErrorResponse(resp, "failed to import canvases", err)
+		}
+		return
+	}
+
+	resp.SetJSON(&summary, http.StatusOK)
+	return
+}
+
+// exportArchive writes the canvases of the storage to the file, "-" for stdout
+func exportArchive(storage illustrator.CanvasStorage, path string) (err error) {
+	out := os.Stdout
+	if path != "-" {
+		if out, err = os.Create(path); err != nil {
+			return
+		}
+		defer func() {
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	summary, err := archive.Export(context.Background(), storage, out)
+	logExportSkipped(&summary)
+	if err != nil {
+		return
+	}
+
+	log.Printf("[INFO] exported %d canvases\n", summary.Exported)
+	return
+}
+
+// logExportSkipped reports the canvases left out of an export
+func logExportSkipped(summary *archive.ExportSummary) {
+	for _, key := range summary.Skipped {
+		log.Printf("[ERROR] canvas '%s' left out of export, not found by its key or its name is not backfilled\n", key)
+	}
+}
+
+// importArchive stores the canvases of the file, "-" for stdin
+func importArchive(storage illustrator.CanvasStorage, path string) (err error) {
+	in := os.Stdin
+	if path != "-" {
+		if in, err = os.Open(path); err != nil {
+			return
+		}
+		defer in.Close()
+	}
+
+	validator := validator.New()
+	illustrator.RegisterValidation(validator)
+
+	summary, err := archive.Import(context.Background(), storage, in, func(canvas *illustrator.CanvasModel) error {
+		return validator.Struct(canvas)
+	})
+	if err != nil {
+		return
+	}
+
+	log.Printf("[INFO] imported %d canvases, skipped %d existing ones\n", summary.Imported, len(summary.Skipped))
+	for _, failure := range summary.Failed {
+		log.Printf("[ERROR] line %d, canvas '%s': %s\n", failure.Line, failure.Name, failure.Error)
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+const (
+	// Name of the actor of a request, there is no authentication
+	actorHeader string = "X-Actor"
+	// ID of a request, generated unless given by the client
+	requestIDHeader string = "X-Request-ID"
+	// Actor of requests without actor header
+	anonymousActor string = "anonymous"
+)
+
+// withActor runs the request with its actor and ID in the context, which the
+// storage records in the audit log of the canvases changed by the request.
+// The request ID is sent back in the response header.
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID := illustrator.CleanActorValue(req.Header.Get(requestIDHeader))
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		actor := illustrator.CleanActorValue(req.Header.Get(actorHeader))
+		if actor == "" {
+			actor = anonymousActor
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		ctx := illustrator.ContextWithActor(req.Context(), illustrator.Actor{Name: actor, RequestID: requestID})
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+func newRequestID() (id string) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (a *App) listCanvasAudit(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := a.storage.ListAudit(req.Context, name)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to list canvas audit log", err)
+		return
+	}
+
+	resp.SetJSON(&struct {
+		Entries []illustrator.AuditEntry `json:"entries"`
+	}{entries}, http.StatusOK)
+	return
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+func (a *App) batchCanvases(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+	batch := req.Body.(*illustrator.BatchRequest)
+
+	results, err := a.storage.Batch(req.Context, batch.Operations, batch.Atomic)
+	if err != nil && !errors.Is(err, illustrator.ErrBatchAborted) {
+		setInternalErrorResponse(resp, "failed to run batch", err)
+		return
+	}
+
+	for i := range results {
+		setBatchResultError(&results[i])
+		if results[i].Status == illustrator.BatchStatusOK {
+			a.publishCanvas(req.Context, results[i].Name)
+		}
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusBadRequest
+	}
+	resp.SetJSON(&struct {
+		Atomic  bool                      `json:"atomic"`
+		Results []illustrator.BatchResult `json:"results"`
+	}{batch.Atomic, results}, status)
+	return
+}
+
+// setBatchResultError describes the outcome of an operation the same way as
+// the single canvas end points do
+func setBatchResultError(result *illustrator.BatchResult) {
+	switch {
+	case result.Status == illustrator.BatchStatusNotFound:
+		result.Error = "canvas not found"
+	case result.Err == nil:
+	case errors.Is(result.Err, illustrator.ErrCanvasExists):
+		result.Error = "canvas name already exists"
+	case errors.Is(result.Err, illustrator.ErrConflict):
+		result.Error = "canvas was modified, revision does not match"
+	default:
+		result.Error = "failed to " + string(result.Op) + " canvas"
+		log.Printf("[ERROR] batch operation %d: %v: %v\n", result.Index, result.Error, result.Err)
+	}
+}
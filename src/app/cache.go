@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/cache"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+const (
+	// Max. number of cached canvases, zero disables the cache
+	defaultCacheSize int = 1000
+	// Time a canvas stays cached
+	defaultCacheTTL time.Duration = time.Minute
+)
+
+// newCache puts a cache in front of the storage unless disabled by CACHE_SIZE
+func newCache(storage illustrator.CanvasStorage) (canvasCache *cache.Storage, err error) {
+	size, err := getIntEnv("CACHE_SIZE", defaultCacheSize)
+	if err != nil || size <= 0 {
+		return
+	}
+	ttl, err := getDurationEnv("CACHE_TTL", defaultCacheTTL)
+	if err != nil {
+		return
+	}
+	rendered, err := getBoolEnv("CACHE_RENDERED", true)
+	if err != nil {
+		return
+	}
+
+	return cache.NewStorage(storage, cache.Options{Size: size, TTL: ttl, Rendered: rendered}), nil
+}
+
+// findRenderedCanvas returns the canvas together with its rendered output,
+// taken from the cache when enabled
+func (a *App) findRenderedCanvas(ctx context.Context, name string) (canvas *illustrator.CanvasModel, output string,
+	err error) {
+	if a.cache != nil {
+		return a.cache.FindRendered(ctx, name, renderCanvas)
+	}
+
+	canvas, err = a.storage.FindByName(ctx, name)
+	if err == nil {
+		output = renderCanvas(canvas)
+	}
+	return
+}
+
+func (a *App) getCacheStats(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+	stats := a.cache.Stats()
+	resp.SetJSON(&stats, http.StatusOK)
+	return
+}
+
+func getIntEnv(key string, fallback int) (value int, err error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return fallback, nil
+	}
+
+	value, err = strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("environment variable %s must be a number: %w", key, err)
+	}
+	return
+}
+
+func getBoolEnv(key string, fallback bool) (value bool, err error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return fallback, nil
+	}
+
+	value, err = strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("environment variable %s must be a boolean: %w", key, err)
+	}
+	return
+}
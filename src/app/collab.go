@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+// collabCanvas connects a client to the editing session of a canvas over a
+// WebSocket, resuming after the revision of the query parameter if given
+func (a *App) collabCanvas(w http.ResponseWriter, req *http.Request) {
+	name := router.Vars(req)["name"]
+
+	var revision int
+	if str := req.URL.Query().Get("revision"); str != "" {
+		var err error
+		if revision, err = strconv.Atoi(str); err != nil || revision < 0 {
+			http.Error(w, "query parameter 'revision' must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	a.collab.ServeWebSocket(w, req, name, revision)
+}
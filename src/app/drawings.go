@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+func (a *App) appendDrawing(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, revision, ok := getDrawingRequest(req, resp, false)
+	if !ok {
+		return
+	}
+
+	canvas, err := a.storage.AppendDrawing(req.Context, name, revision, getDrawingFromRequest(req), a.checkCanvas)
+	setDrawingResponse(resp, canvas, err, "append OK", http.StatusCreated)
+	if err == nil {
+		a.publishCanvas(req.Context, name)
+	}
+	return
+}
+
+func (a *App) replaceDrawing(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, revision, ok := getDrawingRequest(req, resp, true)
+	if !ok {
+		return
+	}
+	index, _ := strconv.Atoi(req.Vars["index"])
+
+	canvas, err := a.storage.ReplaceDrawing(req.Context, name, revision, index, getDrawingFromRequest(req), a.checkCanvas)
+	setDrawingResponse(resp, canvas, err, "replace OK", http.StatusOK)
+	if err == nil {
+		a.publishCanvas(req.Context, name)
+	}
+	return
+}
+
+func (a *App) removeDrawing(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, revision, ok := getDrawingRequest(req, resp, true)
+	if !ok {
+		return
+	}
+	index, _ := strconv.Atoi(req.Vars["index"])
+
+	canvas, err := a.storage.RemoveDrawing(req.Context, name, revision, index, a.checkCanvas)
+	setDrawingResponse(resp, canvas, err, "remove OK", http.StatusOK)
+	if err == nil {
+		a.publishCanvas(req.Context, name)
+	}
+	return
+}
+
+// checkCanvas revalidates a canvas after one of its drawings changed
+func (a *App) checkCanvas(canvas *illustrator.CanvasModel) (err error) {
+	return a.validator.Struct(canvas)
+}
+
+// getDrawingRequest returns the canvas name and the If-Match revision of a
+// drawing request, the drawing index route variable is checked if required
+func getDrawingRequest(req *router.HandlerRequest, resp *router.HandlerResponse, withIndex bool) (name string, revision int, ok bool) {
+	if name, ok = req.Vars["name"]; !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	if withIndex {
+		if _, err := strconv.Atoi(req.Vars["index"]); err != nil {
+			resp.SetText("route variable 'index' must be a number", http.StatusBadRequest)
+			return name, 0, false
+		}
+	}
+
+	revision, err := getIfMatchRevision(req)
+	if err != nil {
+		resp.SetText(err.Error(), http.StatusBadRequest)
+		return name, 0, false
+	}
+	return
+}
+
+func getDrawingFromRequest(req *router.HandlerRequest) (drawing *illustrator.DrawingModel) {
+	return req.Body.(*illustrator.DrawingModel)
+}
+
+// setDrawingResponse maps the outcome of a drawing operation, the new canvas
+// revision is returned as ETag
+func setDrawingResponse(resp *router.HandlerResponse, canvas *illustrator.CanvasModel, err error, msg string, status int) {
+	var validationErr validator.ValidationErrors
+	switch {
+	case err == nil:
+		resp.SetText(msg, status)
+		resp.SetHeader("ETag", formatETag(canvas.Revision))
+	case errors.As(err, &validationErr):
+		resp.SetText(err.Error(), http.StatusBadRequest)
+	default:
+		setStorageErrorResponse(resp, "failed to modify canvas drawings", err)
+	}
+}
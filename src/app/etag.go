@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+// Canvas entity tags are the quoted canvas revision
+func formatETag(revision int) (etag string) {
+	return fmt.Sprintf(`"%d"`, revision)
+}
+
+// getIfMatchRevision returns the revision the If-Match request header refers to,
+// zero when the header is missing or matches any revision
+func getIfMatchRevision(req *router.HandlerRequest) (revision int, err error) {
+	ifMatch := strings.TrimSpace(req.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return
+	}
+
+	unquoted, err := strconv.Unquote(ifMatch)
+	if err == nil {
+		revision, err = strconv.Atoi(unquoted)
+	}
+	if err != nil || revision <= 0 {
+		return 0, errors.New("If-Match header must be a single canvas ETag")
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/hub"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+// Time between comments sent on idle event streams, keeping proxies from
+// closing the connection
+const eventsKeepAlive time.Duration = 30 * time.Second
+
+// streamCanvasEvents streams the changes of a canvas as Server-Sent Events,
+// starting with its current state. The stream ends when the canvas is deleted.
+func (a *App) streamCanvasEvents(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	// Subscribed before reading the canvas, so no change goes unseen
+	sub := a.hub.Subscribe(name)
+	canvas, output, err := a.findRenderedCanvas(req.Context, name)
+	if err != nil {
+		sub.Close()
+		setStorageErrorResponse(resp, "failed to retrieve canvas", err)
+		return
+	}
+	current := hub.Event{Type: hub.EventUpdate, Revision: canvas.Revision, Canvas: output}
+
+	resp.SetHeader("Cache-Control", "no-cache")
+	// Keeps reverse proxies from buffering the stream
+	resp.SetHeader("X-Accel-Buffering", "no")
+	resp.SetStream(func(w io.Writer) (err error) {
+		defer sub.Close()
+		return streamEvents(req.Context, w, sub, current)
+	}, "text/event-stream", http.StatusOK)
+	return
+}
+
+// streamEvents writes the first event followed by the events of the
+// subscription until the context is done or the canvas is gone. Updates of
+// revisions sent already are skipped.
+func streamEvents(ctx context.Context, w io.Writer, sub *hub.Subscription, first hub.Event) (err error) {
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	revision := first.Revision
+	if err = writeEvent(w, first); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err = io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flush(w)
+		case event := <-sub.C:
+			if event.Type == hub.EventUpdate && event.Revision <= revision {
+				continue
+			}
+			if err = writeEvent(w, event); err != nil {
+				return
+			}
+			if event.Type != hub.EventUpdate {
+				return nil
+			}
+			revision = event.Revision
+		}
+	}
+}
+
+// writeEvent writes the event in the Server-Sent Events format, updates carry
+// their revision as event ID
+func writeEvent(w io.Writer, event hub.Event) (err error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if event.Type == hub.EventUpdate {
+		if _, err = fmt.Fprintf(w, "id: %d\n", event.Revision); err != nil {
+			return
+		}
+	}
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return
+	}
+	flush(w)
+	return
+}
+
+func flush(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// publishCanvas tells the viewers of the canvas about a change. The canvas is
+// read back, so they get the latest revision even if changes race.
+func (a *App) publishCanvas(ctx context.Context, name string) {
+	if !a.hub.Subscribed(name) {
+		return
+	}
+
+	canvas, output, err := a.findRenderedCanvas(ctx, name)
+	switch {
+	case err == nil:
+		a.hub.Publish(name, hub.Event{Type: hub.EventUpdate, Revision: canvas.Revision, Canvas: output})
+	case errors.Is(err, illustrator.ErrCanvasNotFound):
+		a.hub.Publish(name, hub.Event{Type: hub.EventDelete})
+	default:
+		log.Printf("[ERROR] failed to publish canvas '%s': %v\n", name, err)
+	}
+}
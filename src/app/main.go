@@ -1,60 +1,183 @@
 package main
 
 import (
-	"crypto/sha1"
-	"database/sql"
-	"encoding/hex"
+	"bufio"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator"
 	_ "github.com/lib/pq"
-	"github.com/sketch-home-task/src/pkg/dba"
+	"github.com/sketch-home-task/src/pkg/cache"
+	"github.com/sketch-home-task/src/pkg/collab"
+	"github.com/sketch-home-task/src/pkg/hub"
 	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/memstore"
 	"github.com/sketch-home-task/src/pkg/router"
 )
 
+// Time limit of storage operations
+const defaultQueryTimeout time.Duration = 10 * time.Second
+
 type App struct {
-	router  *router.Router
-	storage illustrator.CanvasStorage
+	router    *router.Router
+	storage   illustrator.CanvasStorage
+	validator *validator.Validate
+	// Cache in front of the storage, nil when disabled
+	cache *cache.Storage
+	// Connection pool of the storage, nil unless the storage keeps one
+	pool illustrator.PoolStatsReporter
+	// Webhooks of the storage, nil unless the storage keeps change events
+	webhooks illustrator.WebhookStore
+	// Passes the changes made by the handlers to the viewers of the canvases
+	hub *hub.Hub
+	// Editing sessions of the canvases
+	collab *collab.Manager
 }
 
 func main() {
 	serverPort := os.Getenv("SERVER_PORT")
 	templatesDir := os.Getenv("TEMPLATES_DIRECTORY")
-	postgresHost := os.Getenv("POSTGRES_HOST")
-	postgresPort := os.Getenv("POSTGRES_PORT")
-	postgresUser := os.Getenv("POSTGRES_USER")
-	postgresPassword := os.Getenv("POSTGRES_PASSWORD")
-	postgresDatabase := os.Getenv("POSTGRES_DATABASE")
+	storageDriver := os.Getenv("STORAGE_DRIVER")
 
-	dns := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		postgresHost, postgresPort, postgresUser, postgresPassword, postgresDatabase)
+	backfillNamesFile := flag.String("backfill-names", "",
+		"file with one canvas name per line to restore the names of canvases stored as hashes, then exit")
+	exportFile := flag.String("export", "",
+		"file to write an archive of all canvases to, - for stdout, then exit")
+	importFile := flag.String("import", "",
+		"archive file to read canvases from, - for stdin, then exit")
+	flag.Parse()
 
-	storage, err := dba.NewStorage("postgres", dns, 1, 1)
+	storage, err := newStorage(storageDriver)
 	if err != nil {
 		panic(err)
 	}
+	defer storage.Close()
+
+	if *backfillNamesFile != "" {
+		if err := backfillNames(storage, *backfillNamesFile); err != nil {
+			log.Fatalf("[ERROR] failed to backfill canvas names: %v\n", err)
+		}
+		return
+	}
+	if *exportFile != "" {
+		if err := exportArchive(storage, *exportFile); err != nil {
+			log.Fatalf("[ERROR] failed to export canvases: %v\n", err)
+		}
+		return
+	}
+	if *importFile != "" {
+		if err := importArchive(storage, *importFile); err != nil {
+			log.Fatalf("[ERROR] failed to import canvases: %v\n", err)
+		}
+		return
+	}
+
+	trashRetention, err := getDurationEnv("TRASH_RETENTION", defaultTrashRetention)
+	if err != nil {
+		panic(err)
+	}
+	trashPurgeInterval, err := getDurationEnv("TRASH_PURGE_INTERVAL", defaultTrashPurgeInterval)
+	if err != nil {
+		panic(err)
+	}
+	pool, _ := storage.(illustrator.PoolStatsReporter)
+	var webhooks illustrator.WebhookStore
+	if eventOutbox, ok := storage.(illustrator.EventOutbox); ok {
+		// Webhooks are notified by the change events
+		webhooks, _ = storage.(illustrator.WebhookStore)
+		dispatcher, err := newDispatcher(eventOutbox, webhooks)
+		if err != nil {
+			panic(err)
+		}
+		go dispatcher.Run(context.Background())
+	}
+	canvasCache, err := newCache(storage)
+	if err != nil {
+		panic(err)
+	}
+	if canvasCache != nil {
+		storage = canvasCache
+	}
+
+	// A retention of zero keeps trashed canvases until purged explicitly
+	if trashRetention > 0 && trashPurgeInterval > 0 {
+		go purgeTrash(context.Background(), storage, trashRetention, trashPurgeInterval)
+	}
 
 	validator := validator.New()
 	illustrator.RegisterValidation(validator)
 	router := router.NewRouter(validator, templatesDir)
+	router.Use(withActor)
 
 	app := App{
-		router:  router,
-		storage: storage,
+		router:    router,
+		storage:   storage,
+		validator: validator,
+		cache:     canvasCache,
+		pool:      pool,
+		webhooks:  webhooks,
+		hub:       hub.NewHub(),
 	}
+	app.collab = collab.NewManager(storage, app.hub, validator, app.publishCanvas)
 
 	// Register canvas API end points
 	app.router.POST("/canvas", &illustrator.CanvasModel{}, app.createCanvas)
 	app.router.PUT("/canvas", &illustrator.CanvasModel{}, app.updateCanvas)
+	app.router.POST("/canvas/batch", &illustrator.BatchRequest{}, app.batchCanvases)
+	app.router.GET("/canvas", app.listCanvases)
 	app.router.GET("/canvas/{name:[a-z]{1,25}}", app.getCanvas)
+	app.router.PATCH("/canvas/{name:[a-z]{1,25}}", app.patchCanvas)
 	app.router.DELETE("/canvas/{name:[a-z]{1,25}}", app.deleteCanvas)
+	app.router.GET("/canvas/{name:[a-z]{1,25}}/events", app.streamCanvasEvents)
+	app.router.GETRaw("/canvas/{name:[a-z]{1,25}}/ws", app.collabCanvas)
+	app.router.POST("/canvas/{name:[a-z]{1,25}}/clone", &illustrator.CloneRequest{}, app.cloneCanvas)
+	app.router.POST("/canvas/{name:[a-z]{1,25}}/rename", &illustrator.RenameRequest{}, app.renameCanvas)
+
+	// Register drawing API end points
+	app.router.POST("/canvas/{name:[a-z]{1,25}}/drawings", &illustrator.DrawingModel{}, app.appendDrawing)
+	app.router.PUT("/canvas/{name:[a-z]{1,25}}/drawings/{index:[0-9]{1,9}}", &illustrator.DrawingModel{}, app.replaceDrawing)
+	app.router.DELETE("/canvas/{name:[a-z]{1,25}}/drawings/{index:[0-9]{1,9}}", app.removeDrawing)
+
+	// Register trash API end points
+	app.router.GET("/trash", app.listTrash)
+	app.router.POST("/trash/{name:[a-z]{1,25}}/restore", nil, app.undeleteCanvas)
+	app.router.DELETE("/trash/{name:[a-z]{1,25}}", app.purgeCanvas)
+
+	// Register archive API end points
+	app.router.GET("/export", app.exportCanvases)
+	app.router.POSTStream("/import", app.importCanvases)
+
+	if app.cache != nil {
+		app.router.GET("/cache/stats", app.getCacheStats)
+	}
+	if app.pool != nil {
+		app.router.GET("/pool/stats", app.getPoolStats)
+	}
+
+	// Register canvas version history API end points
+	app.router.GET("/canvas/{name:[a-z]{1,25}}/versions", app.listCanvasVersions)
+	app.router.GET("/canvas/{name:[a-z]{1,25}}/versions/{version:[0-9]{1,9}}", app.getCanvasVersion)
+	app.router.POST("/canvas/{name:[a-z]{1,25}}/versions/{version:[0-9]{1,9}}/restore", nil, app.restoreCanvasVersion)
+
+	// Register audit log API end points
+	app.router.GET("/canvas/{name:[a-z]{1,25}}/audit", app.listCanvasAudit)
+
+	// Register webhook API end points
+	if app.webhooks != nil {
+		app.router.POST("/webhooks", &illustrator.Webhook{}, app.createWebhook)
+		app.router.GET("/webhooks", app.listWebhooks)
+		app.router.DELETE("/webhooks/{id:[0-9]{1,18}}", app.deleteWebhook)
+		app.router.GET("/webhooks/{id:[0-9]{1,18}}/deliveries", app.listWebhookDeliveries)
+	}
 
 	addr := fmt.Sprintf(":%s", serverPort)
 	srv := http.Server{
@@ -67,17 +190,61 @@ func main() {
 	}
 }
 
+func newStorage(driver string) (storage illustrator.CanvasStorage, err error) {
+	switch driver {
+	case "", "postgres":
+		return newPostgresStorage()
+	case "memory":
+		return memstore.NewStorage(), nil
+	case "file":
+		storageDir := os.Getenv("STORAGE_DIRECTORY")
+		if storageDir == "" {
+			storageDir = "./data"
+		}
+		return memstore.NewFileStorage(storageDir)
+	default:
+		return nil, fmt.Errorf("unknown storage driver '%s'", driver)
+	}
+}
+
+func backfillNames(storage illustrator.CanvasStorage, path string) (err error) {
+	backfiller, ok := storage.(illustrator.NameBackfiller)
+	if !ok {
+		return errors.New("storage driver does not support backfilling names")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	count, err := backfiller.BackfillNames(context.Background(), names)
+	if err != nil {
+		return
+	}
+
+	log.Printf("[INFO] backfilled %d of %d canvas names\n", count, len(names))
+	return
+}
+
 func (a *App) createCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
 	resp = new(router.HandlerResponse)
 	canvas := getCanvasFromRequest(req)
 
-	_, err := a.storage.Create(req.Context, canvas)
-	if err != nil {
-		if strings.Contains(err.Error(), "unique constraint") {
-			resp.SetText("canvas name already exists", http.StatusBadRequest)
-		} else {
-			setInternalErrorResponse(resp, "failed to create canvas", err)
-		}
+	if err := a.storage.Create(req.Context, canvas); err != nil {
+		setStorageErrorResponse(resp, "failed to create canvas", err)
 		return
 	}
 
@@ -85,23 +252,74 @@ func (a *App) createCanvas(req *router.HandlerRequest) (resp *router.HandlerResp
 	return
 }
 
+func (a *App) cloneCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+	clone := req.Body.(*illustrator.CloneRequest)
+
+	if err := a.storage.Clone(req.Context, name, clone.Name); err != nil {
+		setStorageErrorResponse(resp, "failed to clone canvas", err)
+		return
+	}
+
+	resp.SetText("clone OK", http.StatusCreated)
+	resp.SetHeader("ETag", formatETag(1))
+	return
+}
+
+func (a *App) renameCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+	rename := req.Body.(*illustrator.RenameRequest)
+
+	revision, err := getIfMatchRevision(req)
+	if err != nil {
+		resp.SetText(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	revision, err = a.storage.Rename(req.Context, name, revision, rename.Name)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to rename canvas", err)
+		return
+	}
+	a.hub.Publish(name, hub.Event{Type: hub.EventRename, Revision: revision, Name: rename.Name})
+
+	resp.SetText("rename OK", http.StatusOK)
+	resp.SetHeader("ETag", formatETag(revision))
+	return
+}
+
 func (a *App) updateCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
 	resp = new(router.HandlerResponse)
 	canvas := getCanvasFromRequest(req)
 
-	res, err := a.storage.Update(req.Context, canvas)
+	revision, err := getIfMatchRevision(req)
 	if err != nil {
-		setInternalErrorResponse(resp, "failed to update canvas", err)
+		resp.SetText(err.Error(), http.StatusBadRequest)
 		return
 	}
+	canvas.Revision = revision
 
-	count, err := res.RowsAffected()
-	if err == nil && count > 0 {
-		resp.SetText("update OK", http.StatusOK)
+	revision, err = a.storage.Update(req.Context, canvas)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to update canvas", err)
 		return
 	}
+	a.publishCanvas(req.Context, canvas.Name)
 
-	resp.SetText("canvas not found", http.StatusBadRequest)
+	resp.SetText("update OK", http.StatusOK)
+	resp.SetHeader("ETag", formatETag(revision))
 	return
 }
 
@@ -114,23 +332,37 @@ func (a *App) getCanvas(req *router.HandlerRequest) (resp *router.HandlerRespons
 		return
 	}
 
-	canvas, err := a.storage.FindByName(req.Context, hashString(name))
+	canvas, output, err := a.findRenderedCanvas(req.Context, name)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			resp.SetText("canvas not found", http.StatusBadRequest)
-		} else {
-			setInternalErrorResponse(resp, "failed to retrieve canvas", err)
-		}
+		setStorageErrorResponse(resp, "failed to retrieve canvas", err)
 		return
 	}
 
+	setRenderedResponse(resp, output, "/canvas/"+name+"/events")
+	resp.SetHeader("ETag", formatETag(canvas.Revision))
+	return
+}
+
+func renderCanvas(canvas *illustrator.CanvasModel) (output string) {
 	// Validation is carried out in the router
-	str, _ := canvas.GetString(' ', "<br>", nil)
-	templateData := &struct{ Canvas template.HTML }{template.HTML(str)}
-	resp.SetHTML(templateData, "index.html", http.StatusOK)
+	output, _ = canvas.GetString(' ', "<br>", nil)
 	return
 }
 
+func setCanvasResponse(resp *router.HandlerResponse, canvas *illustrator.CanvasModel) {
+	setRenderedResponse(resp, renderCanvas(canvas), "")
+}
+
+// setRenderedResponse responds with the page showing the rendered canvas. The
+// page follows the changes streamed by the events URL unless empty.
+func setRenderedResponse(resp *router.HandlerResponse, output string, eventsURL string) {
+	templateData := &struct {
+		Canvas template.HTML
+		Events string
+	}{template.HTML(output), eventsURL}
+	resp.SetHTML(templateData, "index.html", http.StatusOK)
+}
+
 func (a *App) deleteCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
 	resp = new(router.HandlerResponse)
 
@@ -140,34 +372,106 @@ func (a *App) deleteCanvas(req *router.HandlerRequest) (resp *router.HandlerResp
 		return
 	}
 
-	res, err := a.storage.Delete(req.Context, hashString(name))
+	if err := a.storage.Delete(req.Context, name); err != nil {
+		setStorageErrorResponse(resp, "failed to delete canvas", err)
+		return
+	}
+	a.hub.Publish(name, hub.Event{Type: hub.EventDelete})
+
+	resp.SetText("delete OK", http.StatusOK)
+	return
+}
+
+func (a *App) listCanvases(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	opts, err := getListOptionsFromRequest(req)
+	if err == nil {
+		err = opts.Normalize()
+	}
 	if err != nil {
-		setInternalErrorResponse(resp, "failed to delete canvas", err)
+		resp.SetText(err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	count, err := res.RowsAffected()
-	if err == nil && count > 0 {
-		resp.SetText("delete OK", http.StatusOK)
+	page, err := a.storage.List(req.Context, opts)
+	if err != nil {
+		if errors.Is(err, illustrator.ErrInvalidCursor) {
+			resp.SetText(err.Error(), http.StatusBadRequest)
+		} else {
+			setInternalErrorResponse(resp, "failed to list canvases", err)
+		}
 		return
 	}
 
-	resp.SetText("canvas not found", http.StatusBadRequest)
+	resp.SetJSON(page, http.StatusOK)
 	return
 }
 
-func getCanvasFromRequest(req *router.HandlerRequest) (canvas *illustrator.CanvasModel) {
-	canvas = req.Body.(*illustrator.CanvasModel)
-	canvas.Name = hashString(canvas.Name)
+func getListOptionsFromRequest(req *router.HandlerRequest) (opts illustrator.ListOptions, err error) {
+	opts.Cursor = req.Query.Get("cursor")
+	opts.SortBy = illustrator.ListSortField(req.Query.Get("sort"))
+
+	switch order := req.Query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		err = fmt.Errorf("unknown order '%s'", order)
+		return
+	}
+
+	intParams := map[string]*int{
+		"limit":      &opts.Limit,
+		"min_width":  &opts.MinWidth,
+		"max_width":  &opts.MaxWidth,
+		"min_height": &opts.MinHeight,
+		"max_height": &opts.MaxHeight,
+	}
+	for param, value := range intParams {
+		str := req.Query.Get(param)
+		if str == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(str); err != nil {
+			err = fmt.Errorf("query parameter '%s' must be a number", param)
+			return
+		}
+	}
 	return
 }
 
-func setInternalErrorResponse(resp *router.HandlerResponse, msg string, err error) {
-	resp.SetText(msg, http.StatusInternalServerError)
-	log.Printf("[ERROR] %v: %v\n", msg, err)
+func getCanvasFromRequest(req *router.HandlerRequest) (canvas *illustrator.CanvasModel) {
+	return req.Body.(*illustrator.CanvasModel)
+}
+
+// setStorageErrorResponse maps the errors of the storage, any other error is
+// reported as internal error with the given message
+func setStorageErrorResponse(resp *router.HandlerResponse, msg string, err error) {
+	switch {
+	case errors.Is(err, illustrator.ErrCanvasNotFound):
+		resp.SetText("canvas not found", http.StatusNotFound)
+	case errors.Is(err, illustrator.ErrVersionNotFound):
+		resp.SetText("canvas version not found", http.StatusNotFound)
+	case errors.Is(err, illustrator.ErrDrawingNotFound):
+		resp.SetText("drawing not found", http.StatusNotFound)
+	case errors.Is(err, illustrator.ErrWebhookNotFound):
+		resp.SetText("webhook not found", http.StatusNotFound)
+	case errors.Is(err, illustrator.ErrCanvasExists):
+		resp.SetText("canvas name already exists", http.StatusBadRequest)
+	case errors.Is(err, illustrator.ErrConflict):
+		resp.SetText("canvas was modified, revision does not match", http.StatusPreconditionFailed)
+	default:
+		setInternalErrorResponse(resp, msg, err)
+	}
 }
 
-func hashString(str string) (result string) {
-	hash := sha1.Sum([]byte(str))
-	return hex.EncodeToString(hash[:])
+func setInternalErrorResponse(resp *router.HandlerResponse, msg string, err error) {
+	// The storage is the upstream of the application
+	if errors.Is(err, illustrator.ErrTimeout) {
+		resp.SetText(msg+", storage timed out", http.StatusGatewayTimeout)
+	} else {
+		resp.SetText(msg, http.StatusInternalServerError)
+	}
+	log.Printf("[ERROR] %v: %v\n", msg, err)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/outbox"
+)
+
+const (
+	// Time between polls of the outbox once it ran empty
+	defaultOutboxPollInterval time.Duration = time.Second
+	// Max. number of events delivered at once
+	defaultOutboxBatchSize int = 100
+	// Time limit of a webhook delivery
+	defaultOutboxWebhookTimeout time.Duration = 10 * time.Second
+)
+
+// newDispatcher delivers the change events of the outbox to the webhooks of
+// the store, unless nil, and the sinks enabled by OUTBOX_LOG,
+// OUTBOX_WEBHOOK_URL and OUTBOX_FILE. Without sinks the events are dropped
+// from the outbox as they come.
+func newDispatcher(eventOutbox illustrator.EventOutbox, webhooks illustrator.WebhookStore) (
+	dispatcher *outbox.Dispatcher, err error) {
+	var sinks []outbox.Sink
+	if webhooks != nil {
+		notifier, err := newNotifier(webhooks)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, notifier)
+	}
+
+	logEvents, err := getBoolEnv("OUTBOX_LOG", false)
+	if err != nil {
+		return
+	}
+	if logEvents {
+		sinks = append(sinks, outbox.LogSink{})
+	}
+	if url := os.Getenv("OUTBOX_WEBHOOK_URL"); url != "" {
+		timeout, err := getDurationEnv("OUTBOX_WEBHOOK_TIMEOUT", defaultOutboxWebhookTimeout)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, outbox.NewWebhookSink(url, timeout))
+	}
+	if path := os.Getenv("OUTBOX_FILE"); path != "" {
+		sinks = append(sinks, outbox.NewFileSink(path))
+	}
+
+	pollInterval, err := getDurationEnv("OUTBOX_POLL_INTERVAL", defaultOutboxPollInterval)
+	if err != nil {
+		return
+	}
+	batchSize, err := getIntEnv("OUTBOX_BATCH_SIZE", defaultOutboxBatchSize)
+	if err != nil {
+		return
+	}
+
+	return outbox.NewDispatcher(eventOutbox, sinks, outbox.Options{BatchSize: batchSize, PollInterval: pollInterval}), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/jsonpatch"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+// errPatchRejected aborts the transaction of a patch which cannot be applied,
+// the response is set already
+var errPatchRejected = errors.New("patch rejected")
+
+func (a *App) patchCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var apply func(doc []byte, patch []byte) (patched []byte, err error)
+	switch mediaType {
+	case jsonpatch.ContentTypeJSONPatch:
+		apply = jsonpatch.Apply
+	case jsonpatch.ContentTypeMergePatch:
+		apply = jsonpatch.ApplyMerge
+	default:
+		resp.SetText("content type must be "+jsonpatch.ContentTypeJSONPatch+" or "+jsonpatch.ContentTypeMergePatch,
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	revision, err := getIfMatchRevision(req)
+	if err != nil {
+		resp.SetText(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The canvas is read, patched and written back within a transaction, so no
+	// other change gets in between
+	var newRevision int
+	err = a.storage.WithTx(req.Context, func(tx illustrator.CanvasStorage) (err error) {
+		canvas, err := tx.FindByName(req.Context, name)
+		if err != nil {
+			return
+		}
+		if revision != 0 && revision != canvas.Revision {
+			return illustrator.ErrConflict
+		}
+
+		patched, ok := a.applyCanvasPatch(resp, canvas, req.Body.([]byte), apply)
+		if !ok {
+			return errPatchRejected
+		}
+
+		newRevision, err = tx.Update(req.Context, patched)
+		return
+	})
+	if errors.Is(err, errPatchRejected) {
+		return
+	}
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to patch canvas", err)
+		return
+	}
+	a.publishCanvas(req.Context, name)
+
+	resp.SetText("patch OK", http.StatusOK)
+	resp.SetHeader("ETag", formatETag(newRevision))
+	return
+}
+
+// applyCanvasPatch returns the patched canvas conditioned on the revision of
+// the given one. The canvas name cannot be patched.
+func (a *App) applyCanvasPatch(resp *router.HandlerResponse, canvas *illustrator.CanvasModel, patch []byte,
+	apply func(doc []byte, patch []byte) (patched []byte, err error)) (patched *illustrator.CanvasModel, ok bool) {
+	doc, err := json.Marshal(canvas)
+	if err != nil {
+		setInternalErrorResponse(resp, "failed to encode canvas", err)
+		return
+	}
+
+	doc, err = apply(doc, patch)
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			resp.SetText(err.Error(), http.StatusConflict)
+		} else {
+			resp.SetText(err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	patched = &illustrator.CanvasModel{}
+	if err = json.Unmarshal(doc, patched); err != nil {
+		resp.SetText("patched canvas is invalid: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if illustrator.CanvasKey(patched.Name) != illustrator.CanvasKey(canvas.Name) {
+		resp.SetText("canvas name cannot be patched", http.StatusBadRequest)
+		return nil, false
+	}
+	if err = a.validator.Struct(patched); err != nil {
+		resp.SetText("patched canvas is invalid: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	patched.Revision = canvas.Revision
+	return patched, true
+}
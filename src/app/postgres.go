@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/dba"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+const (
+	// Connection pool of the postgres driver
+	defaultMaxOpenConns    int           = 10
+	defaultMaxIdleConns    int           = 2
+	defaultConnMaxLifetime time.Duration = 30 * time.Minute
+	defaultConnMaxIdleTime time.Duration = 5 * time.Minute
+	// Time the database is waited for on startup
+	defaultStartupTimeout time.Duration = 30 * time.Second
+)
+
+func newPostgresStorage() (storage illustrator.CanvasStorage, err error) {
+	conn := dba.ConnConfig{
+		Host:            os.Getenv("POSTGRES_HOST"),
+		Port:            os.Getenv("POSTGRES_PORT"),
+		User:            os.Getenv("POSTGRES_USER"),
+		Password:        os.Getenv("POSTGRES_PASSWORD"),
+		Database:        os.Getenv("POSTGRES_DATABASE"),
+		SSLMode:         os.Getenv("POSTGRES_SSLMODE"),
+		ApplicationName: os.Getenv("POSTGRES_APPLICATION_NAME"),
+	}
+
+	var opts dba.Options
+	if opts.Pool.MaxOpenConns, err = getIntEnv("POSTGRES_MAX_OPEN_CONNS", defaultMaxOpenConns); err != nil {
+		return
+	}
+	if opts.Pool.MaxIdleConns, err = getIntEnv("POSTGRES_MAX_IDLE_CONNS", defaultMaxIdleConns); err != nil {
+		return
+	}
+	if opts.Pool.ConnMaxLifetime, err = getDurationEnv("POSTGRES_CONN_MAX_LIFETIME", defaultConnMaxLifetime); err != nil {
+		return
+	}
+	if opts.Pool.ConnMaxIdleTime, err = getDurationEnv("POSTGRES_CONN_MAX_IDLE_TIME", defaultConnMaxIdleTime); err != nil {
+		return
+	}
+	if opts.StartupTimeout, err = getDurationEnv("POSTGRES_STARTUP_TIMEOUT", defaultStartupTimeout); err != nil {
+		return
+	}
+	if opts.Layout, err = dba.ParseDrawingsLayout(os.Getenv("DRAWINGS_LAYOUT")); err != nil {
+		return
+	}
+	if opts.Timeout, err = getDurationEnv("QUERY_TIMEOUT", defaultQueryTimeout); err != nil {
+		return
+	}
+
+	return dba.NewStorage("postgres", conn.DSN(), opts)
+}
+
+func (a *App) getPoolStats(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+	stats := a.pool.PoolStats()
+	resp.SetJSON(&stats, http.StatusOK)
+	return
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+const (
+	// Time trashed canvases are kept before being purged
+	defaultTrashRetention time.Duration = 30 * 24 * time.Hour
+	// Time between purges of the trash
+	defaultTrashPurgeInterval time.Duration = time.Hour
+)
+
+func (a *App) listTrash(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	canvases, err := a.storage.ListTrash(req.Context)
+	if err != nil {
+		setInternalErrorResponse(resp, "failed to list trash", err)
+		return
+	}
+
+	resp.SetJSON(&struct {
+		Canvases []illustrator.TrashedCanvas `json:"canvases"`
+	}{canvases}, http.StatusOK)
+	return
+}
+
+func (a *App) undeleteCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	err := a.storage.Undelete(req.Context, name)
+	switch {
+	case err == nil:
+		resp.SetText("restore OK", http.StatusOK)
+	case errors.Is(err, illustrator.ErrCanvasNotFound):
+		resp.SetText("canvas not found in trash", http.StatusNotFound)
+	default:
+		setStorageErrorResponse(resp, "failed to restore canvas", err)
+	}
+	return
+}
+
+func (a *App) purgeCanvas(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	err := a.storage.Purge(req.Context, name)
+	switch {
+	case err == nil:
+		resp.SetText("purge OK", http.StatusOK)
+	case errors.Is(err, illustrator.ErrCanvasNotFound):
+		resp.SetText("canvas not found in trash", http.StatusNotFound)
+	default:
+		setStorageErrorResponse(resp, "failed to purge canvas", err)
+	}
+	return
+}
+
+// purgeTrash periodically purges the canvases trashed longer than the
+// retention period until the context is done
+func purgeTrash(ctx context.Context, storage illustrator.CanvasStorage, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := storage.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("[ERROR] failed to purge trash: %v\n", err)
+		} else if count > 0 {
+			log.Printf("[INFO] purged %d canvases from trash\n", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getDurationEnv parses a duration environment variable, e.g. "720h"
+func getDurationEnv(key string, fallback time.Duration) (value time.Duration, err error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return fallback, nil
+	}
+
+	value, err = time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("environment variable %s must be a duration: %w", key, err)
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+)
+
+func (a *App) listCanvasVersions(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, ok := req.Vars["name"]
+	if !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := a.storage.ListVersions(req.Context, name)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to list canvas versions", err)
+		return
+	}
+
+	resp.SetJSON(&struct {
+		Versions []illustrator.CanvasVersion `json:"versions"`
+	}{versions}, http.StatusOK)
+	return
+}
+
+func (a *App) getCanvasVersion(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, version, ok := getVersionVars(req, resp)
+	if !ok {
+		return
+	}
+
+	canvas, err := a.storage.FindVersion(req.Context, name, version)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to retrieve canvas version", err)
+		return
+	}
+
+	setCanvasResponse(resp, canvas)
+	return
+}
+
+func (a *App) restoreCanvasVersion(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	name, version, ok := getVersionVars(req, resp)
+	if !ok {
+		return
+	}
+
+	revision, err := getIfMatchRevision(req)
+	if err != nil {
+		resp.SetText(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	revision, err = a.storage.RestoreVersion(req.Context, name, revision, version)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to restore canvas version", err)
+		return
+	}
+	a.publishCanvas(req.Context, name)
+
+	resp.SetText("restore OK", http.StatusOK)
+	resp.SetHeader("ETag", formatETag(revision))
+	return
+}
+
+func getVersionVars(req *router.HandlerRequest, resp *router.HandlerResponse) (name string, version int, ok bool) {
+	if name, ok = req.Vars["name"]; !ok {
+		resp.SetText("route variable 'name' not found", http.StatusBadRequest)
+		return
+	}
+
+	version, err := strconv.Atoi(req.Vars["version"])
+	if err != nil {
+		resp.SetText("route variable 'version' must be a number", http.StatusBadRequest)
+		return name, 0, false
+	}
+	return
+}
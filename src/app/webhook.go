@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/router"
+	"github.com/sketch-home-task/src/pkg/webhook"
+)
+
+// newNotifier posts the change events to the webhooks of the store, each
+// attempt limited by WEBHOOK_TIMEOUT. Failed deliveries are retried with the
+// backoff of the outbox.
+func newNotifier(store illustrator.WebhookStore) (notifier *webhook.Notifier, err error) {
+	timeout, err := getDurationEnv("WEBHOOK_TIMEOUT", 0)
+	if err != nil {
+		return
+	}
+
+	return webhook.NewNotifier(store, webhook.Options{Timeout: timeout}), nil
+}
+
+func (a *App) createWebhook(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+	hook := req.Body.(*illustrator.Webhook)
+
+	if hook.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			setInternalErrorResponse(resp, "failed to generate webhook secret", err)
+			return
+		}
+		hook.Secret = secret
+	}
+
+	if err := a.webhooks.CreateWebhook(req.Context, hook); err != nil {
+		setStorageErrorResponse(resp, "failed to create webhook", err)
+		return
+	}
+
+	// The secret is only returned once
+	resp.SetJSON(hook, http.StatusCreated)
+	return
+}
+
+func (a *App) listWebhooks(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	webhooks, err := a.webhooks.ListWebhooks(req.Context)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to list webhooks", err)
+		return
+	}
+
+	if webhooks == nil {
+		webhooks = []illustrator.Webhook{}
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	resp.SetJSON(&struct {
+		Webhooks []illustrator.Webhook `json:"webhooks"`
+	}{webhooks}, http.StatusOK)
+	return
+}
+
+func (a *App) deleteWebhook(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	id, ok := getWebhookID(req, resp)
+	if !ok {
+		return
+	}
+
+	if err := a.webhooks.DeleteWebhook(req.Context, id); err != nil {
+		setStorageErrorResponse(resp, "failed to delete webhook", err)
+		return
+	}
+
+	resp.SetText("delete OK", http.StatusOK)
+	return
+}
+
+func (a *App) listWebhookDeliveries(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+	resp = new(router.HandlerResponse)
+
+	id, ok := getWebhookID(req, resp)
+	if !ok {
+		return
+	}
+
+	deliveries, err := a.webhooks.ListWebhookDeliveries(req.Context, id, illustrator.WebhookMaxDeliveries)
+	if err != nil {
+		setStorageErrorResponse(resp, "failed to list webhook deliveries", err)
+		return
+	}
+
+	resp.SetJSON(&struct {
+		Deliveries []illustrator.WebhookDelivery `json:"deliveries"`
+	}{deliveries}, http.StatusOK)
+	return
+}
+
+func getWebhookID(req *router.HandlerRequest, resp *router.HandlerResponse) (id int64, ok bool) {
+	id, err := strconv.ParseInt(req.Vars["id"], 10, 64)
+	if err != nil {
+		resp.SetText("route variable 'id' must be a number", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,316 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+const (
+	// Media type of archives, one JSON document per line
+	ContentType string = "application/x-ndjson"
+	// Format name and version written to the header line of archives
+	FormatName    string = "canvas-archive"
+	FormatVersion int    = 1
+)
+
+var ErrInvalidArchive = errors.New("invalid canvas archive")
+
+// Header is the first line of an archive
+type Header struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Canvas is a line of an archive, holding a canvas together with its
+// metadata and version history
+type Canvas struct {
+	Name      string                   `json:"name"`
+	Width     int                      `json:"width"`
+	Height    int                      `json:"height"`
+	Drawings  illustrator.DrawingSlice `json:"drawings"`
+	CreatedAt time.Time                `json:"created_at"`
+	UpdatedAt time.Time                `json:"updated_at"`
+	// Name of the canvas this one was cloned from, if still stored
+	ForkedFrom string `json:"forked_from,omitempty"`
+	// Versions of the canvas, oldest first
+	Versions []Version `json:"versions"`
+}
+
+type Version struct {
+	Version   int                      `json:"version"`
+	Width     int                      `json:"width"`
+	Height    int                      `json:"height"`
+	Drawings  illustrator.DrawingSlice `json:"drawings"`
+	CreatedAt time.Time                `json:"created_at"`
+}
+
+// Summary reports the outcome of an import
+type Summary struct {
+	Imported int `json:"imported"`
+	// Canvases whose name is taken already, which are left as they are
+	Skipped []string  `json:"skipped"`
+	Failed  []Failure `json:"failed"`
+}
+
+// ExportSummary reports the outcome of an export
+type ExportSummary struct {
+	Exported int `json:"exported"`
+	// Keys of the canvases listed but not found by their key, which were
+	// deleted meanwhile or stored before display names were kept and not
+	// backfilled yet
+	Skipped []string `json:"skipped"`
+}
+
+// Failure is a line of an archive which could not be imported
+type Failure struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// Export writes every canvas of the storage to w, one canvas at a time. The
+// canvases are paged through by name, canvases which cannot be found by their
+// key are left out and reported.
+func Export(ctx context.Context, storage illustrator.CanvasStorage, w io.Writer) (summary ExportSummary, err error) {
+	summary = ExportSummary{Skipped: []string{}}
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(&Header{Format: FormatName, Version: FormatVersion, ExportedAt: time.Now().UTC()})
+	if err != nil {
+		return
+	}
+
+	opts := illustrator.ListOptions{Limit: illustrator.ListMaxLimit, SortBy: illustrator.ListSortByName}
+	for {
+		var page *illustrator.CanvasPage
+		page, err = storage.List(ctx, opts)
+		if err != nil {
+			return
+		}
+
+		for i := range page.Canvases {
+			var canvas *Canvas
+			canvas, err = exportCanvas(ctx, storage, &page.Canvases[i])
+			if errors.Is(err, illustrator.ErrCanvasNotFound) || errors.Is(err, illustrator.ErrVersionNotFound) {
+				summary.Skipped = append(summary.Skipped, page.Canvases[i].Key)
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if err = encoder.Encode(canvas); err != nil {
+				return
+			}
+			summary.Exported++
+		}
+
+		if page.NextCursor == "" {
+			return
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func exportCanvas(ctx context.Context, storage illustrator.CanvasStorage, info *illustrator.CanvasInfo) (canvas *Canvas,
+	err error) {
+	current, err := storage.FindByName(ctx, info.Key)
+	if err != nil {
+		return
+	}
+	versions, err := storage.ListVersions(ctx, info.Key)
+	if err != nil {
+		return
+	}
+
+	canvas = &Canvas{
+		Name:       current.Name,
+		Width:      current.Width,
+		Height:     current.Height,
+		Drawings:   current.Drawings,
+		CreatedAt:  info.CreatedAt,
+		UpdatedAt:  info.UpdatedAt,
+		ForkedFrom: info.ForkedFrom,
+		Versions:   make([]Version, 0, len(versions)),
+	}
+	for _, v := range versions {
+		var version *illustrator.CanvasModel
+		version, err = storage.FindVersion(ctx, info.Key, v.Version)
+		if err != nil {
+			return
+		}
+		canvas.Versions = append(canvas.Versions, Version{
+			Version:   v.Version,
+			Width:     version.Width,
+			Height:    version.Height,
+			Drawings:  version.Drawings,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+	return
+}
+
+// Import stores the canvases of the archive read from r, one line at a time.
+// Every canvas is stored with its timestamps and versions as they are in the
+// archive, the canvases they were cloned from are linked once all are stored.
+// Canvases whose name is taken are skipped, canvases with invalid names or
+// failing the check, if given, are reported, neither stops the import. Errors of the archive itself
+// or of the storage do.
+func Import(ctx context.Context, storage illustrator.CanvasStorage, r io.Reader, check illustrator.CanvasCheck) (summary Summary,
+	err error) {
+	summary = Summary{Skipped: []string{}, Failed: []Failure{}}
+	reader := bufio.NewReader(r)
+
+	header, line, err := readLine(reader, 0)
+	if err == io.EOF {
+		return summary, fmt.Errorf("%w: missing header", ErrInvalidArchive)
+	}
+	if err != nil {
+		return
+	}
+	var h Header
+	if err = json.Unmarshal(header, &h); err != nil || h.Format != FormatName {
+		return summary, fmt.Errorf("%w: missing header", ErrInvalidArchive)
+	}
+	if h.Version != FormatVersion {
+		return summary, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, h.Version)
+	}
+
+	// Imported forks, their parent may come later in the archive
+	var forks []*Canvas
+	for {
+		var data []byte
+		data, line, err = readLine(reader, line)
+		if err == io.EOF {
+			return summary, linkForks(ctx, storage, forks)
+		}
+		if err != nil {
+			return
+		}
+
+		var canvas Canvas
+		if err = json.Unmarshal(data, &canvas); err != nil {
+			return summary, fmt.Errorf("%w: line %d: %v", ErrInvalidArchive, line, err)
+		}
+
+		err = importCanvas(ctx, storage, &canvas, check)
+		var checkErr *checkError
+		switch {
+		case err == nil:
+			summary.Imported++
+			if canvas.ForkedFrom != "" {
+				forks = append(forks, &canvas)
+			}
+		case errors.Is(err, illustrator.ErrCanvasExists):
+			summary.Skipped = append(summary.Skipped, canvas.Name)
+		case errors.As(err, &checkErr):
+			summary.Failed = append(summary.Failed, Failure{Line: line, Name: canvas.Name, Error: checkErr.Error()})
+		default:
+			return summary, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// linkForks records the canvases the forks were cloned from. Forks of canvases
+// neither in the archive nor in the storage stay unlinked.
+func linkForks(ctx context.Context, storage illustrator.CanvasStorage, forks []*Canvas) (err error) {
+	for _, fork := range forks {
+		err = storage.LinkFork(ctx, fork.Name, fork.ForkedFrom)
+		if errors.Is(err, illustrator.ErrCanvasNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("fork %s: %w", fork.Name, err)
+		}
+	}
+	return nil
+}
+
+// readLine returns the next line which is not blank and its number, counting
+// on from the number of the previous one. It returns io.EOF once there is none.
+func readLine(reader *bufio.Reader, previous int) (data []byte, line int, err error) {
+	for line = previous + 1; ; line++ {
+		data, err = reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			return data, line, nil
+		}
+		if err != nil {
+			return nil, line, err
+		}
+	}
+}
+
+// checkError is a canvas of the archive rejected by the check
+type checkError struct {
+	err error
+}
+
+func (e *checkError) Error() (msg string) {
+	return "canvas is invalid: " + e.err.Error()
+}
+
+func importCanvas(ctx context.Context, storage illustrator.CanvasStorage, canvas *Canvas, check illustrator.CanvasCheck) (err error) {
+	if !illustrator.ValidCanvasName(canvas.Name) {
+		return &checkError{err: fmt.Errorf("name must be 1 - %d characters", illustrator.CanvasMaxNameSize)}
+	}
+
+	history := &illustrator.CanvasHistory{
+		Canvas:    illustrator.CanvasModel{Name: canvas.Name, Width: canvas.Width, Height: canvas.Height, Drawings: canvas.Drawings},
+		CreatedAt: canvas.CreatedAt,
+		UpdatedAt: canvas.UpdatedAt,
+	}
+	// Archives written by hand may lack the timestamps
+	if history.CreatedAt.IsZero() {
+		history.CreatedAt = time.Now().UTC()
+	}
+	if history.UpdatedAt.IsZero() {
+		history.UpdatedAt = history.CreatedAt
+	}
+
+	for i, v := range canvas.Versions {
+		if v.Version != i+1 {
+			return &checkError{err: fmt.Errorf("version %d out of sequence", v.Version)}
+		}
+		version := illustrator.CanvasSnapshot{
+			Version:   v.Version,
+			Canvas:    illustrator.CanvasModel{Name: canvas.Name, Width: v.Width, Height: v.Height, Drawings: v.Drawings},
+			CreatedAt: v.CreatedAt,
+		}
+		if version.CreatedAt.IsZero() {
+			version.CreatedAt = history.CreatedAt
+		}
+		history.Versions = append(history.Versions, version)
+	}
+	// The current content ends the history
+	if len(history.Versions) == 0 || !sameContent(&history.Versions[len(history.Versions)-1].Canvas, &history.Canvas) {
+		history.Versions = append(history.Versions, illustrator.CanvasSnapshot{
+			Version:   len(history.Versions) + 1,
+			Canvas:    history.Canvas,
+			CreatedAt: history.UpdatedAt,
+		})
+	}
+
+	for i := range history.Versions {
+		if check == nil {
+			break
+		}
+		if err = check(&history.Versions[i].Canvas); err != nil {
+			return &checkError{err: err}
+		}
+	}
+
+	return storage.Import(ctx, history)
+}
+
+func sameContent(a, b *illustrator.CanvasModel) (same bool) {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(dataA) == string(dataB)
+}
@@ -0,0 +1,222 @@
+package archive_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sketch-home-task/src/pkg/archive"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/memstore"
+	"github.com/stretchr/testify/suite"
+)
+
+type ArchiveSuite struct {
+	suite.Suite
+	storage illustrator.CanvasStorage
+	ctx     context.Context
+}
+
+func TestArchiveSuite(t *testing.T) {
+	suite.Run(t, new(ArchiveSuite))
+}
+
+func (s *ArchiveSuite) SetupTest() {
+	s.storage = memstore.NewStorage()
+	s.ctx = context.Background()
+
+	fill := '*'
+	canvas := illustrator.CanvasModel{Name: "MonaLisa", Width: 20, Height: 20}
+	s.Require().NoError(s.storage.Create(s.ctx, &canvas))
+	canvas.Drawings = []illustrator.DrawingModel{{Coordinates: []int{1, 1}, Width: 2, Height: 2, Fill: &fill}}
+	_, err := s.storage.Update(s.ctx, &canvas)
+	s.Require().NoError(err)
+	s.Require().NoError(s.storage.Clone(s.ctx, "monalisa", "copy"))
+}
+
+func (s *ArchiveSuite) export() (data []byte) {
+	var buf bytes.Buffer
+	summary, err := archive.Export(s.ctx, s.storage, &buf)
+	s.Require().NoError(err)
+	s.Equal(2, summary.Exported)
+	s.Empty(summary.Skipped)
+	return buf.Bytes()
+}
+
+func (s *ArchiveSuite) TestExport() {
+	scanner := bufio.NewScanner(bytes.NewReader(s.export()))
+
+	s.Require().True(scanner.Scan())
+	var header archive.Header
+	s.NoError(json.Unmarshal(scanner.Bytes(), &header))
+	s.Equal(archive.FormatName, header.Format)
+	s.Equal(archive.FormatVersion, header.Version)
+
+	// One line per canvas, by name
+	var canvases []archive.Canvas
+	for scanner.Scan() {
+		var canvas archive.Canvas
+		s.NoError(json.Unmarshal(scanner.Bytes(), &canvas))
+		canvases = append(canvases, canvas)
+	}
+	s.Require().Len(canvases, 2)
+	s.Equal("copy", canvases[0].Name)
+	s.Equal("MonaLisa", canvases[0].ForkedFrom)
+	s.Len(canvases[0].Versions, 1)
+
+	s.Equal("MonaLisa", canvases[1].Name)
+	s.Len(canvases[1].Drawings, 1)
+	s.Require().Len(canvases[1].Versions, 2)
+	s.Empty(canvases[1].Versions[0].Drawings)
+	s.Equal(2, canvases[1].Versions[1].Version)
+	s.False(canvases[1].CreatedAt.IsZero())
+}
+
+// unnamedStorage cannot find the canvas of the key by it, as canvases stored
+// before display names were kept
+type unnamedStorage struct {
+	illustrator.CanvasStorage
+	key string
+}
+
+func (u *unnamedStorage) FindByName(ctx context.Context, name string) (canvas *illustrator.CanvasModel, err error) {
+	if name == u.key {
+		return nil, illustrator.ErrCanvasNotFound
+	}
+	return u.CanvasStorage.FindByName(ctx, name)
+}
+
+func (s *ArchiveSuite) TestExportSkipped() {
+	var buf bytes.Buffer
+	summary, err := archive.Export(s.ctx, &unnamedStorage{CanvasStorage: s.storage, key: "copy"}, &buf)
+	s.NoError(err)
+	s.Equal(1, summary.Exported)
+	s.Equal([]string{"copy"}, summary.Skipped)
+	s.Equal(2, strings.Count(buf.String(), "\n"))
+}
+
+func (s *ArchiveSuite) TestImport() {
+	data := s.export()
+
+	target := memstore.NewStorage()
+	summary, err := archive.Import(s.ctx, target, bytes.NewReader(data), nil)
+	s.NoError(err)
+	s.Equal(archive.Summary{Imported: 2, Skipped: []string{}, Failed: []archive.Failure{}}, summary)
+
+	// The history is stored as it was
+	canvas, err := target.FindByName(s.ctx, "monalisa")
+	s.NoError(err)
+	s.Equal("MonaLisa", canvas.Name)
+	s.Len(canvas.Drawings, 1)
+	versions, err := target.ListVersions(s.ctx, "monalisa")
+	s.NoError(err)
+	s.Len(versions, 2)
+
+	// Importing again leaves the canvases as they are
+	summary, err = archive.Import(s.ctx, target, bytes.NewReader(data), nil)
+	s.NoError(err)
+	s.Equal(0, summary.Imported)
+	s.Equal([]string{"copy", "MonaLisa"}, summary.Skipped)
+	versions, err = target.ListVersions(s.ctx, "monalisa")
+	s.NoError(err)
+	s.Len(versions, 2)
+}
+
+func (s *ArchiveSuite) TestImportMetadata() {
+	data := s.export()
+
+	target := memstore.NewStorage()
+	_, err := archive.Import(s.ctx, target, bytes.NewReader(data), nil)
+	s.Require().NoError(err)
+
+	// Exporting the imported canvases gives the same archive, the fork listed
+	// before its parent included
+	var buf bytes.Buffer
+	_, err = archive.Export(s.ctx, target, &buf)
+	s.Require().NoError(err)
+	lines := strings.SplitN(string(data), "\n", 2)
+	reimported := strings.SplitN(buf.String(), "\n", 2)
+	s.Equal(lines[1], reimported[1])
+
+	page, err := target.List(s.ctx, illustrator.ListOptions{})
+	s.NoError(err)
+	s.Require().Len(page.Canvases, 2)
+	s.Equal("MonaLisa", page.Canvases[0].ForkedFrom)
+	canvas, err := target.FindByName(s.ctx, "monalisa")
+	s.NoError(err)
+	s.Equal(2, canvas.Revision)
+}
+
+func (s *ArchiveSuite) TestImportVersionSequence() {
+	data := "{\"format\": \"canvas-archive\", \"version\": 1}\n" +
+		"{\"name\": \"monalisa\", \"width\": 5, \"height\": 5, \"versions\": [{\"version\": 2, \"width\": 5, \"height\": 5}]}\n"
+
+	target := memstore.NewStorage()
+	summary, err := archive.Import(s.ctx, target, strings.NewReader(data), nil)
+	s.NoError(err)
+	s.Equal(0, summary.Imported)
+	s.Equal([]archive.Failure{{Line: 2, Name: "monalisa", Error: "canvas is invalid: version 2 out of sequence"}}, summary.Failed)
+}
+
+func (s *ArchiveSuite) TestImportInvalidName() {
+	data := "{\"format\": \"canvas-archive\", \"version\": 1}\n" +
+		"{\"name\": \"" + strings.Repeat("a", illustrator.CanvasMaxNameSize+1) + "\", \"width\": 5, \"height\": 5}\n" +
+		"{\"name\": \"first\", \"width\": 5, \"height\": 5}\n"
+
+	// Names not fitting the storage fail the canvas, not the import
+	target := memstore.NewStorage()
+	summary, err := archive.Import(s.ctx, target, strings.NewReader(data), nil)
+	s.NoError(err)
+	s.Equal(1, summary.Imported)
+	s.Require().Len(summary.Failed, 1)
+	s.Equal(2, summary.Failed[0].Line)
+	s.Equal("canvas is invalid: name must be 1 - 50 characters", summary.Failed[0].Error)
+}
+
+func (s *ArchiveSuite) TestImportCheck() {
+	data := s.export()
+
+	invalid := errors.New("too wide")
+	target := memstore.NewStorage()
+	summary, err := archive.Import(s.ctx, target, bytes.NewReader(data), func(canvas *illustrator.CanvasModel) error {
+		if canvas.Name == "copy" {
+			return invalid
+		}
+		return nil
+	})
+	s.NoError(err)
+	s.Equal(1, summary.Imported)
+	s.Require().Len(summary.Failed, 1)
+	s.Equal(archive.Failure{Line: 2, Name: "copy", Error: "canvas is invalid: too wide"}, summary.Failed[0])
+
+	_, err = target.FindByName(s.ctx, "copy")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+}
+
+func (s *ArchiveSuite) TestImportInvalid() {
+	target := memstore.NewStorage()
+
+	_, err := archive.Import(s.ctx, target, strings.NewReader(""), nil)
+	s.True(errors.Is(err, archive.ErrInvalidArchive))
+
+	_, err = archive.Import(s.ctx, target, strings.NewReader(`{"name": "monalisa"}`), nil)
+	s.True(errors.Is(err, archive.ErrInvalidArchive))
+
+	_, err = archive.Import(s.ctx, target, strings.NewReader(`{"format": "canvas-archive", "version": 2}`), nil)
+	s.True(errors.Is(err, archive.ErrInvalidArchive))
+
+	// Lines before a malformed one are kept
+	data := "{\"format\": \"canvas-archive\", \"version\": 1}\n\n" +
+		"{\"name\": \"first\", \"width\": 5, \"height\": 5}\n" +
+		"{\"name\": \n"
+	summary, err := archive.Import(s.ctx, target, strings.NewReader(data), nil)
+	s.True(errors.Is(err, archive.ErrInvalidArchive))
+	s.Contains(err.Error(), "line 4")
+	s.Equal(1, summary.Imported)
+	_, err = target.FindByName(s.ctx, "first")
+	s.NoError(err)
+}
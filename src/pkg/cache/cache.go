@@ -0,0 +1,376 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+type Options struct {
+	// Max. number of cached canvases, the least recently used ones are evicted
+	Size int
+	// Time a canvas stays cached, zero keeps it until evicted or changed
+	TTL time.Duration
+	// Cache the rendered output of canvases as well
+	Rendered bool
+}
+
+// Stats counts the lookups answered from the cache
+type Stats struct {
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+	RenderHits   uint64 `json:"render_hits"`
+	RenderMisses uint64 `json:"render_misses"`
+	Evictions    uint64 `json:"evictions"`
+	Size         int    `json:"size"`
+}
+
+// Renderer renders a canvas, the output is cached by canvas revision
+type Renderer func(canvas *illustrator.CanvasModel) (output string)
+
+// Storage is a read-through cache of canvases in front of another storage.
+// Canvases are cached by key on lookup and dropped by every change made
+// through the cache. Changes made by other instances sharing the underlying
+// storage are only seen once the cached canvas expired.
+type Storage struct {
+	illustrator.CanvasStorage
+	opts Options
+
+	mu sync.Mutex
+	// Entries by canvas key, most recently used first
+	entries map[string]*list.Element
+	lru     *list.List
+	// Incremented by every change, lookups started before are not cached
+	generation uint64
+	stats      Stats
+}
+
+type entry struct {
+	key     string
+	canvas  *illustrator.CanvasModel
+	expires time.Time
+	// Rendered output of the canvas revision, set once rendered
+	output   string
+	rendered bool
+}
+
+func NewStorage(storage illustrator.CanvasStorage, opts Options) (s *Storage) {
+	return &Storage{
+		CanvasStorage: storage,
+		opts:          opts,
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+	}
+}
+
+// Stats returns the counters since the cache was created
+func (s *Storage) Stats() (stats Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats = s.stats
+	stats.Size = s.lru.Len()
+	return
+}
+
+func (s *Storage) FindByName(ctx context.Context, name string) (canvas *illustrator.CanvasModel, err error) {
+	key := illustrator.CanvasKey(name)
+
+	s.mu.Lock()
+	e := s.lookup(key)
+	generation := s.generation
+	if e != nil {
+		s.stats.Hits++
+		canvas = e.canvas.Clone()
+	} else {
+		s.stats.Misses++
+	}
+	s.mu.Unlock()
+	if canvas != nil {
+		return
+	}
+
+	canvas, err = s.CanvasStorage.FindByName(ctx, name)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A change since the lookup started may not be part of the canvas
+	if generation == s.generation {
+		s.store(key, canvas.Clone())
+	}
+	return
+}
+
+// FindRendered returns a canvas together with its rendered output, which is
+// only rendered again once the canvas revision changed
+func (s *Storage) FindRendered(ctx context.Context, name string, render Renderer) (canvas *illustrator.CanvasModel,
+	output string, err error) {
+	canvas, err = s.FindByName(ctx, name)
+	if err != nil || !s.opts.Rendered {
+		if err == nil {
+			output = render(canvas)
+		}
+		return
+	}
+
+	key := illustrator.CanvasKey(name)
+	s.mu.Lock()
+	e := s.lookup(key)
+	if e != nil && e.rendered && e.canvas.Revision == canvas.Revision {
+		s.stats.RenderHits++
+		output = e.output
+		s.mu.Unlock()
+		return
+	}
+	s.stats.RenderMisses++
+	s.mu.Unlock()
+
+	output = render(canvas)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e = s.lookup(key); e != nil && e.canvas.Revision == canvas.Revision {
+		e.output, e.rendered = output, true
+	}
+	return
+}
+
+// lookup returns the cached entry of the key unless expired, marking it as
+// most recently used. Must be called with the lock held.
+func (s *Storage) lookup(key string) (e *entry) {
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+
+	e = elem.Value.(*entry)
+	if s.opts.TTL > 0 && time.Now().After(e.expires) {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+		return nil
+	}
+	s.lru.MoveToFront(elem)
+	return
+}
+
+// store caches the canvas, evicting the least recently used canvases beyond
+// the size bound. Must be called with the lock held.
+func (s *Storage) store(key string, canvas *illustrator.CanvasModel) {
+	e := &entry{key: key, canvas: canvas, expires: time.Now().Add(s.opts.TTL)}
+	if elem, ok := s.entries[key]; ok {
+		elem.Value = e
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(e)
+
+	for s.lru.Len() > s.opts.Size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*entry).key)
+		s.stats.Evictions++
+	}
+}
+
+// invalidate drops the cached canvases with the given names, called after
+// every change whether it succeeded or not
+func (s *Storage) invalidate(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	for _, name := range names {
+		key := illustrator.CanvasKey(name)
+		if elem, ok := s.entries[key]; ok {
+			s.lru.Remove(elem)
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *Storage) Create(ctx context.Context, canvas *illustrator.CanvasModel) (err error) {
+	defer s.invalidate(canvas.Name)
+	return s.CanvasStorage.Create(ctx, canvas)
+}
+
+func (s *Storage) Update(ctx context.Context, canvas *illustrator.CanvasModel) (newRevision int, err error) {
+	defer s.invalidate(canvas.Name)
+	return s.CanvasStorage.Update(ctx, canvas)
+}
+
+func (s *Storage) Delete(ctx context.Context, name string) (err error) {
+	defer s.invalidate(name)
+	return s.CanvasStorage.Delete(ctx, name)
+}
+
+func (s *Storage) RestoreVersion(ctx context.Context, name string, revision int, version int) (newRevision int, err error) {
+	defer s.invalidate(name)
+	return s.CanvasStorage.RestoreVersion(ctx, name, revision, version)
+}
+
+func (s *Storage) AppendDrawing(ctx context.Context, name string, revision int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	defer s.invalidate(name)
+	return s.CanvasStorage.AppendDrawing(ctx, name, revision, drawing, check)
+}
+
+func (s *Storage) ReplaceDrawing(ctx context.Context, name string, revision int, index int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	defer s.invalidate(name)
+	return s.CanvasStorage.ReplaceDrawing(ctx, name, revision, index, drawing, check)
+}
+
+func (s *Storage) RemoveDrawing(ctx context.Context, name string, revision int, index int,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	defer s.invalidate(name)
+	return s.CanvasStorage.RemoveDrawing(ctx, name, revision, index, check)
+}
+
+func (s *Storage) Batch(ctx context.Context, ops []illustrator.BatchOperation, atomic bool) (results []illustrator.BatchResult,
+	err error) {
+	names := make([]string, 0, len(ops))
+	for i := range ops {
+		names = append(names, ops[i].CanvasName())
+	}
+	defer s.invalidate(names...)
+	return s.CanvasStorage.Batch(ctx, ops, atomic)
+}
+
+func (s *Storage) Clone(ctx context.Context, name string, cloneName string) (err error) {
+	defer s.invalidate(cloneName)
+	return s.CanvasStorage.Clone(ctx, name, cloneName)
+}
+
+func (s *Storage) Rename(ctx context.Context, name string, revision int, newName string) (newRevision int, err error) {
+	defer s.invalidate(name, newName)
+	return s.CanvasStorage.Rename(ctx, name, revision, newName)
+}
+
+func (s *Storage) Undelete(ctx context.Context, name string) (err error) {
+	defer s.invalidate(name)
+	return s.CanvasStorage.Undelete(ctx, name)
+}
+
+func (s *Storage) Purge(ctx context.Context, name string) (err error) {
+	defer s.invalidate(name)
+	return s.CanvasStorage.Purge(ctx, name)
+}
+
+func (s *Storage) Import(ctx context.Context, history *illustrator.CanvasHistory) (err error) {
+	defer s.invalidate(history.Canvas.Name)
+	return s.CanvasStorage.Import(ctx, history)
+}
+
+// WithTx hands fn the storage behind the cache, lookups within a transaction
+// must see its changes. The canvases changed by fn are dropped afterwards.
+func (s *Storage) WithTx(ctx context.Context, fn illustrator.TxFunc) (err error) {
+	changes := new(txStorage)
+	defer func() {
+		s.invalidate(changes.names...)
+	}()
+	return s.CanvasStorage.WithTx(ctx, func(tx illustrator.CanvasStorage) error {
+		changes.CanvasStorage = tx
+		return fn(changes)
+	})
+}
+
+// txStorage records the names of the canvases changed within a transaction,
+// trashed canvases are not cached so purging them is not recorded
+type txStorage struct {
+	illustrator.CanvasStorage
+	names []string
+}
+
+func (t *txStorage) changed(names ...string) {
+	t.names = append(t.names, names...)
+}
+
+func (t *txStorage) Create(ctx context.Context, canvas *illustrator.CanvasModel) (err error) {
+	t.changed(canvas.Name)
+	return t.CanvasStorage.Create(ctx, canvas)
+}
+
+func (t *txStorage) Update(ctx context.Context, canvas *illustrator.CanvasModel) (newRevision int, err error) {
+	t.changed(canvas.Name)
+	return t.CanvasStorage.Update(ctx, canvas)
+}
+
+func (t *txStorage) Delete(ctx context.Context, name string) (err error) {
+	t.changed(name)
+	return t.CanvasStorage.Delete(ctx, name)
+}
+
+func (t *txStorage) RestoreVersion(ctx context.Context, name string, revision int, version int) (newRevision int, err error) {
+	t.changed(name)
+	return t.CanvasStorage.RestoreVersion(ctx, name, revision, version)
+}
+
+func (t *txStorage) AppendDrawing(ctx context.Context, name string, revision int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	t.changed(name)
+	return t.CanvasStorage.AppendDrawing(ctx, name, revision, drawing, check)
+}
+
+func (t *txStorage) ReplaceDrawing(ctx context.Context, name string, revision int, index int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	t.changed(name)
+	return t.CanvasStorage.ReplaceDrawing(ctx, name, revision, index, drawing, check)
+}
+
+func (t *txStorage) RemoveDrawing(ctx context.Context, name string, revision int, index int,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	t.changed(name)
+	return t.CanvasStorage.RemoveDrawing(ctx, name, revision, index, check)
+}
+
+func (t *txStorage) Batch(ctx context.Context, ops []illustrator.BatchOperation, atomic bool) (results []illustrator.BatchResult,
+	err error) {
+	for i := range ops {
+		t.changed(ops[i].CanvasName())
+	}
+	return t.CanvasStorage.Batch(ctx, ops, atomic)
+}
+
+func (t *txStorage) Clone(ctx context.Context, name string, cloneName string) (err error) {
+	t.changed(cloneName)
+	return t.CanvasStorage.Clone(ctx, name, cloneName)
+}
+
+func (t *txStorage) Rename(ctx context.Context, name string, revision int, newName string) (newRevision int, err error) {
+	t.changed(name, newName)
+	return t.CanvasStorage.Rename(ctx, name, revision, newName)
+}
+
+func (t *txStorage) Undelete(ctx context.Context, name string) (err error) {
+	t.changed(name)
+	return t.CanvasStorage.Undelete(ctx, name)
+}
+
+func (t *txStorage) Purge(ctx context.Context, name string) (err error) {
+	t.changed(name)
+	return t.CanvasStorage.Purge(ctx, name)
+}
+
+func (t *txStorage) Import(ctx context.Context, history *illustrator.CanvasHistory) (err error) {
+	t.changed(history.Canvas.Name)
+	return t.CanvasStorage.Import(ctx, history)
+}
+
+// WithTx joins the transaction the storage belongs to, recording the changes
+// of fn as well
+func (t *txStorage) WithTx(ctx context.Context, fn illustrator.TxFunc) (err error) {
+	outer := t.CanvasStorage
+	defer func() {
+		t.CanvasStorage = outer
+	}()
+	return outer.WithTx(ctx, func(tx illustrator.CanvasStorage) error {
+		t.CanvasStorage = tx
+		return fn(t)
+	})
+}
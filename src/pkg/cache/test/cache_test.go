@@ -0,0 +1,231 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/cache"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/memstore"
+	"github.com/stretchr/testify/suite"
+)
+
+// countingStorage counts the lookups reaching the storage behind the cache
+type countingStorage struct {
+	illustrator.CanvasStorage
+	finds int
+}
+
+func (c *countingStorage) FindByName(ctx context.Context, name string) (canvas *illustrator.CanvasModel, err error) {
+	c.finds++
+	return c.CanvasStorage.FindByName(ctx, name)
+}
+
+type CacheSuite struct {
+	suite.Suite
+	backend *countingStorage
+	ctx     context.Context
+}
+
+func TestCacheSuite(t *testing.T) {
+	suite.Run(t, new(CacheSuite))
+}
+
+func (s *CacheSuite) SetupTest() {
+	s.backend = &countingStorage{CanvasStorage: memstore.NewStorage()}
+	s.ctx = context.Background()
+}
+
+func (s *CacheSuite) newCache(opts cache.Options) (c *cache.Storage) {
+	c = cache.NewStorage(s.backend, opts)
+	for _, name := range []string{"first", "second", "third"} {
+		err := c.Create(s.ctx, &illustrator.CanvasModel{Name: name, Width: 5, Height: 5})
+		s.Require().NoError(err)
+	}
+	return
+}
+
+func (s *CacheSuite) TestFindByName() {
+	c := s.newCache(cache.Options{Size: 10})
+
+	canvas, err := c.FindByName(s.ctx, "first")
+	s.NoError(err)
+	canvas.Width = 1
+
+	// Lookups are by key, callers get their own copy
+	canvas, err = c.FindByName(s.ctx, "First")
+	s.NoError(err)
+	s.Equal(5, canvas.Width)
+	s.Equal(1, s.backend.finds)
+
+	// Missing canvases are not cached
+	_, err = c.FindByName(s.ctx, "missing")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	_, err = c.FindByName(s.ctx, "missing")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	s.Equal(cache.Stats{Hits: 1, Misses: 3, Size: 1}, c.Stats())
+}
+
+func (s *CacheSuite) TestEviction() {
+	c := s.newCache(cache.Options{Size: 2})
+
+	for _, name := range []string{"first", "second", "first", "third", "first", "second"} {
+		_, err := c.FindByName(s.ctx, name)
+		s.NoError(err)
+	}
+
+	// The least recently used canvas makes room
+	s.Equal(4, s.backend.finds)
+	s.Equal(cache.Stats{Hits: 2, Misses: 4, Evictions: 2, Size: 2}, c.Stats())
+}
+
+func (s *CacheSuite) TestExpiry() {
+	c := s.newCache(cache.Options{Size: 10, TTL: 10 * time.Millisecond})
+
+	_, err := c.FindByName(s.ctx, "first")
+	s.NoError(err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = c.FindByName(s.ctx, "first")
+	s.NoError(err)
+
+	s.Equal(2, s.backend.finds)
+}
+
+func (s *CacheSuite) TestInvalidation() {
+	c := s.newCache(cache.Options{Size: 10})
+	fill := '#'
+	drawing := illustrator.DrawingModel{Coordinates: []int{0, 0}, Width: 1, Height: 1, Fill: &fill}
+
+	writes := []func() error{
+		func() (err error) {
+			_, err = c.Update(s.ctx, &illustrator.CanvasModel{Name: "first", Width: 7, Height: 7})
+			return
+		},
+		func() (err error) {
+			_, err = c.AppendDrawing(s.ctx, "first", 0, &drawing, nil)
+			return
+		},
+		func() (err error) {
+			_, err = c.Batch(s.ctx, []illustrator.BatchOperation{
+				{Op: illustrator.BatchUpdate, Canvas: &illustrator.CanvasModel{Name: "first", Width: 9, Height: 9}},
+			}, true)
+			return
+		},
+		func() (err error) {
+			_, err = c.RestoreVersion(s.ctx, "first", 0, 1)
+			return
+		},
+	}
+
+	for _, write := range writes {
+		before, err := c.FindByName(s.ctx, "first")
+		s.NoError(err)
+		s.NoError(write())
+
+		after, err := c.FindByName(s.ctx, "first")
+		s.NoError(err)
+		s.Equal(before.Revision+1, after.Revision)
+	}
+
+	err := c.Delete(s.ctx, "first")
+	s.NoError(err)
+	_, err = c.FindByName(s.ctx, "first")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	// Both names of a renamed canvas are dropped
+	_, err = c.FindByName(s.ctx, "second")
+	s.NoError(err)
+	_, err = c.Rename(s.ctx, "second", 0, "renamed")
+	s.NoError(err)
+	_, err = c.FindByName(s.ctx, "second")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+}
+
+func (s *CacheSuite) TestInvalidationWithTx() {
+	c := s.newCache(cache.Options{Size: 10})
+	for _, name := range []string{"first", "second", "third"} {
+		_, err := c.FindByName(s.ctx, name)
+		s.NoError(err)
+	}
+
+	// Lookups within the transaction bypass the cache
+	err := c.WithTx(s.ctx, func(tx illustrator.CanvasStorage) (err error) {
+		canvas, err := tx.FindByName(s.ctx, "first")
+		if err != nil {
+			return
+		}
+		canvas.Width = 7
+		if _, err = tx.Update(s.ctx, canvas); err != nil {
+			return
+		}
+		return tx.WithTx(s.ctx, func(nested illustrator.CanvasStorage) error {
+			return nested.Delete(s.ctx, "third")
+		})
+	})
+	s.NoError(err)
+
+	// Only the canvases changed within the transaction are dropped
+	s.Equal(1, c.Stats().Size)
+	finds := s.backend.finds
+	_, err = c.FindByName(s.ctx, "second")
+	s.NoError(err)
+	s.Equal(finds, s.backend.finds)
+
+	canvas, err := c.FindByName(s.ctx, "first")
+	s.NoError(err)
+	s.Equal(7, canvas.Width)
+	_, err = c.FindByName(s.ctx, "third")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+}
+
+func (s *CacheSuite) TestFindRendered() {
+	c := s.newCache(cache.Options{Size: 10, Rendered: true})
+	var renders int
+	render := func(canvas *illustrator.CanvasModel) (output string) {
+		renders++
+		return canvas.Name
+	}
+
+	for i := 0; i < 3; i++ {
+		canvas, output, err := c.FindRendered(s.ctx, "first", render)
+		s.NoError(err)
+		s.Equal("first", output)
+		s.Equal(1, canvas.Revision)
+	}
+	s.Equal(1, renders)
+
+	// A new revision is rendered again
+	_, err := c.Update(s.ctx, &illustrator.CanvasModel{Name: "first", Width: 7, Height: 7})
+	s.NoError(err)
+	canvas, _, err := c.FindRendered(s.ctx, "first", render)
+	s.NoError(err)
+	s.Equal(2, canvas.Revision)
+	s.Equal(2, renders)
+
+	stats := c.Stats()
+	s.Equal(uint64(2), stats.RenderHits)
+	s.Equal(uint64(2), stats.RenderMisses)
+
+	_, _, err = c.FindRendered(s.ctx, "missing", render)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.Equal(2, renders)
+}
+
+func (s *CacheSuite) TestFindRenderedDisabled() {
+	c := s.newCache(cache.Options{Size: 10})
+	var renders int
+	render := func(canvas *illustrator.CanvasModel) (output string) {
+		renders++
+		return canvas.Name
+	}
+
+	for i := 0; i < 2; i++ {
+		_, _, err := c.FindRendered(s.ctx, "first", render)
+		s.NoError(err)
+	}
+	s.Equal(2, renders)
+	s.Equal(1, s.backend.finds)
+}
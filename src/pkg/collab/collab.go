@@ -0,0 +1,216 @@
+package collab
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/sketch-home-task/src/pkg/hub"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+const (
+	// Number of messages queued for a client, clients not keeping up are
+	// disconnected and resume once reconnected
+	clientBuffer int = 64
+	// Number of operations kept per canvas for clients resuming a session,
+	// clients further behind get a snapshot. The operations missed are queued
+	// at once, so they must fit in the buffer of the client.
+	resumeLogSize int = clientBuffer
+	// Operations of ended sessions are kept for clients reconnecting later, for
+	// a while and for as many canvases
+	resumeLogAge      time.Duration = 10 * time.Minute
+	resumeLogCanvases int           = 1024
+)
+
+type OpType string
+
+const (
+	OpAppend  OpType = "append"
+	OpReplace OpType = "replace"
+	OpRemove  OpType = "remove"
+)
+
+// Op is a drawing operation sent by a client
+type Op struct {
+	// Chosen by the client to recognize the broadcast or rejection of the operation
+	ID      string                    `json:"id,omitempty"`
+	Op      OpType                    `json:"op"`
+	Index   int                       `json:"index,omitempty"`
+	Drawing *illustrator.DrawingModel `json:"drawing,omitempty"`
+	// Revision the operation was made on, it is rejected if the canvas changed
+	// since. Zero applies it to the latest revision.
+	Revision int `json:"revision,omitempty"`
+}
+
+type MessageType string
+
+const (
+	// An operation was applied, resulting in the revision of the message
+	MessageOp MessageType = "op"
+	// The whole canvas, sent when clients cannot follow by operations
+	MessageSnapshot MessageType = "snapshot"
+	// An operation of the client was rejected
+	MessageError MessageType = "error"
+	// The canvas was renamed, clients reconnect by the new name
+	MessageRename MessageType = "rename"
+	// The canvas was deleted
+	MessageDelete MessageType = "delete"
+)
+
+// Message is sent by the server, in the order the changes were applied
+type Message struct {
+	Type MessageType `json:"type"`
+	// Revision of the canvas after the change
+	Revision int `json:"revision,omitempty"`
+	// Operation applied and who applied it, for op messages
+	Op    *Op    `json:"op,omitempty"`
+	Actor string `json:"actor,omitempty"`
+	// Canvas of snapshots
+	Canvas *illustrator.CanvasModel `json:"canvas,omitempty"`
+	// New name of renamed canvases
+	Name string `json:"name,omitempty"`
+	// ID of the rejected operation and why, for error messages
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PublishFunc tells others about a change applied by a session, such as the
+// viewers of the canvas
+type PublishFunc func(ctx context.Context, name string)
+
+// Manager runs the editing sessions of canvases. The operations on a canvas
+// are applied one at a time by its session, which defines their order, and
+// broadcast to all clients of the session.
+type Manager struct {
+	storage   illustrator.CanvasStorage
+	hub       *hub.Hub
+	validator *validator.Validate
+	publish   PublishFunc
+
+	mu sync.Mutex
+	// Sessions by canvas key, running while they have clients
+	rooms map[string]*room
+	// Operations of ended sessions by canvas key
+	logs map[string]*keptLog
+}
+
+// keptLog holds the operations of an ended session, leading up to the canvas
+// as it was when the session ended
+type keptLog struct {
+	canvas *illustrator.CanvasModel
+	log    []Message
+	kept   time.Time
+}
+
+// NewManager runs sessions on the canvases of the storage. Changes made
+// outside of the sessions are learned from the hub, changes made by the
+// sessions are passed to publish, unless nil.
+func NewManager(storage illustrator.CanvasStorage, hub *hub.Hub, validator *validator.Validate,
+	publish PublishFunc) (m *Manager) {
+	return &Manager{
+		storage:   storage,
+		hub:       hub,
+		validator: validator,
+		publish:   publish,
+		rooms:     make(map[string]*room),
+		logs:      make(map[string]*keptLog),
+	}
+}
+
+// Client is connected to the session of a canvas until it leaves
+type Client struct {
+	// Messages of the session, closed when the client is disconnected by the
+	// session
+	Messages <-chan Message
+
+	ctx  context.Context
+	send chan Message
+	room *room
+}
+
+// Join connects a client to the session of the canvas. It gets the operations
+// applied after the given revision, or a snapshot of the canvas when they are
+// not known anymore or the revision is zero. Changes are made as the actor of
+// the context.
+func (m *Manager) Join(ctx context.Context, name string, revision int) (client *Client) {
+	key := illustrator.CanvasKey(name)
+
+	m.mu.Lock()
+	r, ok := m.rooms[key]
+	if !ok {
+		r = newRoom(m, name)
+		r.kept = m.takeLog(key)
+		m.rooms[key] = r
+		go r.run()
+	}
+	r.refs++
+	m.mu.Unlock()
+
+	send := make(chan Message, clientBuffer)
+	client = &Client{Messages: send, ctx: ctx, send: send, room: r}
+	r.join <- joinRequest{client: client, revision: revision}
+	return
+}
+
+// Submit passes an operation to the session, the outcome is told by a message
+func (c *Client) Submit(op Op) {
+	c.room.ops <- submission{client: c, op: op}
+}
+
+// Leave disconnects the client, the session ends with its last client
+func (c *Client) Leave() {
+	r := c.room
+	r.leave <- c
+
+	r.manager.mu.Lock()
+	defer r.manager.mu.Unlock()
+
+	r.refs--
+	if r.refs == 0 {
+		delete(r.manager.rooms, r.key)
+		close(r.done)
+		// The state of the room is ours once it stopped
+		<-r.stopped
+		r.manager.keepLog(r)
+	}
+}
+
+// keepLog keeps the operations of the ended session, dropping the logs kept
+// too long or beyond the number of canvases
+func (m *Manager) keepLog(r *room) {
+	now := time.Now()
+	for key, kept := range m.logs {
+		if now.Sub(kept.kept) > resumeLogAge {
+			delete(m.logs, key)
+		}
+	}
+	if r.canvas == nil || len(r.log) == 0 {
+		return
+	}
+
+	for len(m.logs) >= resumeLogCanvases {
+		var oldest string
+		for key, kept := range m.logs {
+			if oldest == "" || kept.kept.Before(m.logs[oldest].kept) {
+				oldest = key
+			}
+		}
+		delete(m.logs, oldest)
+	}
+	m.logs[r.key] = &keptLog{canvas: r.canvas, log: r.log, kept: now}
+}
+
+// takeLog hands the operations kept for the canvas to a new session
+func (m *Manager) takeLog(key string) (kept *keptLog) {
+	kept, ok := m.logs[key]
+	if !ok {
+		return nil
+	}
+	delete(m.logs, key)
+	if time.Since(kept.kept) > resumeLogAge {
+		return nil
+	}
+	return
+}
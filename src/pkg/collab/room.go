@@ -0,0 +1,308 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/go-playground/validator"
+	"github.com/sketch-home-task/src/pkg/hub"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// errInvalidOp rejects malformed operations
+var errInvalidOp = errors.New("invalid operation")
+
+type joinRequest struct {
+	client   *Client
+	revision int
+}
+
+type submission struct {
+	client *Client
+	op     Op
+	// Why the message of the client could not be read as operation
+	err error
+}
+
+// room is the session of a canvas. Its state is only touched by its own
+// goroutine, clients talk to it by channels.
+type room struct {
+	manager *Manager
+	name    string
+	key     string
+	// Number of clients joined and not left, guarded by the manager
+	refs int
+
+	join  chan joinRequest
+	leave chan *Client
+	ops   chan submission
+	done  chan struct{}
+	// Closed once the room stopped running
+	stopped chan struct{}
+	// Changes made outside of the session
+	changes *hub.Subscription
+
+	clients map[*Client]struct{}
+	// Latest canvas known, nil until loaded
+	canvas *illustrator.CanvasModel
+	// Operations leading up to the revision of the canvas, oldest first
+	log []Message
+	// Operations of the previous session, until the canvas is loaded
+	kept *keptLog
+}
+
+func newRoom(m *Manager, name string) (r *room) {
+	return &room{
+		manager: m,
+		name:    name,
+		key:     illustrator.CanvasKey(name),
+		join:    make(chan joinRequest),
+		leave:   make(chan *Client),
+		ops:     make(chan submission),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		// Subscribed before the canvas is loaded, so no change goes unseen
+		changes: m.hub.Subscribe(name),
+		clients: make(map[*Client]struct{}),
+	}
+}
+
+func (r *room) run() {
+	defer close(r.stopped)
+	defer r.changes.Close()
+
+	for {
+		select {
+		case req := <-r.join:
+			r.clients[req.client] = struct{}{}
+			r.resume(req.client, req.revision)
+		case client := <-r.leave:
+			r.disconnect(client)
+		case sub := <-r.ops:
+			if _, ok := r.clients[sub.client]; ok {
+				r.apply(sub)
+			}
+		case event := <-r.changes.C:
+			r.sync(event)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// resume catches the client up from the given revision
+func (r *room) resume(client *Client, revision int) {
+	if r.canvas == nil {
+		canvas, err := r.manager.storage.FindByName(client.ctx, r.name)
+		if err != nil {
+			r.send(client, Message{Type: MessageError, Error: describeError(err)})
+			r.disconnect(client)
+			return
+		}
+		r.canvas = canvas
+
+		// The operations of the previous session lead up to the canvas unless
+		// it changed since
+		if kept := r.kept; kept != nil && sameContent(kept.canvas, canvas) {
+			r.log = kept.log
+		}
+		r.kept = nil
+	}
+
+	current := r.canvas.Revision
+	if revision <= 0 || revision > current || revision < current-len(r.log) {
+		r.send(client, r.snapshot())
+		return
+	}
+	for _, msg := range r.log[len(r.log)-(current-revision):] {
+		r.send(client, msg)
+	}
+}
+
+// apply validates the operation and applies it to the latest revision of the
+// canvas, or rejects it when the canvas changed since the revision of the
+// operation
+func (r *room) apply(sub submission) {
+	op := sub.op
+	reject := func(err error) {
+		r.send(sub.client, Message{Type: MessageError, ID: op.ID, Error: describeError(err)})
+	}
+
+	if sub.err != nil {
+		reject(sub.err)
+		return
+	}
+	if err := r.validate(&op); err != nil {
+		reject(err)
+		return
+	}
+
+	storage, ctx := r.manager.storage, sub.client.ctx
+	var canvas *illustrator.CanvasModel
+	var err error
+	switch op.Op {
+	case OpAppend:
+		canvas, err = storage.AppendDrawing(ctx, r.name, op.Revision, op.Drawing, r.check)
+	case OpReplace:
+		canvas, err = storage.ReplaceDrawing(ctx, r.name, op.Revision, op.Index, op.Drawing, r.check)
+	case OpRemove:
+		canvas, err = storage.RemoveDrawing(ctx, r.name, op.Revision, op.Index, r.check)
+	}
+	if errors.Is(err, illustrator.ErrCanvasNotFound) {
+		r.close(Message{Type: MessageDelete})
+		return
+	}
+	if err != nil {
+		reject(err)
+		return
+	}
+
+	op.Revision = 0
+	msg := Message{Type: MessageOp, Revision: canvas.Revision, Op: &op, Actor: illustrator.ActorFromContext(ctx).Name}
+	r.advance(canvas, &msg)
+
+	if r.manager.publish != nil {
+		r.manager.publish(ctx, r.name)
+	}
+}
+
+// advance broadcasts the change to the given canvas by the operation, unless
+// changes were made in between which the clients cannot follow by operations
+func (r *room) advance(canvas *illustrator.CanvasModel, msg *Message) {
+	follows := msg != nil && canvas.Revision == r.canvas.Revision+1
+	r.canvas = canvas
+
+	if !follows {
+		r.log = nil
+		r.broadcast(r.snapshot())
+		return
+	}
+
+	r.log = append(r.log, *msg)
+	if len(r.log) > resumeLogSize {
+		r.log = append([]Message(nil), r.log[len(r.log)-resumeLogSize:]...)
+	}
+	r.broadcast(*msg)
+}
+
+// sync follows the changes made outside of the session
+func (r *room) sync(event hub.Event) {
+	if len(r.clients) == 0 || r.canvas == nil {
+		return
+	}
+
+	switch event.Type {
+	case hub.EventRename:
+		r.close(Message{Type: MessageRename, Revision: event.Revision, Name: event.Name})
+	case hub.EventDelete:
+		r.close(Message{Type: MessageDelete})
+	case hub.EventUpdate:
+		// Changes of the session are seen again
+		if event.Revision <= r.canvas.Revision {
+			return
+		}
+		canvas, err := r.manager.storage.FindByName(context.Background(), r.name)
+		if errors.Is(err, illustrator.ErrCanvasNotFound) {
+			r.close(Message{Type: MessageDelete})
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] failed to reload canvas '%s' of editing session: %v\n", r.name, err)
+			return
+		}
+		if canvas.Revision > r.canvas.Revision {
+			r.advance(canvas, nil)
+		}
+	}
+}
+
+func (r *room) validate(op *Op) (err error) {
+	switch op.Op {
+	case OpAppend, OpReplace:
+		if op.Drawing == nil {
+			return fmt.Errorf("%w: drawing required for %s operations", errInvalidOp, op.Op)
+		}
+		return r.manager.validator.Struct(op.Drawing)
+	case OpRemove:
+		return
+	default:
+		return fmt.Errorf("%w: operation must be append, replace or remove", errInvalidOp)
+	}
+}
+
+// check revalidates the canvas after one of its drawings changed
+func (r *room) check(canvas *illustrator.CanvasModel) (err error) {
+	return r.manager.validator.Struct(canvas)
+}
+
+func (r *room) snapshot() (msg Message) {
+	return Message{Type: MessageSnapshot, Revision: r.canvas.Revision, Canvas: r.canvas.Clone()}
+}
+
+func (r *room) broadcast(msg Message) {
+	for client := range r.clients {
+		r.send(client, msg)
+	}
+}
+
+// send queues the message for the client, disconnecting clients not keeping up
+func (r *room) send(client *Client, msg Message) {
+	if _, ok := r.clients[client]; !ok {
+		return
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+		log.Printf("[INFO] disconnected editing client of canvas '%s' not keeping up\n", r.name)
+		r.disconnect(client)
+	}
+}
+
+// close sends the final message and disconnects all clients, the canvas is
+// loaded again by the clients joining later
+func (r *room) close(msg Message) {
+	r.broadcast(msg)
+	for client := range r.clients {
+		r.disconnect(client)
+	}
+	r.canvas = nil
+	r.log = nil
+}
+
+func (r *room) disconnect(client *Client) {
+	if _, ok := r.clients[client]; ok {
+		delete(r.clients, client)
+		close(client.send)
+	}
+}
+
+// sameContent tells whether both canvases are at the same revision with the
+// same content, so operations leading up to one lead up to the other
+func sameContent(a, b *illustrator.CanvasModel) (same bool) {
+	return a.Revision == b.Revision && a.Width == b.Width && a.Height == b.Height &&
+		illustrator.DiffDrawings(a.Drawings, b.Drawings) == illustrator.DrawingsDiff{}
+}
+
+// describeError tells the client why an operation was rejected, the same way
+// as the drawing end points do
+func describeError(err error) (msg string) {
+	var validationErr validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErr), errors.Is(err, errInvalidOp):
+		return err.Error()
+	case errors.Is(err, illustrator.ErrCanvasNotFound):
+		return "canvas not found"
+	case errors.Is(err, illustrator.ErrDrawingNotFound):
+		return "drawing not found"
+	case errors.Is(err, illustrator.ErrConflict):
+		return "canvas was modified, revision does not match"
+	case errors.Is(err, illustrator.ErrTimeout):
+		return "storage timed out"
+	default:
+		log.Printf("[ERROR] failed to apply editing operation: %v\n", err)
+		return "failed to modify canvas drawings"
+	}
+}
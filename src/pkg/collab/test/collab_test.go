@@ -0,0 +1,300 @@
+package collab_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/websocket"
+	"github.com/sketch-home-task/src/pkg/collab"
+	"github.com/sketch-home-task/src/pkg/hub"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/memstore"
+	"github.com/sketch-home-task/src/pkg/router"
+	"github.com/stretchr/testify/suite"
+)
+
+type CollabSuite struct {
+	suite.Suite
+	ctx     context.Context
+	storage illustrator.CanvasStorage
+	hub     *hub.Hub
+	manager *collab.Manager
+	server  *httptest.Server
+
+	mu        sync.Mutex
+	published []string
+}
+
+func TestCollabSuite(t *testing.T) {
+	suite.Run(t, new(CollabSuite))
+}
+
+func (s *CollabSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.storage = memstore.NewStorage()
+	s.hub = hub.NewHub()
+	s.mu.Lock()
+	s.published = nil
+	s.mu.Unlock()
+
+	v := validator.New()
+	illustrator.RegisterValidation(v)
+	s.manager = collab.NewManager(s.storage, s.hub, v, func(ctx context.Context, name string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.published = append(s.published, name)
+	})
+
+	r := router.NewRouter(v, "")
+	r.GETRaw("/canvas/{name:[a-z]{1,25}}/ws", func(w http.ResponseWriter, req *http.Request) {
+		revision, _ := strconv.Atoi(req.URL.Query().Get("revision"))
+		s.manager.ServeWebSocket(w, req, router.Vars(req)["name"], revision)
+	})
+	s.server = httptest.NewServer(r)
+
+	s.Require().NoError(s.storage.Create(s.ctx, &illustrator.CanvasModel{Name: "MonaLisa", Width: 10, Height: 10}))
+}
+
+func (s *CollabSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *CollabSuite) dial(name string, revision int) (conn *websocket.Conn) {
+	url := "ws" + strings.TrimPrefix(s.server.URL, "http") + "/canvas/" + name + "/ws?revision=" + strconv.Itoa(revision)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	s.Require().NoError(err)
+	return
+}
+
+func (s *CollabSuite) read(conn *websocket.Conn) (msg collab.Message) {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	s.Require().NoError(conn.ReadJSON(&msg))
+	return
+}
+
+func drawing(x int) *illustrator.DrawingModel {
+	fill := '*'
+	return &illustrator.DrawingModel{Coordinates: []int{x, x}, Width: 2, Height: 2, Fill: &fill}
+}
+
+func (s *CollabSuite) TestEdit() {
+	first, second := s.dial("monalisa", 0), s.dial("monalisa", 0)
+	defer first.Close()
+	defer second.Close()
+
+	// Clients joining without revision get the canvas
+	for _, conn := range []*websocket.Conn{first, second} {
+		msg := s.read(conn)
+		s.Equal(collab.MessageSnapshot, msg.Type)
+		s.Equal(1, msg.Revision)
+		s.Equal("MonaLisa", msg.Canvas.Name)
+	}
+
+	// Operations are broadcast to all clients, including the one which sent it
+	s.NoError(first.WriteJSON(collab.Op{ID: "a1", Op: collab.OpAppend, Drawing: drawing(1)}))
+	for _, conn := range []*websocket.Conn{first, second} {
+		msg := s.read(conn)
+		s.Equal(collab.MessageOp, msg.Type)
+		s.Equal(2, msg.Revision)
+		s.Equal("a1", msg.Op.ID)
+		s.Equal(illustrator.SystemActor, msg.Actor)
+	}
+
+	s.NoError(second.WriteJSON(collab.Op{ID: "b1", Op: collab.OpAppend, Drawing: drawing(2), Revision: 2}))
+	for _, conn := range []*websocket.Conn{first, second} {
+		msg := s.read(conn)
+		s.Equal(3, msg.Revision)
+		s.Equal("b1", msg.Op.ID)
+		s.Equal(0, msg.Op.Revision)
+	}
+
+	// Operations sent at once are applied one after the other
+	s.NoError(first.WriteJSON(collab.Op{ID: "a2", Op: collab.OpAppend, Drawing: drawing(3)}))
+	s.NoError(second.WriteJSON(collab.Op{ID: "b2", Op: collab.OpRemove, Index: 0}))
+	for _, conn := range []*websocket.Conn{first, second} {
+		s.Equal(4, s.read(conn).Revision)
+		s.Equal(5, s.read(conn).Revision)
+	}
+
+	// The operations are persisted
+	canvas, err := s.storage.FindByName(s.ctx, "monalisa")
+	s.NoError(err)
+	s.Equal(5, canvas.Revision)
+	s.Len(canvas.Drawings, 2)
+	s.mu.Lock()
+	s.Equal([]string{"monalisa", "monalisa", "monalisa", "monalisa"}, s.published)
+	s.mu.Unlock()
+}
+
+func (s *CollabSuite) TestReject() {
+	first, second := s.dial("monalisa", 0), s.dial("monalisa", 0)
+	defer first.Close()
+	defer second.Close()
+	s.read(first)
+	s.read(second)
+
+	invalid := drawing(1)
+	invalid.Fill = nil
+	ops := []collab.Op{
+		{ID: "invalid", Op: collab.OpAppend, Drawing: invalid},
+		{ID: "missing", Op: collab.OpReplace},
+		{ID: "unknown", Op: "fill"},
+		{ID: "stale", Op: collab.OpAppend, Drawing: drawing(1), Revision: 7},
+		{ID: "index", Op: collab.OpRemove, Index: 3},
+	}
+	for _, op := range ops {
+		s.NoError(first.WriteJSON(op))
+	}
+	s.NoError(first.WriteMessage(websocket.TextMessage, []byte(`{"op": `)))
+
+	// Only the client of the operation is told
+	errors := map[string]string{}
+	for range ops {
+		msg := s.read(first)
+		s.Equal(collab.MessageError, msg.Type)
+		errors[msg.ID] = msg.Error
+	}
+	s.Contains(errors["invalid"], "Fill/Outline")
+	s.Contains(errors["missing"], "drawing required")
+	s.Contains(errors["unknown"], "operation must be")
+	s.Equal("canvas was modified, revision does not match", errors["stale"])
+	s.Equal("drawing not found", errors["index"])
+	msg := s.read(first)
+	s.Equal(collab.MessageError, msg.Type)
+	s.Contains(msg.Error, "invalid operation")
+
+	s.NoError(second.WriteJSON(collab.Op{ID: "b1", Op: collab.OpAppend, Drawing: drawing(1)}))
+	s.Equal("b1", s.read(first).Op.ID)
+	s.Equal("b1", s.read(second).Op.ID)
+}
+
+func (s *CollabSuite) TestResume() {
+	first := s.dial("monalisa", 0)
+	defer first.Close()
+	s.read(first)
+
+	for i := 1; i <= 3; i++ {
+		s.NoError(first.WriteJSON(collab.Op{Op: collab.OpAppend, Drawing: drawing(i)}))
+		s.Equal(i+1, s.read(first).Revision)
+	}
+
+	// A client reconnecting gets the operations it missed
+	resumed := s.dial("monalisa", 2)
+	defer resumed.Close()
+	for _, revision := range []int{3, 4} {
+		msg := s.read(resumed)
+		s.Equal(collab.MessageOp, msg.Type)
+		s.Equal(revision, msg.Revision)
+	}
+
+	// Clients up to date get nothing but the next operation
+	current := s.dial("monalisa", 4)
+	defer current.Close()
+	s.NoError(first.WriteJSON(collab.Op{Op: collab.OpRemove}))
+	s.Equal(5, s.read(current).Revision)
+
+	// Unknown revisions get the canvas
+	ahead := s.dial("monalisa", 9)
+	defer ahead.Close()
+	msg := s.read(ahead)
+	s.Equal(collab.MessageSnapshot, msg.Type)
+	s.Equal(5, msg.Revision)
+	s.Len(msg.Canvas.Drawings, 2)
+}
+
+func (s *CollabSuite) TestResumeFarBehind() {
+	conn := s.dial("monalisa", 0)
+	defer conn.Close()
+	s.read(conn)
+
+	for i := 1; i <= 70; i++ {
+		s.NoError(conn.WriteJSON(collab.Op{Op: collab.OpAppend, Drawing: drawing(1)}))
+		s.Equal(i+1, s.read(conn).Revision)
+	}
+
+	// As many operations as a client buffers are replayed
+	resumed := s.dial("monalisa", 7)
+	defer resumed.Close()
+	for revision := 8; revision <= 71; revision++ {
+		msg := s.read(resumed)
+		s.Equal(collab.MessageOp, msg.Type)
+		s.Equal(revision, msg.Revision)
+	}
+
+	// Clients further behind get the canvas instead of being dropped
+	behind := s.dial("monalisa", 2)
+	defer behind.Close()
+	msg := s.read(behind)
+	s.Equal(collab.MessageSnapshot, msg.Type)
+	s.Equal(71, msg.Revision)
+	s.Len(msg.Canvas.Drawings, 70)
+}
+
+func (s *CollabSuite) TestResumeAlone() {
+	client := s.manager.Join(s.ctx, "monalisa", 0)
+	s.Equal(collab.MessageSnapshot, (<-client.Messages).Type)
+	for i := 1; i <= 3; i++ {
+		client.Submit(collab.Op{Op: collab.OpAppend, Drawing: drawing(i)})
+		s.Equal(i+1, (<-client.Messages).Revision)
+	}
+	client.Leave()
+
+	// The operations outlive the session of the only client
+	client = s.manager.Join(s.ctx, "monalisa", 2)
+	for _, revision := range []int{3, 4} {
+		msg := <-client.Messages
+		s.Equal(collab.MessageOp, msg.Type)
+		s.Equal(revision, msg.Revision)
+	}
+	client.Leave()
+
+	// Unless the canvas changed while no session ran
+	canvas := illustrator.CanvasModel{Name: "MonaLisa", Width: 10, Height: 10}
+	_, err := s.storage.Update(s.ctx, &canvas)
+	s.NoError(err)
+	client = s.manager.Join(s.ctx, "monalisa", 2)
+	defer client.Leave()
+	msg := <-client.Messages
+	s.Equal(collab.MessageSnapshot, msg.Type)
+	s.Equal(5, msg.Revision)
+}
+
+func (s *CollabSuite) TestExternalChanges() {
+	conn := s.dial("monalisa", 0)
+	defer conn.Close()
+	s.read(conn)
+
+	// Changes made outside of the session are sent as snapshot
+	canvas := illustrator.CanvasModel{Name: "MonaLisa", Width: 10, Height: 10,
+		Drawings: illustrator.DrawingSlice{*drawing(1)}}
+	revision, err := s.storage.Update(s.ctx, &canvas)
+	s.NoError(err)
+	s.hub.Publish("monalisa", hub.Event{Type: hub.EventUpdate, Revision: revision})
+	msg := s.read(conn)
+	s.Equal(collab.MessageSnapshot, msg.Type)
+	s.Equal(2, msg.Revision)
+	s.Len(msg.Canvas.Drawings, 1)
+
+	// The session ends with the canvas
+	s.NoError(s.storage.Delete(s.ctx, "monalisa"))
+	s.hub.Publish("monalisa", hub.Event{Type: hub.EventDelete})
+	s.Equal(collab.MessageDelete, s.read(conn).Type)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	s.True(websocket.IsCloseError(err, websocket.CloseNormalClosure))
+}
+
+func (s *CollabSuite) TestUnknownCanvas() {
+	url := "ws" + strings.TrimPrefix(s.server.URL, "http") + "/canvas/scream/ws"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	s.Error(err)
+	s.Require().NotNil(resp)
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,109 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+const (
+	// Max. size of a message sent by a client
+	maxMessageSize int64 = 64 * 1024
+	// Time to write a message to a client
+	writeWait time.Duration = 10 * time.Second
+	// Time a client is given to answer a ping, pings are sent more often
+	pongWait   time.Duration = 60 * time.Second
+	pingPeriod time.Duration = pongWait * 9 / 10
+)
+
+// Connections are only accepted from pages of the same origin
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// ServeWebSocket upgrades the request to a WebSocket connection joining the
+// session of the canvas, resuming after the given revision. Clients send
+// operations and receive messages as JSON text messages.
+func (m *Manager) ServeWebSocket(w http.ResponseWriter, req *http.Request, name string, revision int) {
+	// Unknown canvases are rejected before upgrading
+	if _, err := m.storage.FindByName(req.Context(), name); err != nil {
+		if errors.Is(err, illustrator.ErrCanvasNotFound) {
+			http.Error(w, "canvas not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "failed to retrieve canvas", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// The upgrader responded already
+		return
+	}
+
+	client := m.Join(req.Context(), name, revision)
+	go writeMessages(conn, client)
+	readOps(conn, client)
+	client.Leave()
+}
+
+// readOps submits the operations of the connection until it is closed
+func readOps(conn *websocket.Conn, client *Client) {
+	defer conn.Close()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var op Op
+		if err = json.Unmarshal(data, &op); err != nil {
+			// Rejected by the session, so the error is ordered with the other messages
+			client.room.ops <- submission{client: client, err: fmt.Errorf("%w: %v", errInvalidOp, err)}
+			continue
+		}
+		client.Submit(op)
+	}
+}
+
+// writeMessages writes the messages of the session to the connection, closing
+// it once the session disconnected the client
+func writeMessages(conn *websocket.Conn, client *Client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client.Messages:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// recordChange records a change of the canvas content as a new version and in
+// the audit log, together with the drawings it changed
+func (s *Storage) recordChange(ctx context.Context, tx *sql.Tx, name string, action illustrator.AuditAction,
+	diff illustrator.DrawingsDiff) (err error) {
+	if err = s.recordVersion(ctx, tx, name); err != nil {
+		return
+	}
+	return recordAudit(ctx, tx, name, illustrator.AuditEntry{Action: action, Diff: &diff})
+}
+
+// recordAudit records a change of the canvas made by the actor of the context
+// in the audit log and as change event in the outbox. The name, revision and
+// time of the entry are taken from the changed canvas.
+func recordAudit(ctx context.Context, tx *sql.Tx, name string, entry illustrator.AuditEntry) (err error) {
+	actor := illustrator.ActorFromContext(ctx)
+	previousName := sql.NullString{String: entry.PreviousName, Valid: entry.PreviousName != ""}
+
+	_, err = execPrepared(ctx, tx, "WITH entry AS ("+
+		"INSERT INTO canvas_audit (canvas_id, action, name, previous_name, actor, request_id, revision, diff) "+
+		"SELECT canvas_id, $2, COALESCE(display_name, name), $3, $4, $5, revision, $6 FROM canvas WHERE name_hash = $1 "+
+		"RETURNING action, name, previous_name, revision, actor, request_id, created_at) "+
+		"INSERT INTO canvas_outbox (action, name, previous_name, revision, actor, request_id, occurred_at) "+
+		"SELECT action, name, previous_name, revision, actor, request_id, created_at FROM entry",
+		illustrator.CanvasKeyHash(name), string(entry.Action), previousName, actor.Name, actor.RequestID, entry.Diff)
+	return
+}
+
+// ListAudit returns the audit log of the canvas, oldest change first. Once no
+// canvas holds the name, the audit log of the canvas last purged under it is
+// returned. Canvases stored before changes were audited may have none.
+func (s *Storage) ListAudit(ctx context.Context, name string) (entries []illustrator.AuditEntry, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	canvasID, err := s.auditedCanvas(ctx, name)
+	if err != nil {
+		return
+	}
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT action, name, previous_name, actor, request_id, revision, diff, "+
+		"created_at FROM canvas_audit WHERE canvas_id = $1 ORDER BY audit_id", canvasID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	entries = []illustrator.AuditEntry{}
+	for rows.Next() {
+		var entry illustrator.AuditEntry
+		var previousName sql.NullString
+		err = rows.Scan(&entry.Action, &entry.Name, &previousName, &entry.Actor, &entry.RequestID, &entry.Revision,
+			&entry.Diff, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.PreviousName = previousName.String
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// auditedCanvas returns the ID of the canvas holding the name, or of the
+// canvas last purged under it. Canvases in the trash are not found.
+func (s *Storage) auditedCanvas(ctx context.Context, name string) (canvasID int64, err error) {
+	var trashed bool
+	err = s.conn().QueryRowContext(ctx, "SELECT canvas_id, deleted_at IS NOT NULL FROM canvas WHERE name_hash = $1",
+		illustrator.CanvasKeyHash(name)).
+		Scan(&canvasID, &trashed)
+	if err == nil && trashed {
+		return 0, illustrator.ErrCanvasNotFound
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	// The action is spelled out for the partial index on purges to apply
+	err = s.conn().QueryRowContext(ctx, "SELECT canvas_id FROM canvas_audit "+
+		"WHERE action = '"+string(illustrator.AuditPurge)+"' AND lower(btrim(name)) = $1 ORDER BY audit_id DESC LIMIT 1",
+		illustrator.CanvasKey(name)).
+		Scan(&canvasID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = illustrator.ErrCanvasNotFound
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Batch runs the operations in a single transaction. Operations of batches
+// which are not atomic run within a savepoint each, so a failing operation
+// is rolled back without aborting the transaction.
+func (s *Storage) Batch(ctx context.Context, ops []illustrator.BatchOperation, atomic bool) (results []illustrator.BatchResult,
+	err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		results = make([]illustrator.BatchResult, 0, len(ops))
+		for i := range ops {
+			if !atomic {
+				if _, err = tx.ExecContext(ctx, "SAVEPOINT batch_operation"); err != nil {
+					return
+				}
+			}
+
+			opErr := s.runBatchOperation(ctx, tx, &ops[i])
+			result := illustrator.NewBatchResult(i, &ops[i], translateError(opErr))
+			results = append(results, result)
+
+			if atomic {
+				if result.Failed() {
+					return illustrator.ErrBatchAborted
+				}
+				continue
+			}
+
+			if opErr != nil {
+				_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_operation")
+			} else {
+				_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_operation")
+			}
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err == illustrator.ErrBatchAborted {
+		results = illustrator.AbortBatch(ops, results)
+	} else if err != nil {
+		results = nil
+	}
+	return
+}
+
+func (s *Storage) runBatchOperation(ctx context.Context, tx *sql.Tx, op *illustrator.BatchOperation) (err error) {
+	switch op.Op {
+	case illustrator.BatchCreate:
+		return s.create(ctx, tx, op.Canvas)
+	case illustrator.BatchUpdate:
+		_, err = s.update(ctx, tx, op.Canvas)
+		return
+	case illustrator.BatchDelete:
+		return remove(ctx, tx, op.Name)
+	default:
+		return fmt.Errorf("unknown batch operation '%s'", op.Op)
+	}
+}
@@ -0,0 +1,147 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+const (
+	// Wait before connecting again when the database is not up yet, doubled
+	// with every attempt up to maxConnectBackoff
+	initialConnectBackoff time.Duration = 100 * time.Millisecond
+	maxConnectBackoff     time.Duration = 5 * time.Second
+)
+
+// ConnConfig holds the connection parameters of Postgres
+type ConnConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+	// SSL mode of the connections, "disable" when not set
+	SSLMode string
+	// Name the connections report to the server, e.g. in pg_stat_activity
+	ApplicationName string
+}
+
+// DSN returns the connection string of the configuration, in the key/value
+// format of lib/pq. Empty parameters are left out.
+func (c ConnConfig) DSN() (dsn string) {
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	var params []string
+	for _, param := range []struct{ key, value string }{
+		{"host", c.Host},
+		{"port", c.Port},
+		{"user", c.User},
+		{"password", c.Password},
+		{"dbname", c.Database},
+		{"sslmode", sslMode},
+		{"application_name", c.ApplicationName},
+	} {
+		if param.value != "" {
+			params = append(params, param.key+"="+quoteDSNValue(param.value))
+		}
+	}
+	return strings.Join(params, " ")
+}
+
+// quoteDSNValue quotes values holding spaces, quotes or backslashes, escaping
+// the latter two
+func quoteDSNValue(value string) (quoted string) {
+	if !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
+// PoolConfig sizes the connection pool, zero values keep the defaults of
+// database/sql
+type PoolConfig struct {
+	MaxOpenConns int
+	MaxIdleConns int
+	// Time after which connections are replaced
+	ConnMaxLifetime time.Duration
+	// Time after which idle connections are closed
+	ConnMaxIdleTime time.Duration
+}
+
+// Options configure the storage created by NewStorage
+type Options struct {
+	Pool PoolConfig
+	// Layout of the drawings, the JSONB layout when not set
+	Layout DrawingsLayout
+	// Time limit of every storage operation, zero for no limit
+	Timeout time.Duration
+	// Time the database is waited for on startup, zero to try once
+	StartupTimeout time.Duration
+}
+
+// Connect opens a connection pool and waits for the database to accept
+// connections, trying again with growing backoff until startupTimeout passed
+func Connect(ctx context.Context, dialect, dsn string, pool PoolConfig, startupTimeout time.Duration) (db *sql.DB, err error) {
+	db, err = sql.Open(dialect, dsn)
+	if err != nil {
+		return
+	}
+
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	// Zero would keep no idle connection at all
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	deadline := time.Now().Add(startupTimeout)
+	backoff := initialConnectBackoff
+	for {
+		if err = db.PingContext(ctx); err == nil {
+			return
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			break
+		}
+
+		log.Printf("[INFO] database not ready, trying again in %v: %v\n", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			db.Close()
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+
+	db.Close()
+	return nil, fmt.Errorf("database not reachable: %w", err)
+}
+
+// PoolStats returns the statistics of the connection pool
+func (s *Storage) PoolStats() (stats illustrator.PoolStats) {
+	dbStats := s.DB.Stats()
+	return illustrator.PoolStats{
+		MaxOpenConnections: dbStats.MaxOpenConnections,
+		OpenConnections:    dbStats.OpenConnections,
+		InUse:              dbStats.InUse,
+		Idle:               dbStats.Idle,
+		WaitCount:          dbStats.WaitCount,
+		WaitDurationMsec:   dbStats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      dbStats.MaxIdleClosed,
+		MaxIdleTimeClosed:  dbStats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  dbStats.MaxLifetimeClosed,
+	}
+}
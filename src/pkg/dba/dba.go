@@ -3,6 +3,11 @@ package dba
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/sketch-home-task/src/pkg/illustrator"
@@ -10,65 +15,376 @@ import (
 
 type Storage struct {
 	*sql.DB
+	// Layout of the drawings, the JSONB layout when not set
+	Layout DrawingsLayout
+	// Time limit of every storage operation, unless the context given ends
+	// earlier. Zero for no limit.
+	Timeout time.Duration
+	// Transaction of WithTx the storage is bound to, nil outside of WithTx
+	tx *sql.Tx
 }
 
-func NewStorage(dialect, dsn string, idleConn, maxConn int) (s illustrator.CanvasStorage, err error) {
-	db, err := sql.Open(dialect, dsn)
+// NewStorage connects to the database, waiting for it to come up, and migrates
+// the schema to the latest version
+func NewStorage(dialect, dsn string, opts Options) (s illustrator.CanvasStorage, err error) {
+	db, err := Connect(context.Background(), dialect, dsn, opts.Pool, opts.StartupTimeout)
 	if err != nil {
 		return
 	}
 
-	err = db.Ping()
+	storage := &Storage{DB: db, Layout: opts.Layout, Timeout: opts.Timeout}
+	if err = storage.Migrate(context.Background()); err != nil {
+		db.Close()
+		return
+	}
+	count, err := storage.ConvertDrawings(context.Background())
 	if err != nil {
+		db.Close()
 		return
 	}
+	if count > 0 {
+		log.Printf("[INFO] converted the drawings of %d canvases to the %s layout\n", count, opts.Layout)
+	}
 
-	db.SetMaxIdleConns(idleConn)
-	db.SetMaxOpenConns(maxConn)
-	s = &Storage{db}
+	s = storage
 	return
 }
 
+// Close closes the database, a no-op for the storage given to a TxFunc
 func (s *Storage) Close() (err error) {
+	if s.tx != nil {
+		return
+	}
 	return s.DB.Close()
 }
 
+// Canvases are looked up by the hash of their key, which matches the rows
+// created before display names were kept as well. The display name of those
+// rows is unknown until backfilled, their name column holds the hash.
+
 func (s *Storage) FindByName(ctx context.Context, name string) (canvas *illustrator.CanvasModel, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
 	canvas = &illustrator.CanvasModel{}
-	err = s.QueryRow("SELECT width, height, drawings FROM canvas WHERE name = $1", name).
-		Scan(&canvas.Width, &canvas.Height, &canvas.Drawings)
+	err = s.conn().QueryRowContext(ctx, "SELECT COALESCE(display_name, name), width, height, "+s.drawingsOf("")+", revision FROM canvas "+
+		"WHERE name_hash = $1 AND deleted_at IS NULL", illustrator.CanvasKeyHash(name)).
+		Scan(&canvas.Name, &canvas.Width, &canvas.Height, &canvas.Drawings, &canvas.Revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, illustrator.ErrCanvasNotFound
+	}
 	return
 }
 
-func (s *Storage) Create(ctx context.Context, canvas *illustrator.CanvasModel) (res sql.Result, err error) {
-	stmt, err := s.PrepareContext(ctx, "INSERT INTO canvas (name, width, height, drawings) VALUES ($1, $2, $3, $4)")
+// Create stores a new canvas, the unique constraint on the name hash rejects
+// taken names with ErrCanvasExists
+func (s *Storage) Create(ctx context.Context, canvas *illustrator.CanvasModel) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	return s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		return s.create(ctx, tx, canvas)
+	})
+}
+
+func (s *Storage) create(ctx context.Context, tx *sql.Tx, canvas *illustrator.CanvasModel) (err error) {
+	_, err = execPrepared(ctx, tx,
+		"INSERT INTO canvas (name, display_name, name_hash, width, height, drawings) VALUES ($1, $2, $3, $4, $5, $6)",
+		illustrator.CanvasKey(canvas.Name), canvas.Name, illustrator.CanvasKeyHash(canvas.Name),
+		canvas.Width, canvas.Height, s.columnDrawings(canvas.Drawings))
 	if err != nil {
 		return
 	}
-	defer stmt.Close()
+	if err = s.writeDrawings(ctx, tx, "$2::jsonb", illustrator.CanvasKeyHash(canvas.Name), canvas.Drawings); err != nil {
+		return
+	}
+	return s.recordChange(ctx, tx, canvas.Name, illustrator.AuditCreate, illustrator.DiffDrawings(nil, canvas.Drawings))
+}
+
+// Update also stores the names of a canvas created before display names were kept.
+// When the canvas has a revision the update only applies to that revision,
+// otherwise ErrConflict is returned.
+func (s *Storage) Update(ctx context.Context, canvas *illustrator.CanvasModel) (newRevision int, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
 
-	res, err = stmt.ExecContext(ctx, canvas.Name, canvas.Width, canvas.Height, canvas.Drawings)
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		newRevision, err = s.update(ctx, tx, canvas)
+		return
+	})
 	return
 }
 
-func (s *Storage) Update(ctx context.Context, canvas *illustrator.CanvasModel) (res sql.Result, err error) {
-	stmt, err := s.PrepareContext(ctx, "UPDATE canvas SET width = $1, height = $2, drawings = $3 WHERE name = $4")
+func (s *Storage) update(ctx context.Context, tx *sql.Tx, canvas *illustrator.CanvasModel) (newRevision int, err error) {
+	// The sub-select sees the drawings as they were before the update
+	var previous illustrator.DrawingSlice
+	err = tx.QueryRowContext(ctx, "UPDATE canvas SET name = $1, display_name = $2, width = $3, height = $4, "+
+		"drawings = $5, revision = revision + 1, updated_at = now() "+
+		"WHERE name_hash = $6 AND deleted_at IS NULL AND ($7 = 0 OR revision = $7) "+
+		"RETURNING revision, (SELECT "+s.drawingsArrayOf("p")+" FROM canvas p WHERE p.canvas_id = canvas.canvas_id)",
+		illustrator.CanvasKey(canvas.Name), canvas.Name, canvas.Width, canvas.Height,
+		s.columnDrawings(canvas.Drawings), illustrator.CanvasKeyHash(canvas.Name), canvas.Revision).
+		Scan(&newRevision, &previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, missingCanvasError(ctx, tx, canvas.Name, canvas.Revision)
+	}
+	if err != nil {
+		return
+	}
+	if err = s.writeDrawings(ctx, tx, "$2::jsonb", illustrator.CanvasKeyHash(canvas.Name), canvas.Drawings); err != nil {
+		return
+	}
+	err = s.recordChange(ctx, tx, canvas.Name, illustrator.AuditUpdate, illustrator.DiffDrawings(previous, canvas.Drawings))
+	return
+}
+
+// Clone copies a canvas within the database, however large its drawings, and
+// records the canvas as the fork parent of the copy
+func (s *Storage) Clone(ctx context.Context, name string, cloneName string) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	return s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		// Every drawing of the copy is added, drawing rows are copied below
+		var count int
+		err = tx.QueryRowContext(ctx, "INSERT INTO canvas (name, display_name, name_hash, width, height, drawings, forked_from) "+
+			"SELECT $1, $2, $3, width, height, drawings, canvas_id FROM canvas WHERE name_hash = $4 AND deleted_at IS NULL "+
+			"RETURNING "+s.drawingCountOf(""),
+			illustrator.CanvasKey(cloneName), cloneName, illustrator.CanvasKeyHash(cloneName), illustrator.CanvasKeyHash(name)).
+			Scan(&count)
+		if errors.Is(err, sql.ErrNoRows) {
+			return illustrator.ErrCanvasNotFound
+		}
+		if err != nil {
+			return
+		}
+		if s.normalized() {
+			var res sql.Result
+			res, err = execPrepared(ctx, tx, "INSERT INTO drawings (canvas_id, position, x, y, width, height, fill, outline) "+
+				"SELECT n.canvas_id, d.position, d.x, d.y, d.width, d.height, d.fill, d.outline FROM drawings d "+
+				"JOIN canvas p ON p.canvas_id = d.canvas_id JOIN canvas n ON n.name_hash = $1 WHERE p.name_hash = $2",
+				illustrator.CanvasKeyHash(cloneName), illustrator.CanvasKeyHash(name))
+			if err != nil {
+				return
+			}
+			var rows int64
+			if rows, err = res.RowsAffected(); err != nil {
+				return
+			}
+			count = int(rows)
+		}
+		return s.recordChange(ctx, tx, cloneName, illustrator.AuditCreate, illustrator.DrawingsDiff{Added: count})
+	})
+}
+
+// Rename changes the name of a canvas, which keeps its history. When a revision
+// is given the rename only applies to that revision, otherwise ErrConflict is
+// returned. The unique constraint on the name hash rejects taken names.
+func (s *Storage) Rename(ctx context.Context, name string, revision int, newName string) (newRevision int, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		// The joined row holds the name from before the update
+		var previousName string
+		err = tx.QueryRowContext(ctx, "UPDATE canvas c SET name = $1, display_name = $2, name_hash = $3, "+
+			"revision = c.revision + 1, updated_at = now() FROM canvas p WHERE p.canvas_id = c.canvas_id "+
+			"AND c.name_hash = $4 AND c.deleted_at IS NULL AND ($5 = 0 OR c.revision = $5) "+
+			"RETURNING c.revision, COALESCE(p.display_name, p.name)",
+			illustrator.CanvasKey(newName), newName, illustrator.CanvasKeyHash(newName), illustrator.CanvasKeyHash(name), revision).
+			Scan(&newRevision, &previousName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return missingCanvasError(ctx, tx, name, revision)
+		}
+		if err != nil {
+			return
+		}
+		return recordAudit(ctx, tx, newName, illustrator.AuditEntry{Action: illustrator.AuditRename, PreviousName: previousName})
+	})
+	return
+}
+
+// missingCanvasError tells apart a conditional write which matched no canvas
+// because the canvas does not exist from one conflicting with a newer revision
+func missingCanvasError(ctx context.Context, tx *sql.Tx, name string, revision int) (err error) {
+	if revision == 0 {
+		return illustrator.ErrCanvasNotFound
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, "SELECT revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL",
+		illustrator.CanvasKeyHash(name)).
+		Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return illustrator.ErrCanvasNotFound
+	}
+	if err != nil {
+		return
+	}
+	return illustrator.ErrConflict
+}
+
+// Delete moves the canvas to the trash, from where it can be restored until purged
+func (s *Storage) Delete(ctx context.Context, name string) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	return s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		return remove(ctx, tx, name)
+	})
+}
+
+func remove(ctx context.Context, tx *sql.Tx, name string) (err error) {
+	res, err := execPrepared(ctx, tx, "UPDATE canvas SET deleted_at = now() WHERE name_hash = $1 AND deleted_at IS NULL",
+		illustrator.CanvasKeyHash(name))
 	if err != nil {
 		return
 	}
-	defer stmt.Close()
+	if err = requireAffected(res, illustrator.ErrCanvasNotFound); err != nil {
+		return
+	}
+	return recordAudit(ctx, tx, name, illustrator.AuditEntry{Action: illustrator.AuditDelete})
+}
+
+// BackfillNames stores the names of canvases created before display names
+// were kept. Only the SHA-1 digest of those names is known, so the original
+// names have to be supplied. Names not matching any such canvas are ignored,
+// each name is stored in a transaction of its own.
+func (s *Storage) BackfillNames(ctx context.Context, names []string) (count int64, err error) {
+	for _, name := range names {
+		var backfilled bool
+		if backfilled, err = s.backfillName(ctx, name); err != nil {
+			return
+		}
+		if backfilled {
+			count++
+		}
+	}
+	return
+}
+
+// backfillName stores the name of a canvas known by the legacy hash of the
+// name only, recording it as rename from that hash
+func (s *Storage) backfillName(ctx context.Context, name string) (backfilled bool, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	legacyName := illustrator.LegacyNameHash(name)
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		res, err := execPrepared(ctx, tx, "UPDATE canvas SET name = $1, display_name = $2, name_hash = $3 "+
+			"WHERE name_hash = $4 AND display_name IS NULL",
+			illustrator.CanvasKey(name), name, illustrator.CanvasKeyHash(name), legacyName)
+		if err != nil {
+			return
+		}
 
-	res, err = stmt.ExecContext(ctx, canvas.Width, canvas.Height, canvas.Drawings, canvas.Name)
+		var rows int64
+		if rows, err = res.RowsAffected(); err != nil || rows == 0 {
+			return
+		}
+		backfilled = true
+		return recordAudit(ctx, tx, name, illustrator.AuditEntry{Action: illustrator.AuditRename, PreviousName: legacyName})
+	})
 	return
 }
 
-func (s *Storage) Delete(ctx context.Context, name string) (res sql.Result, err error) {
-	stmt, err := s.PrepareContext(ctx, "DELETE FROM canvas WHERE name = $1")
+// Sort columns by list sort field, the name breaks ties on timestamps
+var listSortColumns = map[illustrator.ListSortField]string{
+	illustrator.ListSortByName:    "name",
+	illustrator.ListSortByCreated: "created_at",
+	illustrator.ListSortByUpdated: "updated_at",
+}
+
+func (s *Storage) List(ctx context.Context, opts illustrator.ListOptions) (page *illustrator.CanvasPage, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	if err = opts.Normalize(); err != nil {
+		return
+	}
+	cursor, err := opts.DecodeCursor()
 	if err != nil {
 		return
 	}
-	defer stmt.Close()
 
-	res, err = stmt.ExecContext(ctx, name)
+	// Canvases in the trash are not listed
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	addCondition := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if opts.MinWidth > 0 {
+		addCondition("width >= $%d", opts.MinWidth)
+	}
+	if opts.MaxWidth > 0 {
+		addCondition("width <= $%d", opts.MaxWidth)
+	}
+	if opts.MinHeight > 0 {
+		addCondition("height >= $%d", opts.MinHeight)
+	}
+	if opts.MaxHeight > 0 {
+		addCondition("height <= $%d", opts.MaxHeight)
+	}
+
+	sortColumn := listSortColumns[opts.SortBy]
+	order, comparator := "ASC", ">"
+	if opts.Descending {
+		order, comparator = "DESC", "<"
+	}
+
+	// Keyset pagination, continue right after the last canvas of the previous page
+	if cursor != nil {
+		if opts.SortBy == illustrator.ListSortByName {
+			addCondition("name "+comparator+" $%d", cursor.Key)
+		} else {
+			addCondition("("+sortColumn+", name) "+comparator+" ($%d, $%d)", cursor.Time, cursor.Key)
+		}
+	}
+
+	query := "SELECT COALESCE(display_name, name), name, width, height, " + s.drawingCountOf("") + ", " +
+		"created_at, updated_at, " +
+		"(SELECT COALESCE(p.display_name, p.name) FROM canvas p WHERE p.canvas_id = canvas.forked_from) " +
+		"FROM canvas WHERE " + strings.Join(conditions, " AND ")
+	if opts.SortBy == illustrator.ListSortByName {
+		query += fmt.Sprintf(" ORDER BY name %s", order)
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, name %s", sortColumn, order, order)
+	}
+	// Fetch one extra row to find out whether there is a next page
+	args = append(args, opts.Limit+1)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	page = &illustrator.CanvasPage{Canvases: []illustrator.CanvasInfo{}}
+	for rows.Next() {
+		var info illustrator.CanvasInfo
+		var forkedFrom sql.NullString
+		err = rows.Scan(&info.Name, &info.Key, &info.Width, &info.Height, &info.DrawingCount, &info.CreatedAt, &info.UpdatedAt,
+			&forkedFrom)
+		if err != nil {
+			return nil, err
+		}
+		info.ForkedFrom = forkedFrom.String
+		page.Canvases = append(page.Canvases, info)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Canvases) > opts.Limit {
+		page.Canvases = page.Canvases[:opts.Limit]
+		page.NextCursor = illustrator.NewListCursor(opts.SortBy, &page.Canvases[opts.Limit-1])
+	}
 	return
 }
@@ -0,0 +1,146 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Canvases stored without drawings may hold a JSON null instead of an array
+const drawingsArray = "CASE jsonb_typeof(drawings) WHEN 'array' THEN drawings ELSE '[]'::jsonb END"
+
+// drawingsChange is a modification of the drawings of a canvas in either layout
+type drawingsChange struct {
+	// Assignment of the drawings column, its arguments follow the canvas name hash
+	assignment string
+	// Statement on the drawing rows, its arguments follow the canvas id
+	statement string
+	args      []interface{}
+	// Drawings added, removed or changed by the modification
+	diff illustrator.DrawingsDiff
+}
+
+// AppendDrawing adds a drawing on top of the canvas drawings
+func (s *Storage) AppendDrawing(ctx context.Context, name string, revision int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	value, err := json.Marshal(drawing)
+	if err != nil {
+		return
+	}
+
+	return s.modifyDrawings(ctx, name, revision, -1, check, drawingsChange{
+		assignment: "drawings = " + drawingsArray + " || jsonb_build_array($2::jsonb)",
+		statement: "INSERT INTO drawings (canvas_id, position, x, y, width, height, fill, outline) " +
+			"SELECT $1::int, (SELECT COUNT(*) FROM drawings WHERE canvas_id = $1::int), " + drawingValues("$2::jsonb"),
+		args: []interface{}{string(value)},
+		diff: illustrator.DrawingsDiff{Added: 1},
+	})
+}
+
+// ReplaceDrawing overwrites the drawing at the given index
+func (s *Storage) ReplaceDrawing(ctx context.Context, name string, revision int, index int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	if index < 0 {
+		return nil, illustrator.ErrDrawingNotFound
+	}
+
+	value, err := json.Marshal(drawing)
+	if err != nil {
+		return
+	}
+
+	return s.modifyDrawings(ctx, name, revision, index, check, drawingsChange{
+		assignment: "drawings = jsonb_set(drawings, ARRAY[$2::text], $3::jsonb)",
+		statement: "UPDATE drawings SET (x, y, width, height, fill, outline) = (" + drawingValues("$3::jsonb") + ") " +
+			"WHERE canvas_id = $1 AND position = $2",
+		args: []interface{}{index, string(value)},
+		diff: illustrator.DrawingsDiff{Changed: 1},
+	})
+}
+
+// RemoveDrawing deletes the drawing at the given index, the following drawings move down
+func (s *Storage) RemoveDrawing(ctx context.Context, name string, revision int, index int,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	if index < 0 {
+		return nil, illustrator.ErrDrawingNotFound
+	}
+
+	return s.modifyDrawings(ctx, name, revision, index, check, drawingsChange{
+		assignment: "drawings = drawings - $2::int",
+		// The primary key is checked on commit, once the positions are shifted
+		statement: "WITH removed AS (DELETE FROM drawings WHERE canvas_id = $1 AND position = $2) " +
+			"UPDATE drawings SET position = position - 1 WHERE canvas_id = $1 AND position > $2",
+		args: []interface{}{index},
+		diff: illustrator.DrawingsDiff{Removed: 1},
+	})
+}
+
+// modifyDrawings modifies the drawings in place. The canvas row is locked first
+// to check the revision and the drawing index, a negative index is not checked.
+// The resulting canvas is checked before committing.
+func (s *Storage) modifyDrawings(ctx context.Context, name string, revision int, index int, check illustrator.CanvasCheck,
+	change drawingsChange) (canvas *illustrator.CanvasModel, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	nameHash := illustrator.CanvasKeyHash(name)
+
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		var id int64
+		var current, count int
+		if s.normalized() {
+			err = tx.QueryRowContext(ctx, "SELECT canvas_id, revision, "+s.drawingCountOf("canvas")+" "+
+				"FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL FOR UPDATE", nameHash).
+				Scan(&id, &current, &count)
+		} else {
+			err = tx.QueryRowContext(ctx, "SELECT revision, jsonb_array_length("+drawingsArray+") "+
+				"FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL FOR UPDATE", nameHash).
+				Scan(&current, &count)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return illustrator.ErrCanvasNotFound
+		}
+		if err != nil {
+			return
+		}
+		if revision != 0 && revision != current {
+			return illustrator.ErrConflict
+		}
+		if index >= count {
+			return illustrator.ErrDrawingNotFound
+		}
+
+		assignment := change.assignment + ", "
+		args := append([]interface{}{nameHash}, change.args...)
+		if s.normalized() {
+			if _, err = tx.ExecContext(ctx, change.statement, append([]interface{}{id}, change.args...)...); err != nil {
+				return
+			}
+			assignment, args = "", []interface{}{nameHash}
+		}
+
+		canvas = &illustrator.CanvasModel{}
+		err = tx.QueryRowContext(ctx, fmt.Sprintf("UPDATE canvas SET %srevision = revision + 1, updated_at = now() "+
+			"WHERE name_hash = $1 RETURNING COALESCE(display_name, name), width, height, %s, revision",
+			assignment, s.drawingsOf("")), args...).
+			Scan(&canvas.Name, &canvas.Width, &canvas.Height, &canvas.Drawings, &canvas.Revision)
+		if err != nil {
+			return
+		}
+
+		if check != nil {
+			if err = check(canvas); err != nil {
+				return
+			}
+		}
+		return s.recordChange(ctx, tx, name, illustrator.AuditUpdate, change.diff)
+	})
+	if err != nil {
+		canvas = nil
+	}
+	return
+}
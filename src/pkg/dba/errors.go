@@ -0,0 +1,66 @@
+package dba
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Postgres error codes reported as errors of the illustrator package
+var pqErrorCodes = map[pq.ErrorCode]error{
+	"23505": illustrator.ErrCanvasExists, // unique_violation
+	"40001": illustrator.ErrConflict,     // serialization_failure
+	"40P01": illustrator.ErrConflict,     // deadlock_detected
+}
+
+// storageError is a Postgres error matching an error of the illustrator package
+type storageError struct {
+	err   error
+	cause *pq.Error
+}
+
+func (e *storageError) Error() (msg string) {
+	return e.err.Error() + ": " + e.cause.Error()
+}
+
+func (e *storageError) Is(target error) (ok bool) {
+	return target == e.err
+}
+
+func (e *storageError) Unwrap() (err error) {
+	return e.cause
+}
+
+// translateError reports Postgres errors with a meaning to the callers of the
+// storage as errors of the illustrator package, which wrap the original error
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	if domainErr, ok := pqErrorCodes[pqErr.Code]; ok {
+		return &storageError{err: domainErr, cause: pqErr}
+	}
+	return err
+}
+
+// isSerializationFailure reports whether a transaction failed because of
+// concurrent ones and may succeed when run again
+func isSerializationFailure(err error) (ok bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// requireAffected returns notFound when a write matched no row
+func requireAffected(res sql.Result, notFound error) (err error) {
+	count, err := res.RowsAffected()
+	if err == nil && count == 0 {
+		err = notFound
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Import stores a canvas with its timestamps and versions as they are given.
+// The canvas is at the revision of its latest version, its audit log starts
+// with the import. The unique constraint on the name hash rejects taken names.
+func (s *Storage) Import(ctx context.Context, history *illustrator.CanvasHistory) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	canvas := &history.Canvas
+	return s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		_, err = execPrepared(ctx, tx, "INSERT INTO canvas (name, display_name, name_hash, width, height, drawings, "+
+			"revision, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			illustrator.CanvasKey(canvas.Name), canvas.Name, illustrator.CanvasKeyHash(canvas.Name),
+			canvas.Width, canvas.Height, s.columnDrawings(canvas.Drawings), len(history.Versions),
+			history.CreatedAt, history.UpdatedAt)
+		if err != nil {
+			return
+		}
+		if err = s.writeDrawings(ctx, tx, "$2::jsonb", illustrator.CanvasKeyHash(canvas.Name), canvas.Drawings); err != nil {
+			return
+		}
+
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO canvas_versions (canvas_id, version, width, height, drawings, created_at) "+
+			"SELECT canvas_id, $2, $3, $4, $5, $6 FROM canvas WHERE name_hash = $1")
+		if err != nil {
+			return
+		}
+		defer stmt.Close()
+
+		for _, v := range history.Versions {
+			_, err = stmt.ExecContext(ctx, illustrator.CanvasKeyHash(canvas.Name), v.Version, v.Canvas.Width, v.Canvas.Height,
+				v.Canvas.Drawings, v.CreatedAt)
+			if err != nil {
+				return
+			}
+		}
+
+		diff := illustrator.DiffDrawings(nil, canvas.Drawings)
+		return recordAudit(ctx, tx, canvas.Name, illustrator.AuditEntry{Action: illustrator.AuditCreate, Diff: &diff})
+	})
+}
+
+// LinkFork records parent as the canvas the named one was cloned from, both
+// must be out of the trash
+func (s *Storage) LinkFork(ctx context.Context, name string, parent string) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	res, err := execPrepared(ctx, s.conn(), "UPDATE canvas c SET forked_from = p.canvas_id FROM canvas p "+
+		"WHERE c.name_hash = $1 AND c.deleted_at IS NULL AND p.name_hash = $2 AND p.deleted_at IS NULL",
+		illustrator.CanvasKeyHash(name), illustrator.CanvasKeyHash(parent))
+	if err != nil {
+		return
+	}
+	return requireAffected(res, illustrator.ErrCanvasNotFound)
+}
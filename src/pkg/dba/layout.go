@@ -0,0 +1,167 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DrawingsLayout is how the drawings of canvases are stored
+type DrawingsLayout string
+
+const (
+	// All drawings of a canvas in one JSONB array of the canvas table
+	LayoutJSONB DrawingsLayout = "jsonb"
+	// One row per drawing in the drawings table, edits of single drawings
+	// only touch their row
+	LayoutNormalized DrawingsLayout = "normalized"
+)
+
+func ParseDrawingsLayout(str string) (layout DrawingsLayout, err error) {
+	switch layout = DrawingsLayout(str); layout {
+	case "":
+		return LayoutJSONB, nil
+	case LayoutJSONB, LayoutNormalized:
+		return
+	default:
+		return "", fmt.Errorf("unknown drawings layout '%s'", str)
+	}
+}
+
+func (s *Storage) normalized() (ok bool) {
+	return s.Layout == LayoutNormalized
+}
+
+// drawingsOf returns the JSONB array of drawings of the canvas table or alias
+func (s *Storage) drawingsOf(table string) (expr string) {
+	if s.normalized() {
+		return normalizedDrawingsOf(table)
+	}
+	return qualify(table, "drawings")
+}
+
+// drawingsArrayOf returns the drawings of the canvas table or alias as an
+// array, canvases stored without drawings hold none
+func (s *Storage) drawingsArrayOf(table string) (expr string) {
+	if s.normalized() {
+		return normalizedDrawingsOf(table)
+	}
+	return "COALESCE(" + qualify(table, "drawings") + ", '[]'::jsonb)"
+}
+
+// drawingCountOf returns the number of drawings of the canvas table or alias
+func (s *Storage) drawingCountOf(table string) (expr string) {
+	if s.normalized() {
+		return fmt.Sprintf("(SELECT COUNT(*) FROM drawings d WHERE d.canvas_id = %s)", qualify(table, "canvas_id"))
+	}
+	drawings := qualify(table, "drawings")
+	return fmt.Sprintf("CASE jsonb_typeof(%[1]s) WHEN 'array' THEN jsonb_array_length(%[1]s) ELSE 0 END", drawings)
+}
+
+// qualify prefixes the column with the table, unless the table is implied
+func qualify(table, column string) (expr string) {
+	if table == "" {
+		return column
+	}
+	return table + "." + column
+}
+
+// normalizedDrawingsOf aggregates the drawing rows of a canvas into the JSONB
+// array the JSONB layout stores
+func normalizedDrawingsOf(table string) (expr string) {
+	if table == "" {
+		table = "canvas"
+	}
+	return "(SELECT COALESCE(jsonb_agg(jsonb_build_object('coordinates', jsonb_build_array(d.x, d.y), " +
+		"'width', d.width, 'height', d.height, 'fill', d.fill, 'outline', d.outline) ORDER BY d.position), '[]'::jsonb) " +
+		"FROM drawings d WHERE d.canvas_id = " + table + ".canvas_id)"
+}
+
+// drawingValues extracts the drawing row columns x, y, width, height, fill
+// and outline from a JSONB drawing
+func drawingValues(drawing string) (exprs string) {
+	return fmt.Sprintf("(%[1]s->'coordinates'->>0)::int, (%[1]s->'coordinates'->>1)::int, (%[1]s->>'width')::int, "+
+		"(%[1]s->>'height')::int, (%[1]s->>'fill')::int, (%[1]s->>'outline')::int", drawing)
+}
+
+// insertDrawingsQuery stores the JSONB array of drawings as rows of the
+// canvases c matching the condition
+func insertDrawingsQuery(array string, condition string) (query string) {
+	return "INSERT INTO drawings (canvas_id, position, x, y, width, height, fill, outline) " +
+		"SELECT c.canvas_id, e.position - 1, " + drawingValues("e.value") + " FROM canvas c " +
+		"CROSS JOIN LATERAL jsonb_array_elements(CASE jsonb_typeof(" + array + ") WHEN 'array' THEN " + array +
+		" ELSE '[]'::jsonb END) WITH ORDINALITY AS e(value, position) WHERE " + condition
+}
+
+// columnDrawings is the value of the drawings column written by the storage
+func (s *Storage) columnDrawings(drawings interface{}) (value interface{}) {
+	if s.normalized() {
+		return nil
+	}
+	return drawings
+}
+
+// writeDrawings replaces the drawing rows of the canvas with the given name
+// hash by the JSONB array, whose arguments follow the hash. A no-op in the
+// JSONB layout.
+func (s *Storage) writeDrawings(ctx context.Context, tx *sql.Tx, array string, nameHash string,
+	args ...interface{}) (err error) {
+	if !s.normalized() {
+		return
+	}
+
+	_, err = execPrepared(ctx, tx,
+		"DELETE FROM drawings WHERE canvas_id = (SELECT canvas_id FROM canvas WHERE name_hash = $1)", nameHash)
+	if err != nil {
+		return
+	}
+	_, err = execPrepared(ctx, tx, insertDrawingsQuery(array, "c.name_hash = $1"), append([]interface{}{nameHash}, args...)...)
+	return
+}
+
+// ConvertDrawings moves drawings stored in the other layout into the layout of
+// the storage, returning the number of converted canvases. Instances sharing
+// a database must use the same layout.
+func (s *Storage) ConvertDrawings(ctx context.Context) (count int64, err error) {
+	// Checked first to avoid locking the canvas table on every startup
+	var pending bool
+	if s.normalized() {
+		err = s.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM canvas WHERE drawings IS NOT NULL)").Scan(&pending)
+	} else {
+		// Canvases without drawings have no rows, but no array either
+		err = s.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM drawings) OR "+
+			"EXISTS (SELECT 1 FROM canvas WHERE drawings IS NULL)").Scan(&pending)
+	}
+	if err != nil || !pending {
+		return
+	}
+
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		// Writers must not change drawings in the old layout meanwhile
+		if _, err = tx.ExecContext(ctx, "LOCK TABLE canvas IN EXCLUSIVE MODE"); err != nil {
+			return
+		}
+
+		var res sql.Result
+		if s.normalized() {
+			_, err = tx.ExecContext(ctx, insertDrawingsQuery("c.drawings", "c.drawings IS NOT NULL"))
+			if err != nil {
+				return
+			}
+			res, err = tx.ExecContext(ctx, "UPDATE canvas SET drawings = NULL WHERE drawings IS NOT NULL")
+		} else {
+			res, err = tx.ExecContext(ctx, "UPDATE canvas SET drawings = "+normalizedDrawingsOf("")+" WHERE drawings IS NULL")
+			if err != nil {
+				return
+			}
+			_, err = tx.ExecContext(ctx, "DELETE FROM drawings")
+		}
+		if err != nil {
+			return
+		}
+
+		count, err = res.RowsAffected()
+		return
+	})
+	return
+}
@@ -0,0 +1,138 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are named <version>_<description>.sql, e.g. 0001_create_canvas.sql,
+// and are applied in ascending version order. Applied migrations must never be
+// edited, schema changes always go into a new file.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Arbitrary key of the advisory lock serializing concurrent migrations
+const migrationLockKey int64 = 0x736b65746368
+
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+func loadMigrations() (migrations []migration, err error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return
+	}
+
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name '%s'", fileName)
+		}
+
+		var version int
+		version, err = strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in '%s'", fileName)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations '%s' and '%s' share version %d", other, fileName, version)
+		}
+		seen[version] = fileName
+
+		var query []byte
+		query, err = migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return
+		}
+
+		migrations = append(migrations, migration{version, name, string(query)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return
+}
+
+// Migrate applies the pending up-migrations. An advisory lock guarantees that
+// only one application instance migrates the schema at a time.
+func (s *Storage) Migrate(ctx context.Context) (err error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return
+	}
+
+	// Advisory locks are held per session, so stick to a single connection
+	conn, err := s.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return
+	}
+	defer func() {
+		_, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+    version INT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return
+	}
+
+	var current int
+	err = conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	if err != nil {
+		return
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err = applyMigration(ctx, conn, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d '%s': %w", m.version, m.name, err)
+		}
+	}
+	return
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, m.query); err != nil {
+		return
+	}
+	if _, err = tx.ExecContext(ctx, "INSERT INTO schema_version (version, name) VALUES ($1, $2)", m.version, m.name); err != nil {
+		return
+	}
+	return tx.Commit()
+}
@@ -1,12 +1,7 @@
-DROP TABLE IF EXISTS canvas;
-
-CREATE TABLE canvas (
+CREATE TABLE IF NOT EXISTS canvas (
     canvas_id SERIAL PRIMARY KEY,
     name VARCHAR(50) UNIQUE,
     width INT,
     height INT,
     drawings JSONB
 );
-
-ALTER TABLE canvas
-    OWNER TO postgres;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE canvas
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS canvas_created_at_idx ON canvas (created_at, name);
+CREATE INDEX IF NOT EXISTS canvas_updated_at_idx ON canvas (updated_at, name);
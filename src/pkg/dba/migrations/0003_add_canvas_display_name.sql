@@ -0,0 +1,11 @@
+ALTER TABLE canvas
+    ADD COLUMN IF NOT EXISTS display_name VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS name_hash CHAR(40);
+
+-- Rows created so far hold the SHA-1 digest of their name instead of the name,
+-- their display name stays unknown until backfilled
+UPDATE canvas SET name_hash = name WHERE name_hash IS NULL;
+
+ALTER TABLE canvas ALTER COLUMN name_hash SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS canvas_name_hash_key ON canvas (name_hash);
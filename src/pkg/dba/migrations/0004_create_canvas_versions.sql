@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS canvas_versions (
+    canvas_id INT NOT NULL REFERENCES canvas (canvas_id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    width INT,
+    height INT,
+    drawings JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (canvas_id, version)
+);
+
+-- Existing canvases start their history with their current content
+INSERT INTO canvas_versions (canvas_id, version, width, height, drawings, created_at)
+SELECT canvas_id, 1, width, height, drawings, updated_at FROM canvas
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+ALTER TABLE canvas ADD COLUMN IF NOT EXISTS revision INT NOT NULL DEFAULT 1;
+
+-- Every change recorded a version so far
+UPDATE canvas c SET revision = v.version
+FROM (SELECT canvas_id, MAX(version) AS version FROM canvas_versions GROUP BY canvas_id) v
+WHERE v.canvas_id = c.canvas_id;
@@ -0,0 +1,4 @@
+ALTER TABLE canvas ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Trashed canvases are few, only they are indexed for listing and purging the trash
+CREATE INDEX IF NOT EXISTS canvas_deleted_at_idx ON canvas (deleted_at) WHERE deleted_at IS NOT NULL;
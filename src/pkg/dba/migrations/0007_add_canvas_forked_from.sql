@@ -0,0 +1,2 @@
+-- Canvas a canvas was cloned from, forks outlive their parent
+ALTER TABLE canvas ADD COLUMN IF NOT EXISTS forked_from INT REFERENCES canvas (canvas_id) ON DELETE SET NULL;
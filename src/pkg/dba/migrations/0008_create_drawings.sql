@@ -0,0 +1,14 @@
+-- Drawings of canvases stored in the normalized layout, one row per drawing.
+-- The drawings column of those canvases is NULL.
+CREATE TABLE IF NOT EXISTS drawings (
+    canvas_id INT NOT NULL REFERENCES canvas (canvas_id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    x INT,
+    y INT,
+    width INT,
+    height INT,
+    fill INT,
+    outline INT,
+    -- Removing a drawing shifts the positions of the following ones
+    PRIMARY KEY (canvas_id, position) DEFERRABLE INITIALLY DEFERRED
+);
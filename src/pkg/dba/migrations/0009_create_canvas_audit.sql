@@ -0,0 +1,16 @@
+-- Changes of canvases, written in the same transaction as the change
+CREATE TABLE IF NOT EXISTS canvas_audit (
+    audit_id BIGSERIAL PRIMARY KEY,
+    canvas_id INT NOT NULL REFERENCES canvas (canvas_id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    name TEXT NOT NULL,
+    previous_name TEXT,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    revision INT NOT NULL,
+    -- Drawings added, removed and changed, NULL for changes leaving the content as it is
+    diff JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS canvas_audit_canvas_id_idx ON canvas_audit (canvas_id, audit_id);
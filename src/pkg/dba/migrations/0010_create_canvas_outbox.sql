@@ -0,0 +1,18 @@
+-- Change events, written in the same transaction as the change and removed
+-- once delivered. Events outlive purged canvases, so there is no foreign key.
+CREATE TABLE IF NOT EXISTS canvas_outbox (
+    event_id BIGSERIAL PRIMARY KEY,
+    action TEXT NOT NULL,
+    name TEXT NOT NULL,
+    previous_name TEXT,
+    revision INT NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- Failed deliveries so far, the event is due again at next_attempt_at
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS canvas_outbox_next_attempt_at_idx ON canvas_outbox (next_attempt_at);
@@ -0,0 +1,3 @@
+-- The audit log outlives purged canvases, which are recorded in it. Entries
+-- keep the ID of their canvas, IDs are never reused.
+ALTER TABLE canvas_audit DROP CONSTRAINT IF EXISTS canvas_audit_canvas_id_fkey;
@@ -0,0 +1,4 @@
+-- The audit log of a purged canvas is found by the normalized name it was
+-- purged under
+CREATE INDEX IF NOT EXISTS canvas_audit_purged_name_idx ON canvas_audit (lower(btrim(name)), audit_id)
+    WHERE action = 'purge';
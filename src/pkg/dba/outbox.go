@@ -0,0 +1,66 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// ClaimEvents pushes the next attempt of the events due back by the lease.
+// Events claimed by concurrent dispatchers are skipped rather than waited for.
+func (s *Storage) ClaimEvents(ctx context.Context, limit int, lease time.Duration) (events []illustrator.ChangeEvent,
+	err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	rows, err := s.conn().QueryContext(ctx, "UPDATE canvas_outbox SET next_attempt_at = now() + $2 * interval '1 millisecond' "+
+		"WHERE event_id IN (SELECT event_id FROM canvas_outbox WHERE next_attempt_at <= now() "+
+		"ORDER BY event_id LIMIT $1 FOR UPDATE SKIP LOCKED) "+
+		"RETURNING event_id, action, name, previous_name, revision, actor, request_id, occurred_at, attempts",
+		limit, lease.Milliseconds())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event illustrator.ChangeEvent
+		var previousName sql.NullString
+		err = rows.Scan(&event.ID, &event.Action, &event.Name, &previousName, &event.Revision, &event.Actor,
+			&event.RequestID, &event.OccurredAt, &event.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		event.PreviousName = previousName.String
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The rows returned by an update come in no particular order
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return
+}
+
+func (s *Storage) MarkDelivered(ctx context.Context, id int64) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	_, err = s.conn().ExecContext(ctx, "DELETE FROM canvas_outbox WHERE event_id = $1", id)
+	return
+}
+
+func (s *Storage) RetryEvent(ctx context.Context, id int64, at time.Time, reason string) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	_, err = s.conn().ExecContext(ctx, "UPDATE canvas_outbox SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3 "+
+		"WHERE event_id = $1", id, at, reason)
+	return
+}
@@ -0,0 +1,120 @@
+package dba_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/sketch-home-task/src/pkg/dba"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Number of drawings of the benchmarked canvas
+const benchDrawings = 2000
+
+var benchLayouts = []dba.DrawingsLayout{dba.LayoutJSONB, dba.LayoutNormalized}
+
+// benchStorage opens the scratch database of POSTGRES_TEST_DSN in the given
+// layout and stores a large canvas, removed again after the benchmark
+func benchStorage(b *testing.B, layout dba.DrawingsLayout) (storage illustrator.CanvasStorage, name string) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		b.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	storage, err := dba.NewStorage("postgres", dsn, dba.Options{Pool: dba.PoolConfig{MaxOpenConns: 2}, Layout: layout})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ctx := context.Background()
+	name = fmt.Sprintf("bench%s", layout)
+	fill := '#'
+	canvas := illustrator.CanvasModel{Name: name, Width: illustrator.CanvasMaxWidth, Height: illustrator.CanvasMaxHeight}
+	for i := 0; i < benchDrawings; i++ {
+		canvas.Drawings = append(canvas.Drawings, illustrator.DrawingModel{
+			Coordinates: []int{i % illustrator.CanvasMaxHeight, i % illustrator.CanvasMaxWidth},
+			Width:       1,
+			Height:      1,
+			Fill:        &fill,
+		})
+	}
+	if err = storage.Create(ctx, &canvas); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() {
+		storage.Delete(ctx, name)
+		storage.Purge(ctx, name)
+		storage.Close()
+	})
+	b.ResetTimer()
+	return
+}
+
+func BenchmarkFindByName(b *testing.B) {
+	for _, layout := range benchLayouts {
+		b.Run(string(layout), func(b *testing.B) {
+			storage, name := benchStorage(b, layout)
+			for i := 0; i < b.N; i++ {
+				if _, err := storage.FindByName(context.Background(), name); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAppendDrawing(b *testing.B) {
+	fill := '*'
+	drawing := illustrator.DrawingModel{Coordinates: []int{1, 1}, Width: 2, Height: 2, Fill: &fill}
+
+	for _, layout := range benchLayouts {
+		b.Run(string(layout), func(b *testing.B) {
+			storage, name := benchStorage(b, layout)
+			for i := 0; i < b.N; i++ {
+				if _, err := storage.AppendDrawing(context.Background(), name, 0, &drawing, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReplaceDrawing(b *testing.B) {
+	fill := '*'
+	drawing := illustrator.DrawingModel{Coordinates: []int{1, 1}, Width: 2, Height: 2, Fill: &fill}
+
+	for _, layout := range benchLayouts {
+		b.Run(string(layout), func(b *testing.B) {
+			storage, name := benchStorage(b, layout)
+			for i := 0; i < b.N; i++ {
+				_, err := storage.ReplaceDrawing(context.Background(), name, 0, i%benchDrawings, &drawing, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	for _, layout := range benchLayouts {
+		b.Run(string(layout), func(b *testing.B) {
+			storage, name := benchStorage(b, layout)
+			canvas, err := storage.FindByName(context.Background(), name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			canvas.Revision = 0
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := storage.Update(context.Background(), canvas); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
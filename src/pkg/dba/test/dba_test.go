@@ -4,20 +4,24 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/sketch-home-task/src/pkg/dba"
 	"github.com/sketch-home-task/src/pkg/illustrator"
 	"github.com/stretchr/testify/suite"
 )
 
-const (
-	rowsAffected int64 = 1
-)
-
 type MockStorageSuite struct {
 	suite.Suite
 	storage dba.Storage
@@ -45,8 +49,44 @@ func (s *MockStorageSuite) SetupSuite() {
 			Outline:     &asteriskRune,
 		},
 	}
-	hashedName := sha1.Sum([]byte(s.model.Name))
-	s.model.Name = hex.EncodeToString(hashedName[:])
+}
+
+// legacyHash is how canvas names used to be stored, as SHA-1 hex digest
+func legacyHash(name string) (hash string) {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+const recordVersionQuery = `INSERT INTO canvas_versions (canvas_id, version, width, height, drawings) ` +
+	`SELECT c.canvas_id, (SELECT COALESCE(MAX(v.version), 0) + 1 FROM canvas_versions v WHERE v.canvas_id = c.canvas_id), ` +
+	`c.width, c.height, c.drawings FROM canvas c WHERE c.name_hash = $1`
+
+func (s *MockStorageSuite) expectRecordVersion(name string) {
+	prep := s.mock.ExpectPrepare(regexp.QuoteMeta(recordVersionQuery))
+	prep.ExpectExec().WithArgs(legacyHash(name)).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+const (
+	recordAuditQuery = `WITH entry AS (` +
+		`INSERT INTO canvas_audit (canvas_id, action, name, previous_name, actor, request_id, revision, diff) ` +
+		`SELECT canvas_id, $2, COALESCE(display_name, name), $3, $4, $5, revision, $6 FROM canvas WHERE name_hash = $1 ` +
+		`RETURNING action, name, previous_name, revision, actor, request_id, created_at) ` +
+		`INSERT INTO canvas_outbox (action, name, previous_name, revision, actor, request_id, occurred_at) ` +
+		`SELECT action, name, previous_name, revision, actor, request_id, created_at FROM entry`
+)
+
+// expectRecordChange expects the version and audit entry recorded for a change
+// of the canvas content
+func (s *MockStorageSuite) expectRecordChange(name string, action illustrator.AuditAction, diff illustrator.DrawingsDiff) {
+	s.expectRecordVersion(name)
+	s.expectRecordAudit(name, action, nil, diff)
+}
+
+// expectRecordAudit expects an audit entry made by the system actor
+func (s *MockStorageSuite) expectRecordAudit(name string, action illustrator.AuditAction, previousName, diff interface{}) {
+	prep := s.mock.ExpectPrepare(regexp.QuoteMeta(recordAuditQuery))
+	prep.ExpectExec().WithArgs(legacyHash(name), string(action), previousName, illustrator.SystemActor, "", diff).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 }
 
 func (s *MockStorageSuite) TearDownSuite() {
@@ -66,15 +106,19 @@ func TestStorageFindTestSuite(t *testing.T) {
 }
 
 func (s *StorageFindTestSuite) TestStorageFind() {
-	rows := sqlmock.NewRows([]string{"width", "height", "drawings"}).AddRow(s.model.Width, s.model.Height, s.model.Drawings)
-	query := regexp.QuoteMeta(`SELECT width, height, drawings FROM canvas WHERE name = $1`)
-	s.mock.ExpectQuery(query).WithArgs(s.model.Name).WillReturnRows(rows)
+	rows := sqlmock.NewRows([]string{"name", "width", "height", "drawings", "revision"}).
+		AddRow(s.model.Name, s.model.Width, s.model.Height, s.model.Drawings, 4)
+	query := regexp.QuoteMeta(`SELECT COALESCE(display_name, name), width, height, drawings, revision FROM canvas ` +
+		`WHERE name_hash = $1 AND deleted_at IS NULL`)
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name)).WillReturnRows(rows)
 
-	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	// Lookups are case insensitive
+	canvas, err := s.storage.FindByName(context.Background(), "MonaLisa")
 	s.NoError(err)
 
-	s.model.Name = ""
-	s.True(reflect.DeepEqual(*canvas, s.model))
+	expected := s.model
+	expected.Revision = 4
+	s.True(reflect.DeepEqual(*canvas, expected))
 }
 
 // ----------------- CREATE TESTS -----------------
@@ -88,17 +132,53 @@ func TestStorageCreateTestSuite(t *testing.T) {
 }
 
 func (s *StorageCreateTestSuite) TestStorageCreate() {
-	query := regexp.QuoteMeta(`INSERT INTO canvas (name, width, height, drawings) VALUES ($1, $2, $3, $4)`)
+	query := regexp.QuoteMeta(`INSERT INTO canvas (name, display_name, name_hash, width, height, drawings) VALUES ($1, $2, $3, $4, $5, $6)`)
+	s.mock.ExpectBegin()
 	prep := s.mock.ExpectPrepare(query)
-	prep.ExpectExec().WithArgs(s.model.Name, s.model.Width, s.model.Height, s.model.Drawings).WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WithArgs("monalisa", "MonaLisa", legacyHash("monalisa"), s.model.Width, s.model.Height, s.model.Drawings).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordChange(s.model.Name, illustrator.AuditCreate, illustrator.DrawingsDiff{Added: 1})
+	s.mock.ExpectCommit()
 
-	res, err := s.storage.Create(context.Background(), &s.model)
+	canvas := s.model
+	canvas.Name = "MonaLisa"
+	err := s.storage.Create(context.Background(), &canvas)
 	s.NoError(err)
+}
 
-	count, err := res.RowsAffected()
-	s.NoError(err)
+func (s *StorageCreateTestSuite) TestStorageCreateFailure() {
+	query := regexp.QuoteMeta(`INSERT INTO canvas`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(query).ExpectExec().WillReturnError(&pq.Error{Code: "23505", Message: "duplicate key value"})
+	s.mock.ExpectRollback()
 
-	s.Equal(count, rowsAffected)
+	// Taken names are reported as such, the Postgres error stays reachable
+	err := s.storage.Create(context.Background(), &s.model)
+	s.True(errors.Is(err, illustrator.ErrCanvasExists))
+	var pqErr *pq.Error
+	s.True(errors.As(err, &pqErr))
+	s.Equal(pq.ErrorCode("23505"), pqErr.Code)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageCreateTestSuite) TestStorageCreateSerializationFailure() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO canvas`)).ExpectExec().WillReturnError(&pq.Error{Code: "40001"})
+	s.mock.ExpectRollback()
+
+	err := s.storage.Create(context.Background(), &s.model)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	// Other Postgres errors are returned as they are
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO canvas`)).ExpectExec().WillReturnError(&pq.Error{Code: "23502"})
+	s.mock.ExpectRollback()
+
+	err = s.storage.Create(context.Background(), &s.model)
+	s.Error(err)
+	s.False(errors.Is(err, illustrator.ErrCanvasExists))
+	s.False(errors.Is(err, illustrator.ErrConflict))
+	s.NoError(s.mock.ExpectationsWereMet())
 }
 
 // ----------------- UPDATE TESTS -----------------
@@ -111,18 +191,64 @@ func TestStorageUpdateTestSuite(t *testing.T) {
 	suite.Run(t, new(StorageUpdateTestSuite))
 }
 
+const updateQuery = `UPDATE canvas SET name = $1, display_name = $2, width = $3, height = $4, ` +
+	`drawings = $5, revision = revision + 1, updated_at = now() WHERE name_hash = $6 AND deleted_at IS NULL AND ($7 = 0 OR revision = $7) ` +
+	`RETURNING revision, (SELECT COALESCE(p.drawings, '[]'::jsonb) FROM canvas p WHERE p.canvas_id = canvas.canvas_id)`
+
+// updateRows returns the revision of an updated canvas with its drawings before the update
+func updateRows(revision int, previous illustrator.DrawingSlice) (rows *sqlmock.Rows) {
+	return sqlmock.NewRows([]string{"revision", "previous"}).AddRow(revision, previous)
+}
+
 func (s *StorageUpdateTestSuite) TestStorageUpdate() {
-	query := regexp.QuoteMeta(`UPDATE canvas SET width = $1, height = $2, drawings = $3 WHERE name = $4`)
-	prep := s.mock.ExpectPrepare(query)
-	prep.ExpectExec().WithArgs(s.model.Width, s.model.Height, s.model.Drawings, s.model.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+	query := regexp.QuoteMeta(updateQuery)
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(query).
+		WithArgs(s.model.Name, s.model.Name, s.model.Width, s.model.Height, s.model.Drawings, legacyHash(s.model.Name), 0).
+		WillReturnRows(updateRows(5, illustrator.DrawingSlice{}))
+	// The drawings are diffed against those before the update
+	s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{Added: 1})
+	s.mock.ExpectCommit()
 
-	res, err := s.storage.Update(context.Background(), &s.model)
+	revision, err := s.storage.Update(context.Background(), &s.model)
 	s.NoError(err)
+	s.Equal(5, revision)
+}
 
-	count, err := res.RowsAffected()
-	s.NoError(err)
+func (s *StorageUpdateTestSuite) TestStorageUpdateRevisionConflict() {
+	canvas := s.model
+	canvas.Revision = 3
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).
+		WithArgs(s.model.Name, s.model.Name, s.model.Width, s.model.Height, s.model.Drawings, legacyHash(s.model.Name), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	rows := sqlmock.NewRows([]string{"revision"}).AddRow(4)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL`)).
+		WithArgs(legacyHash(s.model.Name)).WillReturnRows(rows)
+	s.mock.ExpectRollback()
+
+	_, err := s.storage.Update(context.Background(), &canvas)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	// Conditional update of a missing canvas is not a conflict
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectRollback()
+
+	_, err = s.storage.Update(context.Background(), &canvas)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
 
-	s.Equal(count, rowsAffected)
+	// Nor is an unconditional one, which needs no lookup
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectRollback()
+
+	_, err = s.storage.Update(context.Background(), &s.model)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
 }
 
 // ----------------- DELETE TESTS -----------------
@@ -136,15 +262,1338 @@ func TestStorageDeleteTestSuite(t *testing.T) {
 }
 
 func (s *StorageDeleteTestSuite) TestStorageDelete() {
-	query := regexp.QuoteMeta(`DELETE FROM canvas WHERE name = $1`)
+	query := regexp.QuoteMeta(`UPDATE canvas SET deleted_at = now() WHERE name_hash = $1 AND deleted_at IS NULL`)
+	s.mock.ExpectBegin()
 	prep := s.mock.ExpectPrepare(query)
-	prep.ExpectExec().WithArgs(s.model.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WithArgs(legacyHash(s.model.Name)).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordAudit(s.model.Name, illustrator.AuditDelete, nil, nil)
+	s.mock.ExpectCommit()
+
+	err := s.storage.Delete(context.Background(), s.model.Name)
+	s.NoError(err)
+
+	s.mock.ExpectBegin()
+	prep = s.mock.ExpectPrepare(query)
+	prep.ExpectExec().WithArgs(legacyHash("unknown")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+
+	err = s.storage.Delete(context.Background(), "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- VERSION TESTS -----------------
+
+type StorageVersionTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageVersionTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageVersionTestSuite))
+}
+
+func (s *StorageVersionTestSuite) TestStorageListVersions() {
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"version", "width", "height", "count", "created_at"}).
+		AddRow(1, s.model.Width, s.model.Height, 0, created).
+		AddRow(2, s.model.Width, s.model.Height, 1, created)
+	query := regexp.QuoteMeta(`FROM canvas_versions v JOIN canvas c ON c.canvas_id = v.canvas_id WHERE c.name_hash = $1 AND c.deleted_at IS NULL ORDER BY v.version`)
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name)).WillReturnRows(rows)
+
+	versions, err := s.storage.ListVersions(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Len(versions, 2)
+	s.Equal(2, versions[1].Version)
+	s.Equal(1, versions[1].DrawingCount)
+
+	// Unknown canvas
+	s.mock.ExpectQuery(query).WithArgs(legacyHash("unknown")).WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	_, err = s.storage.ListVersions(context.Background(), "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+}
+
+func (s *StorageVersionTestSuite) TestStorageFindVersion() {
+	rows := sqlmock.NewRows([]string{"name", "width", "height", "drawings"}).
+		AddRow(s.model.Name, s.model.Width, s.model.Height, s.model.Drawings)
+	query := regexp.QuoteMeta(`SELECT COALESCE(c.display_name, c.name), v.width, v.height, v.drawings ` +
+		`FROM canvas_versions v JOIN canvas c ON c.canvas_id = v.canvas_id WHERE c.name_hash = $1 AND c.deleted_at IS NULL AND v.version = $2`)
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name), 3).WillReturnRows(rows)
+
+	canvas, err := s.storage.FindVersion(context.Background(), s.model.Name, 3)
+	s.NoError(err)
+	s.True(reflect.DeepEqual(*canvas, s.model))
+
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name), 9).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	_, err = s.storage.FindVersion(context.Background(), s.model.Name, 9)
+	s.True(errors.Is(err, illustrator.ErrVersionNotFound))
+}
+
+func (s *StorageVersionTestSuite) TestStorageRestoreVersion() {
+	query := regexp.QuoteMeta(`UPDATE canvas c SET width = v.width, height = v.height, drawings = v.drawings, ` +
+		`revision = c.revision + 1, updated_at = now() FROM canvas_versions v WHERE v.canvas_id = c.canvas_id AND c.name_hash = $1 AND c.deleted_at IS NULL AND v.version = $2 ` +
+		`AND ($3 = 0 OR c.revision = $3) RETURNING c.revision, (SELECT COALESCE(p.drawings, '[]'::jsonb) FROM canvas p WHERE p.canvas_id = c.canvas_id), ` +
+		`COALESCE(v.drawings, '[]'::jsonb)`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name), 3, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"revision", "previous", "restored"}).AddRow(6, s.model.Drawings, illustrator.DrawingSlice{}))
+	s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{Removed: 1})
+	s.mock.ExpectCommit()
+
+	revision, err := s.storage.RestoreVersion(context.Background(), s.model.Name, 0, 3)
+	s.NoError(err)
+	s.Equal(6, revision)
+
+	// No version recorded when the version does not exist
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name), 9, 0).WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectRollback()
+
+	_, err = s.storage.RestoreVersion(context.Background(), s.model.Name, 0, 9)
+	s.True(errors.Is(err, illustrator.ErrVersionNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageVersionTestSuite) TestStorageRestoreVersionRevision() {
+	query := regexp.QuoteMeta(`AND ($3 = 0 OR c.revision = $3) RETURNING c.revision`)
+	currentQuery := regexp.QuoteMeta(`SELECT revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL`)
+
+	// The canvas was changed since
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name), 3, 5).WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectQuery(currentQuery).WithArgs(legacyHash(s.model.Name)).
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(6))
+	s.mock.ExpectRollback()
+
+	_, err := s.storage.RestoreVersion(context.Background(), s.model.Name, 5, 3)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	// The revision matches, the version does not exist
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name), 9, 6).WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectQuery(currentQuery).WithArgs(legacyHash(s.model.Name)).
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(6))
+	s.mock.ExpectRollback()
+
+	_, err = s.storage.RestoreVersion(context.Background(), s.model.Name, 6, 9)
+	s.True(errors.Is(err, illustrator.ErrVersionNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- DRAWING TESTS -----------------
+
+type StorageDrawingTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageDrawingTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageDrawingTestSuite))
+}
+
+const lockDrawingsQuery = `SELECT revision, jsonb_array_length(CASE jsonb_typeof(drawings) WHEN 'array' THEN drawings ELSE '[]'::jsonb END) ` +
+	`FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL FOR UPDATE`
+
+const drawingsReturning = `, revision = revision + 1, updated_at = now() WHERE name_hash = $1 ` +
+	`RETURNING COALESCE(display_name, name), width, height, drawings, revision`
+
+func (s *StorageDrawingTestSuite) expectLock(revision, count int) {
+	rows := sqlmock.NewRows([]string{"revision", "count"}).AddRow(revision, count)
+	s.mock.ExpectQuery(regexp.QuoteMeta(lockDrawingsQuery)).WithArgs(legacyHash(s.model.Name)).WillReturnRows(rows)
+}
+
+func (s *StorageDrawingTestSuite) canvasRows(drawings illustrator.DrawingSlice, revision int) (rows *sqlmock.Rows) {
+	return sqlmock.NewRows([]string{"name", "width", "height", "drawings", "revision"}).
+		AddRow(s.model.Name, s.model.Width, s.model.Height, drawings, revision)
+}
+
+func (s *StorageDrawingTestSuite) TestStorageAppendDrawing() {
+	drawing := s.model.Drawings[0]
+	drawings := append(illustrator.DrawingSlice{}, s.model.Drawings[0], drawing)
+
+	s.mock.ExpectBegin()
+	s.expectLock(2, 1)
+	query := `UPDATE canvas SET drawings = CASE jsonb_typeof(drawings) WHEN 'array' THEN drawings ELSE '[]'::jsonb END ` +
+		`|| jsonb_build_array($2::jsonb)` + drawingsReturning
+	s.mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(legacyHash(s.model.Name), sqlmock.AnyArg()).
+		WillReturnRows(s.canvasRows(drawings, 3))
+	s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{Added: 1})
+	s.mock.ExpectCommit()
+
+	var checked *illustrator.CanvasModel
+	canvas, err := s.storage.AppendDrawing(context.Background(), s.model.Name, 2, &drawing,
+		func(canvas *illustrator.CanvasModel) (err error) {
+			checked = canvas
+			return
+		})
+	s.NoError(err)
+	s.Equal(3, canvas.Revision)
+	s.Len(canvas.Drawings, 2)
+	s.Equal(canvas, checked)
+}
+
+func (s *StorageDrawingTestSuite) TestStorageReplaceDrawing() {
+	s.mock.ExpectBegin()
+	s.expectLock(2, 1)
+	query := `UPDATE canvas SET drawings = jsonb_set(drawings, ARRAY[$2::text], $3::jsonb)` + drawingsReturning
+	s.mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(legacyHash(s.model.Name), 0, sqlmock.AnyArg()).
+		WillReturnRows(s.canvasRows(s.model.Drawings, 3))
+	s.mock.ExpectRollback()
+
+	// A failed check aborts the change
+	checkErr := errors.New("invalid canvas")
+	canvas, err := s.storage.ReplaceDrawing(context.Background(), s.model.Name, 0, 0, &s.model.Drawings[0],
+		func(canvas *illustrator.CanvasModel) (err error) {
+			return checkErr
+		})
+	s.True(errors.Is(err, checkErr))
+	s.Nil(canvas)
+}
+
+func (s *StorageDrawingTestSuite) TestStorageRemoveDrawing() {
+	s.mock.ExpectBegin()
+	s.expectLock(2, 1)
+	query := `UPDATE canvas SET drawings = drawings - $2::int` + drawingsReturning
+	s.mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(legacyHash(s.model.Name), 0).
+		WillReturnRows(s.canvasRows(illustrator.DrawingSlice{}, 3))
+	s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{Removed: 1})
+	s.mock.ExpectCommit()
+
+	canvas, err := s.storage.RemoveDrawing(context.Background(), s.model.Name, 0, 0, nil)
+	s.NoError(err)
+	s.Empty(canvas.Drawings)
+}
+
+func (s *StorageDrawingTestSuite) TestStorageDrawingErrors() {
+	// Revision conflict
+	s.mock.ExpectBegin()
+	s.expectLock(2, 1)
+	s.mock.ExpectRollback()
+	_, err := s.storage.RemoveDrawing(context.Background(), s.model.Name, 1, 0, nil)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	// Index out of range
+	s.mock.ExpectBegin()
+	s.expectLock(2, 1)
+	s.mock.ExpectRollback()
+	_, err = s.storage.RemoveDrawing(context.Background(), s.model.Name, 2, 1, nil)
+	s.True(errors.Is(err, illustrator.ErrDrawingNotFound))
+
+	// Missing canvas
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(lockDrawingsQuery)).WillReturnRows(sqlmock.NewRows([]string{"revision", "count"}))
+	s.mock.ExpectRollback()
+	_, err = s.storage.RemoveDrawing(context.Background(), s.model.Name, 0, 0, nil)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	// Negative indexes never reach the database
+	_, err = s.storage.ReplaceDrawing(context.Background(), s.model.Name, 0, -1, &s.model.Drawings[0], nil)
+	s.True(errors.Is(err, illustrator.ErrDrawingNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- BATCH TESTS -----------------
+
+type StorageBatchTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageBatchTestSuite))
+}
+
+const createQuery = `INSERT INTO canvas (name, display_name, name_hash, width, height, drawings) VALUES ($1, $2, $3, $4, $5, $6)`
+
+func (s *StorageBatchTestSuite) expectSavepoint(statement string) {
+	s.mock.ExpectExec(regexp.QuoteMeta(statement + " batch_operation")).WillReturnResult(sqlmock.NewResult(0, 0))
+}
 
-	res, err := s.storage.Delete(context.Background(), s.model.Name)
+func (s *StorageBatchTestSuite) TestStorageBatch() {
+	s.mock.ExpectBegin()
+	// Create fails, rolled back to its savepoint
+	s.expectSavepoint("SAVEPOINT")
+	s.mock.ExpectPrepare(regexp.QuoteMeta(createQuery)).ExpectExec().
+		WillReturnError(&pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"})
+	s.expectSavepoint("ROLLBACK TO SAVEPOINT")
+	// Update applies
+	s.expectSavepoint("SAVEPOINT")
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(updateRows(2, s.model.Drawings))
+	s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{})
+	s.expectSavepoint("RELEASE SAVEPOINT")
+	// Delete matches no canvas
+	s.expectSavepoint("SAVEPOINT")
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`UPDATE canvas SET deleted_at = now() WHERE name_hash = $1 AND deleted_at IS NULL`)).ExpectExec().
+		WithArgs(legacyHash("unknown")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.expectSavepoint("ROLLBACK TO SAVEPOINT")
+	s.mock.ExpectCommit()
+
+	results, err := s.storage.Batch(context.Background(), []illustrator.BatchOperation{
+		{Op: illustrator.BatchCreate, Canvas: &s.model},
+		{Op: illustrator.BatchUpdate, Canvas: &s.model},
+		{Op: illustrator.BatchDelete, Name: "unknown"},
+	}, false)
+	s.NoError(err)
+	s.Require().Len(results, 3)
+	s.Equal(illustrator.BatchStatusFailed, results[0].Status)
+	s.True(errors.Is(results[0].Err, illustrator.ErrCanvasExists))
+	s.Equal(illustrator.BatchStatusOK, results[1].Status)
+	s.Equal(illustrator.BatchStatusNotFound, results[2].Status)
+	s.Equal("unknown", results[2].Name)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageBatchTestSuite) TestStorageBatchAtomic() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(regexp.QuoteMeta(createQuery)).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordChange(s.model.Name, illustrator.AuditCreate, illustrator.DrawingsDiff{Added: 1})
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectRollback()
+
+	results, err := s.storage.Batch(context.Background(), []illustrator.BatchOperation{
+		{Op: illustrator.BatchCreate, Canvas: &s.model},
+		{Op: illustrator.BatchUpdate, Canvas: &s.model},
+		{Op: illustrator.BatchDelete, Name: s.model.Name},
+	}, true)
+	s.True(errors.Is(err, illustrator.ErrBatchAborted))
+	s.Require().Len(results, 3)
+	s.Equal(illustrator.BatchStatusAborted, results[0].Status)
+	s.Equal(illustrator.BatchStatusNotFound, results[1].Status)
+	s.Equal(illustrator.BatchStatusAborted, results[2].Status)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- CLONE TESTS -----------------
+
+type StorageCloneTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageCloneTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageCloneTestSuite))
+}
+
+const cloneQuery = `INSERT INTO canvas (name, display_name, name_hash, width, height, drawings, forked_from) ` +
+	`SELECT $1, $2, $3, width, height, drawings, canvas_id FROM canvas WHERE name_hash = $4 AND deleted_at IS NULL ` +
+	`RETURNING CASE jsonb_typeof(drawings) WHEN 'array' THEN jsonb_array_length(drawings) ELSE 0 END`
+
+func (s *StorageCloneTestSuite) TestStorageClone() {
+	s.mock.ExpectBegin()
+	// Every drawing of the copy is added
+	s.mock.ExpectQuery(regexp.QuoteMeta(cloneQuery)).
+		WithArgs("copy", "Copy", legacyHash("copy"), legacyHash(s.model.Name)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	s.expectRecordChange("copy", illustrator.AuditCreate, illustrator.DrawingsDiff{Added: 1})
+	s.mock.ExpectCommit()
+
+	err := s.storage.Clone(context.Background(), s.model.Name, "Copy")
+	s.NoError(err)
+}
+
+func (s *StorageCloneTestSuite) TestStorageCloneNotFound() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(cloneQuery)).WillReturnRows(sqlmock.NewRows([]string{"count"}))
+	s.mock.ExpectRollback()
+
+	err := s.storage.Clone(context.Background(), "unknown", "copy")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- RENAME TESTS -----------------
+
+type StorageRenameTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageRenameTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageRenameTestSuite))
+}
+
+const renameQuery = `UPDATE canvas c SET name = $1, display_name = $2, name_hash = $3, revision = c.revision + 1, ` +
+	`updated_at = now() FROM canvas p WHERE p.canvas_id = c.canvas_id AND c.name_hash = $4 AND c.deleted_at IS NULL ` +
+	`AND ($5 = 0 OR c.revision = $5) RETURNING c.revision, COALESCE(p.display_name, p.name)`
+
+func (s *StorageRenameTestSuite) TestStorageRename() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(renameQuery)).
+		WithArgs("gioconda", "Gioconda", legacyHash("gioconda"), legacyHash(s.model.Name), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"revision", "previous_name"}).AddRow(5, "MonaLisa"))
+	s.expectRecordAudit("gioconda", illustrator.AuditRename, "MonaLisa", nil)
+	s.mock.ExpectCommit()
+
+	revision, err := s.storage.Rename(context.Background(), s.model.Name, 0, "Gioconda")
 	s.NoError(err)
+	s.Equal(5, revision)
+}
+
+func (s *StorageRenameTestSuite) TestStorageRenameConflict() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(renameQuery)).WillReturnRows(sqlmock.NewRows([]string{"revision", "previous_name"}))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL`)).
+		WithArgs(legacyHash(s.model.Name)).WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(4))
+	s.mock.ExpectRollback()
+
+	_, err := s.storage.Rename(context.Background(), s.model.Name, 3, "gioconda")
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	// Unconditional rename of a missing canvas
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(renameQuery)).WillReturnRows(sqlmock.NewRows([]string{"revision", "previous_name"}))
+	s.mock.ExpectRollback()
+
+	_, err = s.storage.Rename(context.Background(), "unknown", 0, "gioconda")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- TRASH TESTS -----------------
+
+type StorageTrashTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageTrashTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTrashTestSuite))
+}
 
-	count, err := res.RowsAffected()
+func (s *StorageTrashTestSuite) TestStorageListTrash() {
+	deletedAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"name", "key", "width", "height", "drawing_count", "deleted_at"}).
+		AddRow("MonaLisa", "monalisa", 20, 20, 1, deletedAt)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(display_name, name), name, width, height, ` +
+		`CASE jsonb_typeof(drawings) WHEN 'array' THEN jsonb_array_length(drawings) ELSE 0 END, deleted_at ` +
+		`FROM canvas WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, name`)).WillReturnRows(rows)
+
+	canvases, err := s.storage.ListTrash(context.Background())
 	s.NoError(err)
+	s.Equal([]illustrator.TrashedCanvas{
+		{Name: "MonaLisa", Key: "monalisa", Width: 20, Height: 20, DrawingCount: 1, DeletedAt: deletedAt},
+	}, canvases)
+}
+
+func (s *StorageTrashTestSuite) TestStorageUndelete() {
+	query := regexp.QuoteMeta(`UPDATE canvas SET deleted_at = NULL WHERE name_hash = $1 AND deleted_at IS NOT NULL`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(query).ExpectExec().WithArgs(legacyHash(s.model.Name)).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordAudit(s.model.Name, illustrator.AuditUndelete, nil, nil)
+	s.mock.ExpectCommit()
+
+	err := s.storage.Undelete(context.Background(), s.model.Name)
+	s.NoError(err)
+
+	// Only trashed canvases are restored
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(query).ExpectExec().WithArgs(legacyHash("unknown")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+	err = s.storage.Undelete(context.Background(), "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+const purgeEventsQuery = `, entry AS (INSERT INTO canvas_audit (canvas_id, action, name, actor, request_id, revision) ` +
+	`SELECT canvas_id, $2, name, $3, $4, revision FROM purged ` +
+	`RETURNING action, name, revision, actor, request_id, created_at) ` +
+	`INSERT INTO canvas_outbox (action, name, revision, actor, request_id, occurred_at) ` +
+	`SELECT action, name, revision, actor, request_id, created_at FROM entry`
+
+func (s *StorageTrashTestSuite) TestStoragePurge() {
+	// The purge is recorded in the audit log and as change event
+	query := regexp.QuoteMeta(`WITH purged AS (DELETE FROM canvas WHERE name_hash = $1 AND deleted_at IS NOT NULL ` +
+		`RETURNING canvas_id, COALESCE(display_name, name) AS name, revision)` + purgeEventsQuery)
+	s.mock.ExpectPrepare(query).ExpectExec().WithArgs(legacyHash(s.model.Name), "purge", illustrator.SystemActor, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.storage.Purge(context.Background(), s.model.Name)
+	s.NoError(err)
+}
+
+func (s *StorageTrashTestSuite) TestStoragePurgeTrash() {
+	before := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta(`WITH purged AS (DELETE FROM canvas WHERE deleted_at < $1 ` +
+		`RETURNING canvas_id, COALESCE(display_name, name) AS name, revision)` + purgeEventsQuery)
+	s.mock.ExpectExec(query).WithArgs(before, "purge", illustrator.SystemActor, "").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	count, err := s.storage.PurgeTrash(context.Background(), before)
+	s.NoError(err)
+	s.Equal(int64(3), count)
+}
+
+// ----------------- IMPORT TESTS -----------------
+
+type StorageImportTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageImportTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageImportTestSuite))
+}
+
+func (s *StorageImportTestSuite) TestStorageImport() {
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	first := illustrator.CanvasModel{Name: "MonaLisa", Width: 10, Height: 10, Drawings: illustrator.DrawingSlice{}}
+	current := s.model
+	current.Name = "MonaLisa"
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO canvas (name, display_name, name_hash, width, height, drawings, `+
+		`revision, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)).ExpectExec().
+		WithArgs("monalisa", "MonaLisa", legacyHash("monalisa"), 20, 20, s.model.Drawings, 2, createdAt, updatedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	prep := s.mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO canvas_versions (canvas_id, version, width, height, drawings, ` +
+		`created_at) SELECT canvas_id, $2, $3, $4, $5, $6 FROM canvas WHERE name_hash = $1`))
+	prep.ExpectExec().WithArgs(legacyHash("monalisa"), 1, 10, 10, first.Drawings, createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WithArgs(legacyHash("monalisa"), 2, 20, 20, s.model.Drawings, updatedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordAudit("monalisa", illustrator.AuditCreate, nil, sqlmock.AnyArg())
+	s.mock.ExpectCommit()
+
+	err := s.storage.Import(context.Background(), &illustrator.CanvasHistory{
+		Canvas:    current,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+		Versions: []illustrator.CanvasSnapshot{
+			{Version: 1, Canvas: first, CreatedAt: createdAt},
+			{Version: 2, Canvas: current, CreatedAt: updatedAt},
+		},
+	})
+	s.NoError(err)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageImportTestSuite) TestStorageLinkFork() {
+	query := regexp.QuoteMeta(`UPDATE canvas c SET forked_from = p.canvas_id FROM canvas p ` +
+		`WHERE c.name_hash = $1 AND c.deleted_at IS NULL AND p.name_hash = $2 AND p.deleted_at IS NULL`)
+	s.mock.ExpectPrepare(query).ExpectExec().WithArgs(legacyHash("copy"), legacyHash("monalisa")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.storage.LinkFork(context.Background(), "copy", "MonaLisa")
+	s.NoError(err)
+
+	s.mock.ExpectPrepare(query).ExpectExec().WithArgs(legacyHash("copy"), legacyHash("unknown")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = s.storage.LinkFork(context.Background(), "copy", "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- BACKFILL TESTS -----------------
+
+type StorageBackfillTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageBackfillTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageBackfillTestSuite))
+}
+
+func (s *StorageBackfillTestSuite) TestStorageBackfillNames() {
+	query := regexp.QuoteMeta(`UPDATE canvas SET name = $1, display_name = $2, name_hash = $3 WHERE name_hash = $4 AND display_name IS NULL`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(query).ExpectExec().WithArgs("monalisa", "MonaLisa", legacyHash("monalisa"), legacyHash("MonaLisa")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The backfill is audited as rename from the hash stored so far
+	s.expectRecordAudit("monalisa", illustrator.AuditRename, legacyHash("MonaLisa"), nil)
+	s.mock.ExpectCommit()
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(query).ExpectExec().WithArgs("unknown", "unknown", legacyHash("unknown"), legacyHash("unknown")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	count, err := s.storage.BackfillNames(context.Background(), []string{"MonaLisa", "unknown"})
+	s.NoError(err)
+	s.Equal(int64(1), count)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- LIST TESTS -----------------
+
+type StorageListTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageListTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageListTestSuite))
+}
+
+const listSelect = `SELECT COALESCE(display_name, name), name, width, height, ` +
+	`CASE jsonb_typeof(drawings) WHEN 'array' THEN jsonb_array_length(drawings) ELSE 0 END, ` +
+	`created_at, updated_at, (SELECT COALESCE(p.display_name, p.name) FROM canvas p WHERE p.canvas_id = canvas.forked_from) ` +
+	`FROM canvas WHERE deleted_at IS NULL`
+
+func (s *StorageListTestSuite) listRows(names ...string) (rows *sqlmock.Rows) {
+	rows = sqlmock.NewRows([]string{"display_name", "name", "width", "height", "count", "created_at", "updated_at",
+		"forked_from"})
+	for i, name := range names {
+		created := time.Date(2022, 1, i+1, 0, 0, 0, 0, time.UTC)
+		// Every canvas but the first is a fork of the first
+		var forkedFrom interface{}
+		if i > 0 {
+			forkedFrom = names[0]
+		}
+		rows.AddRow(name, name, s.model.Width, s.model.Height, len(s.model.Drawings), created, created, forkedFrom)
+	}
+	return
+}
+
+func (s *StorageListTestSuite) TestStorageList() {
+	query := regexp.QuoteMeta(listSelect + ` ORDER BY name ASC LIMIT $1`)
+	s.mock.ExpectQuery(query).WithArgs(3).WillReturnRows(s.listRows("a", "b", "c"))
+
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{Limit: 2})
+	s.NoError(err)
+	s.Len(page.Canvases, 2)
+	s.Equal("b", page.Canvases[1].Name)
+	s.Equal(len(s.model.Drawings), page.Canvases[1].DrawingCount)
+	s.Empty(page.Canvases[0].ForkedFrom)
+	s.Equal("a", page.Canvases[1].ForkedFrom)
+	s.NotEmpty(page.NextCursor)
+
+	// Next page continues after the last canvas
+	query = regexp.QuoteMeta(listSelect + ` AND name > $1 ORDER BY name ASC LIMIT $2`)
+	s.mock.ExpectQuery(query).WithArgs("b", 3).WillReturnRows(s.listRows("c"))
+
+	page, err = s.storage.List(context.Background(), illustrator.ListOptions{Limit: 2, Cursor: page.NextCursor})
+	s.NoError(err)
+	s.Len(page.Canvases, 1)
+	s.Empty(page.NextCursor)
+}
+
+func (s *StorageListTestSuite) TestStorageListFiltered() {
+	cursor := illustrator.NewListCursor(illustrator.ListSortByUpdated, &illustrator.CanvasInfo{
+		Key:       "b",
+		UpdatedAt: time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+	})
+
+	query := regexp.QuoteMeta(listSelect + ` AND width >= $1 AND height <= $2 AND (updated_at, name) < ($3, $4) ` +
+		`ORDER BY updated_at DESC, name DESC LIMIT $5`)
+	s.mock.ExpectQuery(query).
+		WithArgs(10, 30, time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), "b", illustrator.ListDefaultLimit+1).
+		WillReturnRows(s.listRows("a"))
+
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{
+		Cursor:     cursor,
+		SortBy:     illustrator.ListSortByUpdated,
+		Descending: true,
+		MinWidth:   10,
+		MaxHeight:  30,
+	})
+	s.NoError(err)
+	s.Len(page.Canvases, 1)
+}
+
+func (s *StorageListTestSuite) TestStorageListInvalidCursor() {
+	_, err := s.storage.List(context.Background(), illustrator.ListOptions{Cursor: "not-a-cursor"})
+	s.True(errors.Is(err, illustrator.ErrInvalidCursor))
+}
+
+// ----------------- LAYOUT TESTS -----------------
+
+type StorageLayoutTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageLayoutTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageLayoutTestSuite))
+}
+
+func (s *StorageLayoutTestSuite) SetupSuite() {
+	s.MockStorageSuite.SetupSuite()
+	s.storage.Layout = dba.LayoutNormalized
+}
+
+const normalizedDrawings = `(SELECT COALESCE(jsonb_agg(jsonb_build_object('coordinates', jsonb_build_array(d.x, d.y), ` +
+	`'width', d.width, 'height', d.height, 'fill', d.fill, 'outline', d.outline) ORDER BY d.position), '[]'::jsonb) ` +
+	`FROM drawings d WHERE d.canvas_id = canvas.canvas_id)`
+
+const insertDrawingsQuery = `INSERT INTO drawings (canvas_id, position, x, y, width, height, fill, outline) ` +
+	`SELECT c.canvas_id, e.position - 1, `
+
+func (s *StorageLayoutTestSuite) TestParseDrawingsLayout() {
+	layout, err := dba.ParseDrawingsLayout("")
+	s.NoError(err)
+	s.Equal(dba.LayoutJSONB, layout)
+
+	layout, err = dba.ParseDrawingsLayout("normalized")
+	s.NoError(err)
+	s.Equal(dba.LayoutNormalized, layout)
+
+	_, err = dba.ParseDrawingsLayout("columnar")
+	s.Error(err)
+}
+
+func (s *StorageLayoutTestSuite) TestStorageFindNormalized() {
+	rows := sqlmock.NewRows([]string{"name", "width", "height", "drawings", "revision"}).
+		AddRow(s.model.Name, s.model.Width, s.model.Height, s.model.Drawings, 1)
+	query := regexp.QuoteMeta(`SELECT COALESCE(display_name, name), width, height, ` + normalizedDrawings +
+		`, revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL`)
+	s.mock.ExpectQuery(query).WithArgs(legacyHash(s.model.Name)).WillReturnRows(rows)
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(s.model.Drawings, canvas.Drawings)
+}
+
+func (s *StorageLayoutTestSuite) TestStorageCreateNormalized() {
+	s.mock.ExpectBegin()
+	// The drawings column stays empty
+	s.mock.ExpectPrepare(regexp.QuoteMeta(createQuery)).ExpectExec().
+		WithArgs("monalisa", "monalisa", legacyHash("monalisa"), s.model.Width, s.model.Height, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`DELETE FROM drawings WHERE canvas_id = ` +
+		`(SELECT canvas_id FROM canvas WHERE name_hash = $1)`)).ExpectExec().
+		WithArgs(legacyHash("monalisa")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectPrepare(regexp.QuoteMeta(insertDrawingsQuery)).ExpectExec().
+		WithArgs(legacyHash("monalisa"), s.model.Drawings).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO canvas_versions`)).ExpectExec().
+		WithArgs(legacyHash("monalisa")).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordAudit("monalisa", illustrator.AuditCreate, nil, illustrator.DrawingsDiff{Added: 1})
+	s.mock.ExpectCommit()
+
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageLayoutTestSuite) TestStorageRemoveDrawingNormalized() {
+	s.mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"canvas_id", "revision", "count"}).AddRow(7, 2, 1)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT canvas_id, revision, (SELECT COUNT(*) FROM drawings d ` +
+		`WHERE d.canvas_id = canvas.canvas_id) FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL FOR UPDATE`)).
+		WithArgs(legacyHash(s.model.Name)).WillReturnRows(rows)
+	// Only the rows of the canvas are touched
+	s.mock.ExpectExec(regexp.QuoteMeta(`WITH removed AS (DELETE FROM drawings WHERE canvas_id = $1 AND position = $2) `+
+		`UPDATE drawings SET position = position - 1 WHERE canvas_id = $1 AND position > $2`)).
+		WithArgs(int64(7), 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`UPDATE canvas SET revision = revision + 1, updated_at = now() WHERE name_hash = $1 ` +
+		`RETURNING COALESCE(display_name, name), width, height, ` + normalizedDrawings + `, revision`)).
+		WithArgs(legacyHash(s.model.Name)).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "width", "height", "drawings", "revision"}).
+			AddRow(s.model.Name, s.model.Width, s.model.Height, illustrator.DrawingSlice{}, 3))
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO canvas_versions`)).ExpectExec().
+		WithArgs(legacyHash(s.model.Name)).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordAudit(s.model.Name, illustrator.AuditUpdate, nil, illustrator.DrawingsDiff{Removed: 1})
+	s.mock.ExpectCommit()
+
+	canvas, err := s.storage.RemoveDrawing(context.Background(), s.model.Name, 2, 0, nil)
+	s.NoError(err)
+	s.Equal(3, canvas.Revision)
+	s.Empty(canvas.Drawings)
+}
+
+func (s *StorageLayoutTestSuite) TestStorageConvertDrawings() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM canvas WHERE drawings IS NOT NULL)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`LOCK TABLE canvas IN EXCLUSIVE MODE`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(regexp.QuoteMeta(insertDrawingsQuery)).WillReturnResult(sqlmock.NewResult(0, 12))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE canvas SET drawings = NULL WHERE drawings IS NOT NULL`)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	s.mock.ExpectCommit()
+
+	count, err := s.storage.ConvertDrawings(context.Background())
+	s.NoError(err)
+	s.Equal(int64(3), count)
+
+	// Nothing left to convert
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS`)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	count, err = s.storage.ConvertDrawings(context.Background())
+	s.NoError(err)
+	s.Zero(count)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+const convertToJSONBCheck = `SELECT EXISTS (SELECT 1 FROM drawings) OR EXISTS (SELECT 1 FROM canvas WHERE drawings IS NULL)`
+
+func (s *StorageLayoutTestSuite) TestStorageConvertEmptyCanvasToJSONB() {
+	// Created in the normalized layout, the canvas has neither drawing rows
+	// nor an array
+	empty := illustrator.CanvasModel{Name: "empty", Width: 5, Height: 5}
+	s.mock.ExpectBegin()
+	s.mock.ExpectPrepare(regexp.QuoteMeta(createQuery)).ExpectExec().
+		WithArgs("empty", "empty", legacyHash("empty"), 5, 5, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`DELETE FROM drawings WHERE canvas_id = `)).ExpectExec().
+		WithArgs(legacyHash("empty")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectPrepare(regexp.QuoteMeta(insertDrawingsQuery)).ExpectExec().
+		WithArgs(legacyHash("empty"), empty.Drawings).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO canvas_versions`)).ExpectExec().
+		WithArgs(legacyHash("empty")).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.expectRecordAudit("empty", illustrator.AuditCreate, nil, illustrator.DrawingsDiff{})
+	s.mock.ExpectCommit()
+	s.NoError(s.storage.Create(context.Background(), &empty))
+
+	// Switched back to JSONB the canvas gets its empty array
+	storage := s.storage
+	storage.Layout = dba.LayoutJSONB
+	s.mock.ExpectQuery(regexp.QuoteMeta(convertToJSONBCheck)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`LOCK TABLE canvas IN EXCLUSIVE MODE`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE canvas SET drawings = ` + normalizedDrawings + ` WHERE drawings IS NULL`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM drawings`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	count, err := storage.ConvertDrawings(context.Background())
+	s.NoError(err)
+	s.Equal(int64(1), count)
+
+	rows := sqlmock.NewRows([]string{"name", "width", "height", "drawings", "revision"}).AddRow("empty", 5, 5, "[]", 1)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(display_name, name), width, height, drawings, revision FROM canvas`)).
+		WithArgs(legacyHash("empty")).WillReturnRows(rows)
+	canvas, err := storage.FindByName(context.Background(), "empty")
+	s.NoError(err)
+	s.Empty(canvas.Drawings)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageLayoutTestSuite) TestStorageConvertDrawingsToJSONB() {
+	storage := s.storage
+	storage.Layout = dba.LayoutJSONB
+
+	s.mock.ExpectQuery(regexp.QuoteMeta(convertToJSONBCheck)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`LOCK TABLE canvas IN EXCLUSIVE MODE`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE canvas SET drawings = ` + normalizedDrawings + ` WHERE drawings IS NULL`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM drawings`)).WillReturnResult(sqlmock.NewResult(0, 12))
+	s.mock.ExpectCommit()
+
+	count, err := storage.ConvertDrawings(context.Background())
+	s.NoError(err)
+	s.Equal(int64(2), count)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- TIMEOUT TESTS -----------------
+
+type StorageTimeoutTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageTimeoutTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTimeoutTestSuite))
+}
+
+func (s *StorageTimeoutTestSuite) SetupSuite() {
+	s.MockStorageSuite.SetupSuite()
+	s.storage.Timeout = 10 * time.Millisecond
+}
+
+// Connections of cancelled queries are closed by database/sql right away
+func (s *StorageTimeoutTestSuite) TearDownSuite() {
+	s.storage.Close()
+}
+
+func (s *StorageTimeoutTestSuite) TestStorageFindTimeout() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(display_name, name)`)).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	_, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrTimeout))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageTimeoutTestSuite) TestStorageUpdateTimeout() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(2))
+	// The transaction is rolled back by database/sql once the deadline passed
+
+	_, err := s.storage.Update(context.Background(), &s.model)
+	s.True(errors.Is(err, illustrator.ErrTimeout))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageTimeoutTestSuite) TestStorageCancelled() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(display_name, name)`)).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	// Cancelled requests are not timeouts
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond, cancel)
+	_, err := s.storage.FindByName(ctx, s.model.Name)
+	s.Error(err)
+	s.False(errors.Is(err, illustrator.ErrTimeout))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- TX TESTS -----------------
+
+type StorageTxTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageTxTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTxTestSuite))
+}
+
+func (s *StorageTxTestSuite) expectFind(revision int) {
+	rows := sqlmock.NewRows([]string{"name", "width", "height", "drawings", "revision"}).
+		AddRow(s.model.Name, s.model.Width, s.model.Height, s.model.Drawings, revision)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(display_name, name)`)).WillReturnRows(rows)
+}
+
+// readModifyWrite widens the canvas found within the transaction
+func (s *StorageTxTestSuite) readModifyWrite(tx illustrator.CanvasStorage) (err error) {
+	canvas, err := tx.FindByName(context.Background(), s.model.Name)
+	if err != nil {
+		return
+	}
+	canvas.Width++
+	_, err = tx.Update(context.Background(), canvas)
+	return
+}
+
+func (s *StorageTxTestSuite) TestStorageWithTx() {
+	// The calls of fn join its transaction
+	s.mock.ExpectBegin()
+	s.expectFind(2)
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).
+		WithArgs(s.model.Name, s.model.Name, s.model.Width+1, s.model.Height, s.model.Drawings, legacyHash(s.model.Name), 2).
+		WillReturnRows(updateRows(3, s.model.Drawings))
+	s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{})
+	s.mock.ExpectCommit()
+
+	err := s.storage.WithTx(context.Background(), s.readModifyWrite)
+	s.NoError(err)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageTxTestSuite) TestStorageWithTxRollback() {
+	s.mock.ExpectBegin()
+	s.expectFind(2)
+	s.mock.ExpectRollback()
+
+	failure := errors.New("failure")
+	err := s.storage.WithTx(context.Background(), func(tx illustrator.CanvasStorage) (err error) {
+		if _, err = tx.FindByName(context.Background(), s.model.Name); err != nil {
+			return
+		}
+		// Nested transactions join the outer one
+		return tx.WithTx(context.Background(), func(nested illustrator.CanvasStorage) error {
+			return failure
+		})
+	})
+	s.True(errors.Is(err, failure))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageTxTestSuite) TestStorageWithTxRetry() {
+	// Transactions failing to serialize are run again
+	s.mock.ExpectBegin()
+	s.expectFind(2)
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnError(&pq.Error{Code: "40001"})
+	s.mock.ExpectRollback()
+	s.mock.ExpectBegin()
+	s.expectFind(3)
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(updateRows(4, s.model.Drawings))
+	s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{})
+	s.mock.ExpectCommit()
+
+	err := s.storage.WithTx(context.Background(), s.readModifyWrite)
+	s.NoError(err)
+
+	// Up to three times, the failure is reported as conflict then
+	for i := 0; i < 3; i++ {
+		s.mock.ExpectBegin()
+		s.expectFind(4)
+		s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(updateRows(5, s.model.Drawings))
+		s.expectRecordChange(s.model.Name, illustrator.AuditUpdate, illustrator.DrawingsDiff{})
+		s.mock.ExpectCommit().WillReturnError(&pq.Error{Code: "40001"})
+	}
+
+	err = s.storage.WithTx(context.Background(), s.readModifyWrite)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageTxTestSuite) TestStorageWithTxRevisionConflict() {
+	// Revision conflicts are not retried
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(sqlmock.NewRows([]string{"revision"}))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(4))
+	s.mock.ExpectRollback()
+
+	canvas := s.model
+	canvas.Revision = 3
+	err := s.storage.WithTx(context.Background(), func(tx illustrator.CanvasStorage) (err error) {
+		_, err = tx.Update(context.Background(), &canvas)
+		return
+	})
+	s.True(errors.Is(err, illustrator.ErrConflict))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- AUDIT TESTS -----------------
+
+type StorageAuditTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageAuditTestSuite))
+}
+
+func (s *StorageAuditTestSuite) TestStorageRecordAudit() {
+	// The actor of the context is recorded with the drawings changed
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(updateQuery)).WillReturnRows(updateRows(2, illustrator.DrawingSlice{}))
+	s.expectRecordVersion(s.model.Name)
+	s.mock.ExpectPrepare(regexp.QuoteMeta(recordAuditQuery)).ExpectExec().
+		WithArgs(legacyHash(s.model.Name), "update", nil, "leonardo", "f3a1", illustrator.DrawingsDiff{Added: 1}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	ctx := illustrator.ContextWithActor(context.Background(), illustrator.Actor{Name: "leonardo", RequestID: "f3a1"})
+	_, err := s.storage.Update(ctx, &s.model)
+	s.NoError(err)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+const (
+	auditedCanvasQuery = `SELECT canvas_id, deleted_at IS NOT NULL FROM canvas WHERE name_hash = $1`
+	purgedCanvasQuery  = `SELECT canvas_id FROM canvas_audit WHERE action = 'purge' AND lower(btrim(name)) = $1 ` +
+		`ORDER BY audit_id DESC LIMIT 1`
+	listAuditQuery = `SELECT action, name, previous_name, actor, request_id, revision, diff, created_at ` +
+		`FROM canvas_audit WHERE canvas_id = $1 ORDER BY audit_id`
+)
+
+var auditColumns = []string{"action", "name", "previous_name", "actor", "request_id", "revision", "diff", "created_at"}
+
+func (s *StorageAuditTestSuite) TestStorageListAudit() {
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.mock.ExpectQuery(regexp.QuoteMeta(auditedCanvasQuery)).WithArgs(legacyHash(s.model.Name)).
+		WillReturnRows(sqlmock.NewRows([]string{"canvas_id", "trashed"}).AddRow(7, false))
+	rows := sqlmock.NewRows(auditColumns).
+		AddRow("create", "MonaLisa", nil, "leonardo", "f3a1", 1, `{"added": 1, "removed": 0, "changed": 0}`, createdAt).
+		AddRow("rename", "Gioconda", "MonaLisa", "system", "", 2, nil, createdAt)
+	s.mock.ExpectQuery(regexp.QuoteMeta(listAuditQuery)).WithArgs(7).WillReturnRows(rows)
+
+	entries, err := s.storage.ListAudit(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal([]illustrator.AuditEntry{
+		{Action: illustrator.AuditCreate, Name: "MonaLisa", Actor: "leonardo", RequestID: "f3a1", Revision: 1,
+			Diff: &illustrator.DrawingsDiff{Added: 1}, CreatedAt: createdAt},
+		{Action: illustrator.AuditRename, Name: "Gioconda", PreviousName: "MonaLisa", Actor: "system", Revision: 2,
+			CreatedAt: createdAt},
+	}, entries)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageAuditTestSuite) TestStorageListAuditEmpty() {
+	// Canvases stored before changes were audited have no entries
+	s.mock.ExpectQuery(regexp.QuoteMeta(auditedCanvasQuery)).WithArgs(legacyHash(s.model.Name)).
+		WillReturnRows(sqlmock.NewRows([]string{"canvas_id", "trashed"}).AddRow(7, false))
+	s.mock.ExpectQuery(regexp.QuoteMeta(listAuditQuery)).WithArgs(7).WillReturnRows(sqlmock.NewRows(auditColumns))
+
+	entries, err := s.storage.ListAudit(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Empty(entries)
+
+	// Canvases in the trash are not found
+	s.mock.ExpectQuery(regexp.QuoteMeta(auditedCanvasQuery)).WithArgs(legacyHash(s.model.Name)).
+		WillReturnRows(sqlmock.NewRows([]string{"canvas_id", "trashed"}).AddRow(7, true))
+
+	_, err = s.storage.ListAudit(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	s.mock.ExpectQuery(regexp.QuoteMeta(auditedCanvasQuery)).WithArgs(legacyHash("unknown")).
+		WillReturnRows(sqlmock.NewRows([]string{"canvas_id", "trashed"}))
+	s.mock.ExpectQuery(regexp.QuoteMeta(purgedCanvasQuery)).WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"canvas_id"}))
+
+	_, err = s.storage.ListAudit(context.Background(), "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageAuditTestSuite) TestStorageListAuditPurged() {
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// The log of the canvas last purged under the name outlives it
+	s.mock.ExpectQuery(regexp.QuoteMeta(auditedCanvasQuery)).WithArgs(legacyHash("monalisa")).
+		WillReturnRows(sqlmock.NewRows([]string{"canvas_id", "trashed"}))
+	s.mock.ExpectQuery(regexp.QuoteMeta(purgedCanvasQuery)).WithArgs("monalisa").
+		WillReturnRows(sqlmock.NewRows([]string{"canvas_id"}).AddRow(7))
+	rows := sqlmock.NewRows(auditColumns).
+		AddRow("delete", "MonaLisa", nil, "leonardo", "", 3, nil, createdAt).
+		AddRow("purge", "MonaLisa", nil, "system", "", 3, nil, createdAt)
+	s.mock.ExpectQuery(regexp.QuoteMeta(listAuditQuery)).WithArgs(7).WillReturnRows(rows)
+
+	entries, err := s.storage.ListAudit(context.Background(), "MonaLisa")
+	s.NoError(err)
+	s.Require().Len(entries, 2)
+	s.Equal(illustrator.AuditPurge, entries[1].Action)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+// ----------------- OUTBOX TESTS -----------------
+
+type StorageOutboxTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageOutboxTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageOutboxTestSuite))
+}
+
+func (s *StorageOutboxTestSuite) TestStorageClaimEvents() {
+	query := regexp.QuoteMeta(`UPDATE canvas_outbox SET next_attempt_at = now() + $2 * interval '1 millisecond' ` +
+		`WHERE event_id IN (SELECT event_id FROM canvas_outbox WHERE next_attempt_at <= now() ` +
+		`ORDER BY event_id LIMIT $1 FOR UPDATE SKIP LOCKED) ` +
+		`RETURNING event_id, action, name, previous_name, revision, actor, request_id, occurred_at, attempts`)
+	occurredAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"event_id", "action", "name", "previous_name", "revision", "actor", "request_id",
+		"occurred_at", "attempts"}).
+		AddRow(8, "rename", "Gioconda", "MonaLisa", 3, "leonardo", "f3a1", occurredAt, 0).
+		AddRow(7, "create", "MonaLisa", nil, 1, "system", "", occurredAt, 2)
+	s.mock.ExpectQuery(query).WithArgs(100, int64(60000)).WillReturnRows(rows)
+
+	// Events come oldest first
+	events, err := s.storage.ClaimEvents(context.Background(), 100, time.Minute)
+	s.NoError(err)
+	s.Equal([]illustrator.ChangeEvent{
+		{ID: 7, Action: illustrator.AuditCreate, Name: "MonaLisa", Revision: 1, Actor: "system", OccurredAt: occurredAt,
+			Attempts: 2},
+		{ID: 8, Action: illustrator.AuditRename, Name: "Gioconda", PreviousName: "MonaLisa", Revision: 3, Actor: "leonardo",
+			RequestID: "f3a1", OccurredAt: occurredAt},
+	}, events)
+}
+
+func (s *StorageOutboxTestSuite) TestStorageMarkDelivered() {
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM canvas_outbox WHERE event_id = $1`)).WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.NoError(s.storage.MarkDelivered(context.Background(), 7))
+}
+
+func (s *StorageOutboxTestSuite) TestStorageRetryEvent() {
+	at := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE canvas_outbox SET attempts = attempts + 1, next_attempt_at = $2, `+
+		`last_error = $3 WHERE event_id = $1`)).WithArgs(int64(7), at, "unavailable").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.NoError(s.storage.RetryEvent(context.Background(), 7, at, "unavailable"))
+}
+
+// ----------------- WEBHOOK TESTS -----------------
+
+type StorageWebhookTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageWebhookTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageWebhookTestSuite))
+}
+
+func (s *StorageWebhookTestSuite) TestStorageCreateWebhook() {
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO webhooks (url, events, secret) VALUES ($1, $2, $3) `+
+		`RETURNING webhook_id, created_at`)).WithArgs("http://bot/hook", `{"create","update"}`, "s3cr3t").
+		WillReturnRows(sqlmock.NewRows([]string{"webhook_id", "created_at"}).AddRow(3, createdAt))
+
+	webhook := illustrator.Webhook{URL: "http://bot/hook", Secret: "s3cr3t",
+		Events: []illustrator.AuditAction{illustrator.AuditCreate, illustrator.AuditUpdate}}
+	s.NoError(s.storage.CreateWebhook(context.Background(), &webhook))
+	s.Equal(int64(3), webhook.ID)
+	s.Equal(createdAt, webhook.CreatedAt)
+}
+
+func (s *StorageWebhookTestSuite) TestStorageListWebhooks() {
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"webhook_id", "url", "events", "secret", "created_at"}).
+		AddRow(1, "http://bot/hook", "{}", "s3cr3t", createdAt).
+		AddRow(2, "http://indexer/hook", "{delete,purge}", "other", createdAt)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT webhook_id, url, events, secret, created_at FROM webhooks ` +
+		`ORDER BY webhook_id`)).WillReturnRows(rows)
+
+	webhooks, err := s.storage.ListWebhooks(context.Background())
+	s.NoError(err)
+	s.Equal([]illustrator.Webhook{
+		{ID: 1, URL: "http://bot/hook", Secret: "s3cr3t", CreatedAt: createdAt},
+		{ID: 2, URL: "http://indexer/hook", Events: []illustrator.AuditAction{illustrator.AuditDelete, illustrator.AuditPurge},
+			Secret: "other", CreatedAt: createdAt},
+	}, webhooks)
+}
+
+func (s *StorageWebhookTestSuite) TestStorageDeleteWebhook() {
+	query := regexp.QuoteMeta(`DELETE FROM webhooks WHERE webhook_id = $1`)
+	s.mock.ExpectExec(query).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.NoError(s.storage.DeleteWebhook(context.Background(), 3))
+
+	s.mock.ExpectExec(query).WithArgs(int64(4)).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.storage.DeleteWebhook(context.Background(), 4)
+	s.True(errors.Is(err, illustrator.ErrWebhookNotFound))
+}
+
+func (s *StorageWebhookTestSuite) TestStorageRecordWebhookDelivery() {
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO webhook_deliveries (webhook_id, event_id, action, name, attempt, `+
+		`status_code, error, delivered, duration_ms) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING delivery_id, created_at`)).
+		WithArgs(int64(3), int64(7), "update", "MonaLisa", 1, 503, "webhook responded 503", false, int64(12)).
+		WillReturnRows(sqlmock.NewRows([]string{"delivery_id", "created_at"}).AddRow(9, createdAt))
+
+	delivery := illustrator.WebhookDelivery{WebhookID: 3, EventID: 7, Action: illustrator.AuditUpdate, Name: "MonaLisa",
+		Attempt: 1, StatusCode: 503, Error: "webhook responded 503", DurationMsec: 12}
+	s.NoError(s.storage.RecordWebhookDelivery(context.Background(), &delivery))
+	s.Equal(int64(9), delivery.ID)
+	s.Equal(createdAt, delivery.CreatedAt)
+}
+
+func (s *StorageWebhookTestSuite) TestStorageListWebhookDeliveries() {
+	query := regexp.QuoteMeta(`SELECT delivery_id, webhook_id, event_id, action, name, attempt, status_code, error, ` +
+		`delivered, duration_ms, created_at FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY delivery_id DESC LIMIT $2`)
+	columns := []string{"delivery_id", "webhook_id", "event_id", "action", "name", "attempt", "status_code", "error",
+		"delivered", "duration_ms", "created_at"}
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.mock.ExpectQuery(query).WithArgs(int64(3), 100).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(9, 3, 7, "update", "MonaLisa", 2, 204, "", true, 12, createdAt))
+
+	deliveries, err := s.storage.ListWebhookDeliveries(context.Background(), 3, 100)
+	s.NoError(err)
+	s.Equal([]illustrator.WebhookDelivery{{ID: 9, WebhookID: 3, EventID: 7, Action: illustrator.AuditUpdate,
+		Name: "MonaLisa", Attempt: 2, StatusCode: 204, Delivered: true, DurationMsec: 12, CreatedAt: createdAt}}, deliveries)
+
+	// Webhooks without deliveries are told from unknown ones
+	existsQuery := regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM webhooks WHERE webhook_id = $1)`)
+	s.mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows(columns))
+	s.mock.ExpectQuery(existsQuery).WithArgs(int64(4)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	_, err = s.storage.ListWebhookDeliveries(context.Background(), 4, 100)
+	s.True(errors.Is(err, illustrator.ErrWebhookNotFound))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageWebhookTestSuite) TestStorageWebhookDelivered() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM webhook_deliveries `+
+		`WHERE webhook_id = $1 AND event_id = $2 AND delivered)`)).WithArgs(int64(3), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	ok, err := s.storage.WebhookDelivered(context.Background(), 3, 7)
+	s.NoError(err)
+	s.True(ok)
+}
+
+// ----------------- CONFIG TESTS -----------------
+
+type StorageConfigTestSuite struct {
+	suite.Suite
+}
+
+func TestStorageConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageConfigTestSuite))
+}
+
+func (s *StorageConfigTestSuite) TestDSN() {
+	conn := dba.ConnConfig{Host: "postgres", Port: "5432", User: "postgres", Password: "root", Database: "postgres"}
+	s.Equal("host=postgres port=5432 user=postgres password=root dbname=postgres sslmode=disable", conn.DSN())
+
+	// Values with spaces, quotes or backslashes are quoted
+	conn = dba.ConnConfig{Host: "db", Password: `it's a \secret`, SSLMode: "verify-full", ApplicationName: "illustrator"}
+	s.Equal(`host=db password='it\'s a \\secret' sslmode=verify-full application_name=illustrator`, conn.DSN())
+}
+
+func (s *StorageConfigTestSuite) TestConnect() {
+	_, mock, err := sqlmock.NewWithDSN("connect", sqlmock.MonitorPingsOption(true))
+	s.Require().NoError(err)
+
+	// The database comes up with the second attempt
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing()
+
+	db, err := dba.Connect(context.Background(), "sqlmock", "connect", dba.PoolConfig{MaxOpenConns: 4}, time.Second)
+	s.Require().NoError(err)
+	s.Equal(4, db.Stats().MaxOpenConnections)
+	s.NoError(mock.ExpectationsWereMet())
+
+	storage := dba.Storage{DB: db}
+	stats := storage.PoolStats()
+	s.Equal(4, stats.MaxOpenConnections)
+	s.Equal(1, stats.OpenConnections)
+	mock.ExpectClose()
+	s.NoError(db.Close())
+}
+
+func (s *StorageConfigTestSuite) TestConnectTimeout() {
+	_, mock, err := sqlmock.NewWithDSN("timeout", sqlmock.MonitorPingsOption(true))
+	s.Require().NoError(err)
+
+	// Without startup timeout the database is tried once
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectClose()
+
+	_, err = dba.Connect(context.Background(), "sqlmock", "timeout", dba.PoolConfig{}, 0)
+	s.Error(err)
+	s.Contains(err.Error(), "connection refused")
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+// ----------------- MIGRATE TESTS -----------------
+
+type StorageMigrateTestSuite struct {
+	MockStorageSuite
+}
+
+func TestStorageMigrateTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageMigrateTestSuite))
+}
+
+func (s *StorageMigrateTestSuite) expectLockAndVersion(version int) {
+	s.mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_version`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version"}).AddRow(version)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MAX(version), 0) FROM schema_version`)).WillReturnRows(rows)
+}
+
+func (s *StorageMigrateTestSuite) expectUnlock() {
+	s.mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func (s *StorageMigrateTestSuite) TestStorageMigrate() {
+	files, err := filepath.Glob("../migrations/*.sql")
+	s.NoError(err)
+	s.NotEmpty(files)
+
+	s.expectLockAndVersion(0)
+	for i, file := range files {
+		migration, err := os.ReadFile(file)
+		s.NoError(err)
+
+		// Files are named <version>_<name>.sql with versions starting at 1
+		name := strings.TrimSuffix(filepath.Base(file), ".sql")
+		s.True(strings.HasPrefix(name, fmt.Sprintf("%04d_", i+1)))
+
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec(regexp.QuoteMeta(string(migration))).WillReturnResult(sqlmock.NewResult(0, 0))
+		s.mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO schema_version (version, name) VALUES ($1, $2)`)).
+			WithArgs(i+1, name[5:]).WillReturnResult(sqlmock.NewResult(0, 1))
+		s.mock.ExpectCommit()
+	}
+	s.expectUnlock()
+
+	s.NoError(s.storage.Migrate(context.Background()))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageMigrateTestSuite) TestStorageMigrateUpToDate() {
+	s.expectLockAndVersion(math.MaxInt32)
+	s.expectUnlock()
+
+	s.NoError(s.storage.Migrate(context.Background()))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *StorageMigrateTestSuite) TestStorageMigrateFailure() {
+	s.expectLockAndVersion(0)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS canvas`)).WillReturnError(errors.New("syntax error"))
+	s.mock.ExpectRollback()
+	s.expectUnlock()
 
-	s.Equal(count, rowsAffected)
+	s.Error(s.storage.Migrate(context.Background()))
+	s.NoError(s.mock.ExpectationsWereMet())
 }
@@ -0,0 +1,98 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Records the purge of each canvas of the purged statement in its audit log
+// and as change event, so the number of rows affected is the number of
+// canvases purged
+const purgeEventsStatement = ", entry AS (" +
+	"INSERT INTO canvas_audit (canvas_id, action, name, actor, request_id, revision) " +
+	"SELECT canvas_id, $2, name, $3, $4, revision FROM purged " +
+	"RETURNING action, name, revision, actor, request_id, created_at) " +
+	"INSERT INTO canvas_outbox (action, name, revision, actor, request_id, occurred_at) " +
+	"SELECT action, name, revision, actor, request_id, created_at FROM entry"
+
+// ListTrash returns the trashed canvases, most recently deleted first
+func (s *Storage) ListTrash(ctx context.Context) (canvases []illustrator.TrashedCanvas, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT COALESCE(display_name, name), name, width, height, "+
+		s.drawingCountOf("")+", deleted_at "+
+		"FROM canvas WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, name")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	canvases = []illustrator.TrashedCanvas{}
+	for rows.Next() {
+		var canvas illustrator.TrashedCanvas
+		err = rows.Scan(&canvas.Name, &canvas.Key, &canvas.Width, &canvas.Height, &canvas.DrawingCount, &canvas.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		canvases = append(canvases, canvas)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Undelete restores a canvas from the trash as it was when deleted
+func (s *Storage) Undelete(ctx context.Context, name string) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	return s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		res, err := execPrepared(ctx, tx, "UPDATE canvas SET deleted_at = NULL WHERE name_hash = $1 AND deleted_at IS NOT NULL",
+			illustrator.CanvasKeyHash(name))
+		if err != nil {
+			return
+		}
+		if err = requireAffected(res, illustrator.ErrCanvasNotFound); err != nil {
+			return
+		}
+		return recordAudit(ctx, tx, name, illustrator.AuditEntry{Action: illustrator.AuditUndelete})
+	})
+}
+
+// Purge permanently removes a trashed canvas together with its versions. The
+// purge is recorded in the audit log, which is kept, and as change event.
+func (s *Storage) Purge(ctx context.Context, name string) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	actor := illustrator.ActorFromContext(ctx)
+	res, err := execPrepared(ctx, s.conn(), "WITH purged AS ("+
+		"DELETE FROM canvas WHERE name_hash = $1 AND deleted_at IS NOT NULL "+
+		"RETURNING canvas_id, COALESCE(display_name, name) AS name, revision)"+
+		purgeEventsStatement, illustrator.CanvasKeyHash(name), string(illustrator.AuditPurge), actor.Name, actor.RequestID)
+	if err != nil {
+		return
+	}
+	return requireAffected(res, illustrator.ErrCanvasNotFound)
+}
+
+// PurgeTrash permanently removes the canvases trashed before the given time,
+// recording each purge like Purge does
+func (s *Storage) PurgeTrash(ctx context.Context, deletedBefore time.Time) (count int64, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	actor := illustrator.ActorFromContext(ctx)
+	res, err := s.conn().ExecContext(ctx, "WITH purged AS ("+
+		"DELETE FROM canvas WHERE deleted_at < $1 RETURNING canvas_id, COALESCE(display_name, name) AS name, revision)"+
+		purgeEventsStatement, deletedBefore, string(illustrator.AuditPurge), actor.Name, actor.RequestID)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,115 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Number of times the unit of work of WithTx is run when its transaction
+// fails to serialize with concurrent ones
+const txAttempts int = 3
+
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// querier runs statements either on the database or within a transaction
+type querier interface {
+	preparer
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction of WithTx the storage is bound to, the database otherwise
+func (s *Storage) conn() (q querier) {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+// WithTx runs fn within a serializable transaction, committed when fn
+// succeeds. Transactions failing to serialize with concurrent ones are run
+// again, up to txAttempts times, before ErrConflict is returned. A failed
+// statement aborts the transaction, so fn should return the errors of the
+// storage rather than carry on. Calls nested in fn join its transaction.
+func (s *Storage) WithTx(ctx context.Context, fn illustrator.TxFunc) (err error) {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	for attempt := 1; ; attempt++ {
+		err = s.runTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) error {
+			bound := *s
+			bound.tx = tx
+			return fn(&bound)
+		})
+		if attempt < txAttempts && isSerializationFailure(err) {
+			continue
+		}
+		return
+	}
+}
+
+// inTx runs fn within a transaction, committed when fn succeeds. Storages
+// bound to the transaction of WithTx run fn within that transaction.
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.runTx(ctx, nil, fn)
+}
+
+// runTx begins a transaction with the given options and runs fn within it,
+// committed when fn succeeds
+func (s *Storage) runTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := s.BeginTx(ctx, opts)
+	if err != nil {
+		return
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+// execPrepared prepares and executes a statement, either on the database or within a transaction
+func execPrepared(ctx context.Context, p preparer, query string, args ...interface{}) (res sql.Result, err error) {
+	stmt, err := p.PrepareContext(ctx, query)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+// withTimeout bounds an operation by the query timeout of the storage, unless
+// the context ends earlier. The returned func releases the context and reports
+// the error of an operation which ran out of time as ErrTimeout, the other
+// errors as translated by translateError.
+func (s *Storage) withTimeout(ctx context.Context, err *error) (timeoutCtx context.Context, done func()) {
+	timeoutCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.Timeout > 0 {
+		timeoutCtx, cancel = context.WithTimeout(ctx, s.Timeout)
+	}
+
+	return timeoutCtx, func() {
+		if *err != nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+			*err = fmt.Errorf("%w: %v", illustrator.ErrTimeout, *err)
+		} else {
+			*err = translateError(*err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,127 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Copies the current content of a canvas into a new version, the lock taken
+// on the canvas row by the preceding write serializes version numbers.
+// Versions keep their drawings as JSONB array in either layout.
+func (s *Storage) recordVersion(ctx context.Context, tx *sql.Tx, name string) (err error) {
+	_, err = execPrepared(ctx, tx, "INSERT INTO canvas_versions (canvas_id, version, width, height, drawings) "+
+		"SELECT c.canvas_id, (SELECT COALESCE(MAX(v.version), 0) + 1 FROM canvas_versions v WHERE v.canvas_id = c.canvas_id), "+
+		"c.width, c.height, "+s.drawingsOf("c")+" FROM canvas c WHERE c.name_hash = $1",
+		illustrator.CanvasKeyHash(name))
+	return
+}
+
+func (s *Storage) ListVersions(ctx context.Context, name string) (versions []illustrator.CanvasVersion, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT v.version, v.width, v.height, "+
+		"CASE jsonb_typeof(v.drawings) WHEN 'array' THEN jsonb_array_length(v.drawings) ELSE 0 END, v.created_at "+
+		"FROM canvas_versions v JOIN canvas c ON c.canvas_id = v.canvas_id WHERE c.name_hash = $1 AND c.deleted_at IS NULL "+
+		"ORDER BY v.version",
+		illustrator.CanvasKeyHash(name))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version illustrator.CanvasVersion
+		err = rows.Scan(&version.Version, &version.Width, &version.Height, &version.DrawingCount, &version.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Every canvas has at least one version
+	if len(versions) == 0 {
+		err = illustrator.ErrCanvasNotFound
+	}
+	return
+}
+
+func (s *Storage) FindVersion(ctx context.Context, name string, version int) (canvas *illustrator.CanvasModel, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	canvas = &illustrator.CanvasModel{}
+	err = s.conn().QueryRowContext(ctx, "SELECT COALESCE(c.display_name, c.name), v.width, v.height, v.drawings "+
+		"FROM canvas_versions v JOIN canvas c ON c.canvas_id = v.canvas_id "+
+		"WHERE c.name_hash = $1 AND c.deleted_at IS NULL AND v.version = $2",
+		illustrator.CanvasKeyHash(name), version).
+		Scan(&canvas.Name, &canvas.Width, &canvas.Height, &canvas.Drawings)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, illustrator.ErrVersionNotFound
+	}
+	return
+}
+
+// RestoreVersion overwrites the canvas with the content of one of its versions,
+// which is recorded as a new version. When a revision is given the restore only
+// applies to that revision, otherwise ErrConflict is returned.
+func (s *Storage) RestoreVersion(ctx context.Context, name string, revision int, version int) (newRevision int, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	drawings := "drawings = v.drawings, "
+	if s.normalized() {
+		drawings = ""
+	}
+
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		// The sub-select sees the drawings as they were before the restore
+		var previous, restored illustrator.DrawingSlice
+		err = tx.QueryRowContext(ctx, "UPDATE canvas c SET width = v.width, height = v.height, "+
+			drawings+"revision = c.revision + 1, updated_at = now() FROM canvas_versions v "+
+			"WHERE v.canvas_id = c.canvas_id AND c.name_hash = $1 AND c.deleted_at IS NULL AND v.version = $2 "+
+			"AND ($3 = 0 OR c.revision = $3) RETURNING c.revision, (SELECT "+s.drawingsArrayOf("p")+" FROM canvas p WHERE p.canvas_id = c.canvas_id), "+
+			"COALESCE(v.drawings, '[]'::jsonb)",
+			illustrator.CanvasKeyHash(name), version, revision).
+			Scan(&newRevision, &previous, &restored)
+		if errors.Is(err, sql.ErrNoRows) {
+			return missingVersionError(ctx, tx, name, revision)
+		}
+		if err != nil {
+			return
+		}
+		err = s.writeDrawings(ctx, tx, "(SELECT v.drawings FROM canvas_versions v WHERE v.canvas_id = c.canvas_id AND v.version = $2)",
+			illustrator.CanvasKeyHash(name), version)
+		if err != nil {
+			return
+		}
+		return s.recordChange(ctx, tx, name, illustrator.AuditUpdate, illustrator.DiffDrawings(previous, restored))
+	})
+	return
+}
+
+// missingVersionError tells a revision conflict apart from a missing canvas or
+// version once a restore matched no row
+func missingVersionError(ctx context.Context, tx *sql.Tx, name string, revision int) (err error) {
+	if revision == 0 {
+		return illustrator.ErrVersionNotFound
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, "SELECT revision FROM canvas WHERE name_hash = $1 AND deleted_at IS NULL",
+		illustrator.CanvasKeyHash(name)).
+		Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && current == revision) {
+		return illustrator.ErrVersionNotFound
+	}
+	if err != nil {
+		return
+	}
+	return illustrator.ErrConflict
+}
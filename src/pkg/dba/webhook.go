@@ -0,0 +1,125 @@
+package dba
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+func (s *Storage) CreateWebhook(ctx context.Context, webhook *illustrator.Webhook) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	events := make([]string, len(webhook.Events))
+	for i, event := range webhook.Events {
+		events[i] = string(event)
+	}
+
+	err = s.conn().QueryRowContext(ctx, "INSERT INTO webhooks (url, events, secret) VALUES ($1, $2, $3) "+
+		"RETURNING webhook_id, created_at", webhook.URL, pq.Array(events), webhook.Secret).
+		Scan(&webhook.ID, &webhook.CreatedAt)
+	return
+}
+
+func (s *Storage) ListWebhooks(ctx context.Context) (webhooks []illustrator.Webhook, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT webhook_id, url, events, secret, created_at FROM webhooks "+
+		"ORDER BY webhook_id")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook illustrator.Webhook
+		var events []string
+		if err = rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&events), &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			webhook.Events = append(webhook.Events, illustrator.AuditAction(event))
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, id int64) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	res, err := s.conn().ExecContext(ctx, "DELETE FROM webhooks WHERE webhook_id = $1", id)
+	if err != nil {
+		return
+	}
+	return requireAffected(res, illustrator.ErrWebhookNotFound)
+}
+
+func (s *Storage) RecordWebhookDelivery(ctx context.Context, delivery *illustrator.WebhookDelivery) (err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	err = s.conn().QueryRowContext(ctx, "INSERT INTO webhook_deliveries (webhook_id, event_id, action, name, attempt, "+
+		"status_code, error, delivered, duration_ms) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING delivery_id, created_at",
+		delivery.WebhookID, delivery.EventID, string(delivery.Action), delivery.Name, delivery.Attempt, delivery.StatusCode,
+		delivery.Error, delivery.Delivered, delivery.DurationMsec).Scan(&delivery.ID, &delivery.CreatedAt)
+	return
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the webhook, newest
+// first. Webhooks without deliveries are looked up to tell them from unknown ones.
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, id int64, limit int) (deliveries []illustrator.WebhookDelivery,
+	err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT delivery_id, webhook_id, event_id, action, name, attempt, status_code, "+
+		"error, delivered, duration_ms, created_at FROM webhook_deliveries WHERE webhook_id = $1 "+
+		"ORDER BY delivery_id DESC LIMIT $2", id, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	deliveries = []illustrator.WebhookDelivery{}
+	for rows.Next() {
+		var delivery illustrator.WebhookDelivery
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.Action, &delivery.Name,
+			&delivery.Attempt, &delivery.StatusCode, &delivery.Error, &delivery.Delivered, &delivery.DurationMsec,
+			&delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		var exists bool
+		err = s.conn().QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE webhook_id = $1)", id).Scan(&exists)
+		if err == nil && !exists {
+			err = illustrator.ErrWebhookNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func (s *Storage) WebhookDelivered(ctx context.Context, id int64, eventID int64) (ok bool, err error) {
+	ctx, done := s.withTimeout(ctx, &err)
+	defer done()
+
+	err = s.conn().QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhook_deliveries "+
+		"WHERE webhook_id = $1 AND event_id = $2 AND delivered)", id, eventID).Scan(&ok)
+	return
+}
@@ -0,0 +1,118 @@
+package hub
+
+import (
+	"sync"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Number of events kept for a subscriber not keeping up, older ones are dropped
+const subscriptionBuffer int = 16
+
+type EventType string
+
+const (
+	// The canvas changed, the event holds the new rendering
+	EventUpdate EventType = "update"
+	// The canvas was renamed, the event holds the new name
+	EventRename EventType = "rename"
+	// The canvas was deleted, no further events follow
+	EventDelete EventType = "delete"
+)
+
+// Event tells the subscribers of a canvas about a change
+type Event struct {
+	Type EventType `json:"-"`
+	// Revision of the canvas after the change, zero for deletes
+	Revision int `json:"revision,omitempty"`
+	// Rendered canvas of updates
+	Canvas string `json:"canvas,omitempty"`
+	// New name of renamed canvases
+	Name string `json:"name,omitempty"`
+}
+
+// Hub passes events about canvases to the subscribers of the canvas within
+// the process. Publishing never blocks: subscribers not keeping up lose the
+// oldest events.
+type Hub struct {
+	mu sync.Mutex
+	// Subscriptions by canvas key
+	subscriptions map[string]map[*Subscription]struct{}
+}
+
+// Subscription receives the events of a canvas until closed
+type Subscription struct {
+	// Events of the canvas in the order published
+	C <-chan Event
+
+	ch  chan Event
+	key string
+	hub *Hub
+}
+
+func NewHub() (h *Hub) {
+	return &Hub{subscriptions: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription to the events of the canvas, which must be
+// closed once done
+func (h *Hub) Subscribe(name string) (sub *Subscription) {
+	ch := make(chan Event, subscriptionBuffer)
+	sub = &Subscription{C: ch, ch: ch, key: illustrator.CanvasKey(name), hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs, ok := h.subscriptions[sub.key]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		h.subscriptions[sub.key] = subs
+	}
+	subs[sub] = struct{}{}
+	return
+}
+
+// Close stops the subscription, its channel is left open
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	subs := s.hub.subscriptions[s.key]
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(s.hub.subscriptions, s.key)
+	}
+}
+
+// Subscribed reports whether the canvas has subscribers, so publishers can
+// skip preparing events nobody receives
+func (h *Hub) Subscribed(name string) (ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok = h.subscriptions[illustrator.CanvasKey(name)]
+	return
+}
+
+// Publish passes the event to the subscribers of the canvas
+func (h *Hub) Publish(name string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscriptions[illustrator.CanvasKey(name)] {
+		select {
+		case sub.ch <- event:
+		default:
+			// Updates hold the whole canvas, so the latest one is worth more
+			// than the oldest
+			select {
+			case <-sub.ch:
+			default:
+			}
+			select {
+			case sub.ch <- event:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package hub_test
+
+import (
+	"testing"
+
+	"github.com/sketch-home-task/src/pkg/hub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHubPublish(t *testing.T) {
+	a := assert.New(t)
+	h := hub.NewHub()
+
+	first := h.Subscribe("MonaLisa")
+	second := h.Subscribe("monalisa")
+	other := h.Subscribe("scream")
+	defer other.Close()
+	a.True(h.Subscribed("MONALISA"))
+	a.False(h.Subscribed("gioconda"))
+
+	// Subscribers of a canvas get its events, whatever case the name is given in
+	event := hub.Event{Type: hub.EventUpdate, Revision: 2, Canvas: "@@@"}
+	h.Publish("monaLisa", event)
+	a.Equal(event, <-first.C)
+	a.Equal(event, <-second.C)
+	a.Empty(other.C)
+
+	// Closed subscriptions get no more events
+	first.Close()
+	h.Publish("monalisa", hub.Event{Type: hub.EventDelete})
+	a.Empty(first.C)
+	a.Equal(hub.EventDelete, (<-second.C).Type)
+
+	second.Close()
+	a.False(h.Subscribed("monalisa"))
+	a.True(h.Subscribed("scream"))
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	a := assert.New(t)
+	h := hub.NewHub()
+
+	sub := h.Subscribe("monalisa")
+	defer sub.Close()
+
+	// Publishing does not block, the oldest events are dropped
+	for revision := 1; revision <= 100; revision++ {
+		h.Publish("monalisa", hub.Event{Type: hub.EventUpdate, Revision: revision})
+	}
+
+	var revisions []int
+	for len(sub.C) > 0 {
+		revisions = append(revisions, (<-sub.C).Revision)
+	}
+	a.NotEmpty(revisions)
+	a.Equal(100, revisions[len(revisions)-1])
+	for i := 1; i < len(revisions); i++ {
+		a.Equal(revisions[i-1]+1, revisions[i])
+	}
+}
@@ -0,0 +1,138 @@
+package illustrator
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate   AuditAction = "create"
+	AuditUpdate   AuditAction = "update"
+	AuditDelete   AuditAction = "delete"
+	AuditRename   AuditAction = "rename"
+	AuditUndelete AuditAction = "undelete"
+	// Purges end the audit log of a canvas, which is kept once the canvas is
+	// gone but no longer listed
+	AuditPurge AuditAction = "purge"
+)
+
+// SystemActor is recorded for changes made outside of a request, such as
+// imports run from the command line
+const SystemActor string = "system"
+
+// MaxActorValueLength bounds the actor names and request IDs taken from
+// clients, in bytes
+const MaxActorValueLength int = 128
+
+// AuditEntry records a change of a canvas, written together with the change
+type AuditEntry struct {
+	Action AuditAction `json:"action"`
+	// Name of the canvas after the change
+	Name string `json:"name"`
+	// Name of the canvas before a rename
+	PreviousName string `json:"previous_name,omitempty"`
+	Actor        string `json:"actor"`
+	RequestID    string `json:"request_id,omitempty"`
+	// Revision of the canvas after the change
+	Revision int `json:"revision"`
+	// Change of the drawings, nil for changes which leave the content as it is
+	Diff      *DrawingsDiff `json:"diff,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// DrawingsDiff summarizes a change of the drawings of a canvas
+type DrawingsDiff struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+// DiffDrawings compares the drawings before and after a change. The drawings
+// both have in common at the start and at the end are left out, the others
+// are compared by position, so inserting or removing a drawing only counts
+// that drawing.
+func DiffDrawings(before, after DrawingSlice) (diff DrawingsDiff) {
+	start := 0
+	for start < len(before) && start < len(after) && reflect.DeepEqual(before[start], after[start]) {
+		start++
+	}
+	endBefore, endAfter := len(before), len(after)
+	for endBefore > start && endAfter > start && reflect.DeepEqual(before[endBefore-1], after[endAfter-1]) {
+		endBefore--
+		endAfter--
+	}
+
+	removed, added := endBefore-start, endAfter-start
+	diff.Changed = removed
+	if added < removed {
+		diff.Changed = added
+	}
+	diff.Added = added - diff.Changed
+	diff.Removed = removed - diff.Changed
+	return
+}
+
+// DrawingsDiff Scanner/Valuer database/sql interface for serialization in databases
+
+func (d *DrawingsDiff) Scan(value interface{}) (err error) {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("value type '%T' is not supported", value)
+	}
+	return json.Unmarshal(data, d)
+}
+
+func (d DrawingsDiff) Value() (ret driver.Value, err error) {
+	return json.Marshal(d)
+}
+
+// Actor identifies who changes canvases, recorded in the audit log
+type Actor struct {
+	Name string
+	// ID of the request the change was made by, empty outside of requests
+	RequestID string
+}
+
+type actorKey struct{}
+
+// CleanActorValue trims an actor name or request ID given by a client and cuts
+// it to MaxActorValueLength bytes without splitting a character. Invalid UTF-8,
+// which Postgres rejects, is replaced.
+func CleanActorValue(value string) (cleaned string) {
+	cleaned = strings.ToValidUTF8(strings.TrimSpace(value), string(utf8.RuneError))
+	if len(cleaned) <= MaxActorValueLength {
+		return
+	}
+	cut := MaxActorValueLength
+	for cut > 0 && !utf8.RuneStart(cleaned[cut]) {
+		cut--
+	}
+	return cleaned[:cut]
+}
+
+// ContextWithActor returns a context whose storage calls are recorded as made by actor
+func ContextWithActor(ctx context.Context, actor Actor) (actorCtx context.Context) {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the context, SystemActor if none
+func ActorFromContext(ctx context.Context) (actor Actor) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	if !ok || actor.Name == "" {
+		actor.Name = SystemActor
+	}
+	return
+}
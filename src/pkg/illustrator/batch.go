@@ -0,0 +1,98 @@
+package illustrator
+
+import (
+	"errors"
+)
+
+// Max. number of operations of a batch
+const BatchMaxOperations int = 1000
+
+// ErrBatchAborted is returned when an atomic batch was rolled back because
+// one of its operations failed
+var ErrBatchAborted = errors.New("batch aborted")
+
+type BatchOperationType string
+
+const (
+	BatchCreate BatchOperationType = "create"
+	BatchUpdate BatchOperationType = "update"
+	BatchDelete BatchOperationType = "delete"
+)
+
+// BatchOperation creates or updates the given canvas, or deletes the canvas
+// with the given name
+type BatchOperation struct {
+	Op     BatchOperationType `json:"op"`
+	Canvas *CanvasModel       `json:"canvas,omitempty"`
+	Name   string             `json:"name,omitempty"`
+}
+
+// BatchRequest lists the operations to run in order. Atomic batches are all or
+// nothing, otherwise every operation is applied on its own.
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations" validate:"dive"`
+}
+
+type BatchStatus string
+
+const (
+	BatchStatusOK       BatchStatus = "ok"
+	BatchStatusNotFound BatchStatus = "not_found"
+	BatchStatusFailed   BatchStatus = "failed"
+	// The operation was not run or rolled back with the rest of an atomic batch
+	BatchStatusAborted BatchStatus = "aborted"
+)
+
+type BatchResult struct {
+	Index  int                `json:"index"`
+	Op     BatchOperationType `json:"op"`
+	Name   string             `json:"name"`
+	Status BatchStatus        `json:"status"`
+	Error  string             `json:"error,omitempty"`
+	// Error of a failed operation as returned by the storage
+	Err error `json:"-"`
+}
+
+// CanvasName returns the name of the canvas the operation applies to
+func (o *BatchOperation) CanvasName() (name string) {
+	if o.Canvas != nil {
+		return o.Canvas.Name
+	}
+	return o.Name
+}
+
+// NewBatchResult returns the result of an operation from the error returned
+// by the matching storage method
+func NewBatchResult(index int, op *BatchOperation, err error) (result BatchResult) {
+	result = BatchResult{Index: index, Op: op.Op, Name: op.CanvasName(), Status: BatchStatusOK}
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrCanvasNotFound):
+		result.Status = BatchStatusNotFound
+	default:
+		result.Status = BatchStatusFailed
+		result.Err = err
+	}
+	return
+}
+
+// Failed reports whether the operation did not apply
+func (r *BatchResult) Failed() (failed bool) {
+	return r.Status != BatchStatusOK
+}
+
+// AbortBatch marks the results of an atomic batch as rolled back, apart from
+// the failed operation, and adds the operations which did not run
+func AbortBatch(ops []BatchOperation, results []BatchResult) (aborted []BatchResult) {
+	for i := range results {
+		if !results[i].Failed() {
+			results[i].Status = BatchStatusAborted
+		}
+	}
+	for i := len(results); i < len(ops); i++ {
+		results = append(results, BatchResult{Index: i, Op: ops[i].Op, Name: ops[i].CanvasName(),
+			Status: BatchStatusAborted})
+	}
+	return results
+}
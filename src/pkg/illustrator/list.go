@@ -0,0 +1,122 @@
+package illustrator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Number of canvases per page when no limit is requested
+	ListDefaultLimit int = 20
+	// Max. number of canvases per page
+	ListMaxLimit int = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid list cursor")
+
+type ListSortField string
+
+const (
+	ListSortByName    ListSortField = "name"
+	ListSortByCreated ListSortField = "created"
+	ListSortByUpdated ListSortField = "updated"
+)
+
+// ListOptions controls the canvases returned by CanvasStorage.List. Zero
+// valued dimension filters are ignored.
+type ListOptions struct {
+	Limit      int
+	Cursor     string
+	SortBy     ListSortField
+	Descending bool
+	MinWidth   int
+	MaxWidth   int
+	MinHeight  int
+	MaxHeight  int
+}
+
+// CanvasInfo is the metadata of a stored canvas. The key is the normalized
+// name used to look up the canvas.
+type CanvasInfo struct {
+	Name         string    `json:"name"`
+	Key          string    `json:"key"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	DrawingCount int       `json:"drawing_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// Name of the canvas this one was cloned from, if still stored
+	ForkedFrom string `json:"forked_from,omitempty"`
+}
+
+type CanvasPage struct {
+	Canvases []CanvasInfo `json:"canvases"`
+	// Opaque cursor of the next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListCursor points right after the last canvas of a page. The key breaks
+// ties between canvases sharing the same timestamp.
+type ListCursor struct {
+	SortBy ListSortField `json:"s"`
+	Key    string        `json:"k"`
+	Time   time.Time     `json:"t,omitempty"`
+}
+
+// Normalize applies the default values and validates the options
+func (o *ListOptions) Normalize() (err error) {
+	switch o.SortBy {
+	case "":
+		o.SortBy = ListSortByName
+	case ListSortByName, ListSortByCreated, ListSortByUpdated:
+	default:
+		return fmt.Errorf("unknown sort field '%s'", o.SortBy)
+	}
+
+	if o.Limit < 0 || o.Limit > ListMaxLimit {
+		return fmt.Errorf("limit must be between 1 - %d", ListMaxLimit)
+	}
+	if o.Limit == 0 {
+		o.Limit = ListDefaultLimit
+	}
+
+	if o.MinWidth < 0 || o.MaxWidth < 0 || o.MinHeight < 0 || o.MaxHeight < 0 {
+		return errors.New("dimension filters must not be negative")
+	}
+	return
+}
+
+// DecodeCursor returns the cursor of the options, nil when listing from the start
+func (o *ListOptions) DecodeCursor() (cursor *ListCursor, err error) {
+	if o.Cursor == "" {
+		return
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor = &ListCursor{}
+	if err = json.Unmarshal(data, cursor); err != nil || cursor.SortBy != o.SortBy {
+		return nil, ErrInvalidCursor
+	}
+	return
+}
+
+// NewListCursor returns the cursor pointing after the given canvas
+func NewListCursor(sortBy ListSortField, last *CanvasInfo) (cursor string) {
+	c := ListCursor{SortBy: sortBy, Key: last.Key}
+	switch sortBy {
+	case ListSortByCreated:
+		c.Time = last.CreatedAt
+	case ListSortByUpdated:
+		c.Time = last.UpdatedAt
+	}
+
+	data, _ := json.Marshal(&c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
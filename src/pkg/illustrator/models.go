@@ -2,25 +2,117 @@ package illustrator
 
 import (
 	"context"
-	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 )
 
+// CanvasStorage persists canvases. Storages report missing canvases, taken
+// names and revision conflicts with the errors below, whatever the backend.
+// Every change of a canvas is recorded in its audit log together with the
+// change, as made by the actor of the context.
 type CanvasStorage interface {
 	Close() (err error)
 	FindByName(ctx context.Context, name string) (canvas *CanvasModel, err error)
-	Create(ctx context.Context, canvas *CanvasModel) (res sql.Result, err error)
-	Update(ctx context.Context, canvas *CanvasModel) (res sql.Result, err error)
-	Delete(ctx context.Context, name string) (res sql.Result, err error)
+	Create(ctx context.Context, canvas *CanvasModel) (err error)
+	Update(ctx context.Context, canvas *CanvasModel) (newRevision int, err error)
+	Delete(ctx context.Context, name string) (err error)
+	List(ctx context.Context, opts ListOptions) (page *CanvasPage, err error)
+	ListVersions(ctx context.Context, name string) (versions []CanvasVersion, err error)
+	FindVersion(ctx context.Context, name string, version int) (canvas *CanvasModel, err error)
+	RestoreVersion(ctx context.Context, name string, revision int, version int) (newRevision int, err error)
+	AppendDrawing(ctx context.Context, name string, revision int, drawing *DrawingModel, check CanvasCheck) (canvas *CanvasModel, err error)
+	ReplaceDrawing(ctx context.Context, name string, revision int, index int, drawing *DrawingModel, check CanvasCheck) (canvas *CanvasModel, err error)
+	RemoveDrawing(ctx context.Context, name string, revision int, index int, check CanvasCheck) (canvas *CanvasModel, err error)
+	Batch(ctx context.Context, ops []BatchOperation, atomic bool) (results []BatchResult, err error)
+	Clone(ctx context.Context, name string, cloneName string) (err error)
+	Rename(ctx context.Context, name string, revision int, newName string) (newRevision int, err error)
+	ListTrash(ctx context.Context) (canvases []TrashedCanvas, err error)
+	Undelete(ctx context.Context, name string) (err error)
+	Purge(ctx context.Context, name string) (err error)
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (count int64, err error)
+	WithTx(ctx context.Context, fn TxFunc) (err error)
+	ListAudit(ctx context.Context, name string) (entries []AuditEntry, err error)
+	Import(ctx context.Context, history *CanvasHistory) (err error)
+	LinkFork(ctx context.Context, name string, parent string) (err error)
 }
 
+// CanvasCheck validates a canvas modified by the storage before the change is
+// persisted, an error aborts the change
+type CanvasCheck func(canvas *CanvasModel) (err error)
+
+// TxFunc is a unit of work run by WithTx. Its calls to the given storage apply
+// together or not at all: the changes are kept when it returns nil and
+// discarded otherwise. It may be run again when the transaction failed to
+// serialize with concurrent ones, so it must not have other side effects.
+type TxFunc func(tx CanvasStorage) (err error)
+
+var (
+	// ErrCanvasNotFound is returned when no canvas has the given name, trashed
+	// canvases are only found by the trash operations
+	ErrCanvasNotFound = errors.New("canvas not found")
+	// ErrCanvasExists is returned when a canvas name is taken, by a trashed canvas as well
+	ErrCanvasExists = errors.New("canvas name already exists")
+	// ErrVersionNotFound is returned when the canvas or its version does not exist
+	ErrVersionNotFound = errors.New("canvas version not found")
+	// ErrConflict is returned when a canvas changed since the revision a write
+	// is conditioned on, or a concurrent write got in the way
+	ErrConflict = errors.New("canvas revision conflict")
+	// ErrDrawingNotFound is returned for drawing indexes out of range
+	ErrDrawingNotFound = errors.New("drawing not found")
+	// ErrTimeout is returned when a storage operation ran out of time
+	ErrTimeout = errors.New("storage operation timed out")
+)
+
 type CanvasModel struct {
 	Name     string       `json:"name"`
 	Width    int          `json:"width"`
 	Height   int          `json:"height"`
 	Drawings DrawingSlice `json:"drawings" validate:"dive"`
+	// Incremented on every change. Updates of a canvas with a revision only
+	// succeed if the stored canvas is still at that revision.
+	Revision int `json:"-"`
+}
+
+// CloneRequest names the copy of a canvas. Names follow the routes, letters
+// only and at most 25 of them.
+type CloneRequest struct {
+	Name string `json:"name" validate:"required,alpha,max=25"`
+}
+
+// RenameRequest holds the new name of a canvas, with the same rules as the
+// name of a clone
+type RenameRequest struct {
+	Name string `json:"name" validate:"required,alpha,max=25"`
+}
+
+// CanvasVersion is the metadata of an immutable snapshot of a canvas, recorded
+// on every change. Versions are numbered from 1 for each canvas.
+type CanvasVersion struct {
+	Version      int       `json:"version"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	DrawingCount int       `json:"drawing_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CanvasHistory is a canvas together with its metadata and versions, stored as
+// it is by imports. Versions are numbered from 1, oldest first, the last one
+// holds the content of the canvas.
+type CanvasHistory struct {
+	Canvas    CanvasModel
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Versions  []CanvasSnapshot
+}
+
+// CanvasSnapshot is a version of a canvas with its content
+type CanvasSnapshot struct {
+	Version   int
+	Canvas    CanvasModel
+	CreatedAt time.Time
 }
 
 type DrawingModel struct {
@@ -33,6 +125,40 @@ type DrawingModel struct {
 
 type DrawingSlice []DrawingModel
 
+// Clone returns a deep copy of the canvas, including its drawings
+func (c *CanvasModel) Clone() (clone *CanvasModel) {
+	clone = &CanvasModel{
+		Name:     c.Name,
+		Width:    c.Width,
+		Height:   c.Height,
+		Revision: c.Revision,
+	}
+	if c.Drawings != nil {
+		clone.Drawings = make(DrawingSlice, len(c.Drawings))
+		for i, drawing := range c.Drawings {
+			clone.Drawings[i] = drawing.Clone()
+		}
+	}
+	return
+}
+
+// Clone returns a deep copy of the drawing
+func (d DrawingModel) Clone() (clone DrawingModel) {
+	clone = d
+	if d.Coordinates != nil {
+		clone.Coordinates = append([]int(nil), d.Coordinates...)
+	}
+	if d.Fill != nil {
+		fill := *d.Fill
+		clone.Fill = &fill
+	}
+	if d.Outline != nil {
+		outline := *d.Outline
+		clone.Outline = &outline
+	}
+	return
+}
+
 // DrawingSlice Scanner/Valuer database/sql interface for serialization in databases
 
 func (o *DrawingSlice) Scan(value interface{}) (err error) {
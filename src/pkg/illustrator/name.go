@@ -0,0 +1,40 @@
+package illustrator
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// CanvasKey returns the normalized lookup key of a canvas name, canvas names
+// are case insensitive.
+func CanvasKey(name string) (key string) {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// CanvasKeyHash returns the hash canvases are looked up by. Canvases created
+// before display names were kept are only known by this hash.
+func CanvasKeyHash(name string) (hash string) {
+	return LegacyNameHash(CanvasKey(name))
+}
+
+// ValidCanvasName tells whether the name can be stored, it must not be blank
+// and fit the name columns
+func ValidCanvasName(name string) (valid bool) {
+	return strings.TrimSpace(name) != "" && utf8.RuneCountInString(name) <= CanvasMaxNameSize
+}
+
+// LegacyNameHash returns the SHA-1 hex digest of the name as given, which is
+// what used to be stored instead of the canvas name.
+func LegacyNameHash(name string) (hash string) {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// NameBackfiller is implemented by storages able to restore the names of
+// canvases stored before display names were kept.
+type NameBackfiller interface {
+	BackfillNames(ctx context.Context, names []string) (count int64, err error)
+}
@@ -0,0 +1,38 @@
+package illustrator
+
+import (
+	"context"
+	"time"
+)
+
+// EventOutbox is implemented by storages writing a change event to an outbox
+// in the same transaction as every change of a canvas. Events stay in the
+// outbox until delivered, so each one is delivered at least once.
+type EventOutbox interface {
+	// ClaimEvents returns up to limit events due for delivery, oldest first.
+	// Claimed events are not returned again until the lease is over, unless
+	// delivered in the meantime.
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) (events []ChangeEvent, err error)
+	// MarkDelivered removes a delivered event from the outbox
+	MarkDelivered(ctx context.Context, id int64) (err error)
+	// RetryEvent records a failed delivery, the event is due again at the given time
+	RetryEvent(ctx context.Context, id int64, at time.Time, reason string) (err error)
+}
+
+// ChangeEvent tells about a change of a canvas
+type ChangeEvent struct {
+	ID     int64       `json:"id"`
+	Action AuditAction `json:"action"`
+	// Name of the canvas after the change
+	Name string `json:"name"`
+	// Name of the canvas before a rename
+	PreviousName string `json:"previous_name,omitempty"`
+	// Revision of the canvas after the change, events of a canvas may arrive
+	// out of order or more than once
+	Revision   int       `json:"revision"`
+	Actor      string    `json:"actor"`
+	RequestID  string    `json:"request_id,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Number of failed deliveries so far
+	Attempts int `json:"-"`
+}
@@ -0,0 +1,22 @@
+package illustrator
+
+// PoolStatsReporter is implemented by storages keeping a pool of database
+// connections.
+type PoolStatsReporter interface {
+	PoolStats() (stats PoolStats)
+}
+
+// PoolStats describes the connection pool of a storage
+type PoolStats struct {
+	MaxOpenConnections int `json:"max_open_connections"`
+	OpenConnections    int `json:"open_connections"`
+	InUse              int `json:"in_use"`
+	Idle               int `json:"idle"`
+	// Number of times and total time callers waited for a free connection
+	WaitCount        int64 `json:"wait_count"`
+	WaitDurationMsec int64 `json:"wait_duration_ms"`
+	// Number of connections closed by the pool limits
+	MaxIdleClosed     int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+}
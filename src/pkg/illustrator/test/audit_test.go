@@ -0,0 +1,100 @@
+package illustrator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffDrawings(t *testing.T) {
+	fill, other := '*', '#'
+	drawing := func(x int) illustrator.DrawingModel {
+		return illustrator.DrawingModel{Coordinates: []int{x, x}, Width: 2, Height: 2, Fill: &fill}
+	}
+	a, b, c := drawing(1), drawing(2), drawing(3)
+	recolored := drawing(2)
+	recolored.Fill = &other
+
+	testTable := []struct {
+		name   string
+		before illustrator.DrawingSlice
+		after  illustrator.DrawingSlice
+		diff   illustrator.DrawingsDiff
+	}{
+		{
+			name:  "Test new canvas",
+			after: illustrator.DrawingSlice{a, b},
+			diff:  illustrator.DrawingsDiff{Added: 2},
+		},
+		{
+			name:   "Test unchanged drawings",
+			before: illustrator.DrawingSlice{a, b},
+			after:  illustrator.DrawingSlice{drawing(1), drawing(2)},
+			diff:   illustrator.DrawingsDiff{},
+		},
+		{
+			name:   "Test appended drawing",
+			before: illustrator.DrawingSlice{a, b},
+			after:  illustrator.DrawingSlice{a, b, c},
+			diff:   illustrator.DrawingsDiff{Added: 1},
+		},
+		{
+			name:   "Test removed drawing in the middle",
+			before: illustrator.DrawingSlice{a, b, c},
+			after:  illustrator.DrawingSlice{a, c},
+			diff:   illustrator.DrawingsDiff{Removed: 1},
+		},
+		{
+			name:   "Test replaced drawing",
+			before: illustrator.DrawingSlice{a, b, c},
+			after:  illustrator.DrawingSlice{a, recolored, c},
+			diff:   illustrator.DrawingsDiff{Changed: 1},
+		},
+		{
+			name:   "Test replaced and appended drawings",
+			before: illustrator.DrawingSlice{a, b},
+			after:  illustrator.DrawingSlice{c, recolored, a},
+			diff:   illustrator.DrawingsDiff{Added: 1, Changed: 2},
+		},
+		{
+			name:   "Test cleared canvas",
+			before: illustrator.DrawingSlice{a, b},
+			diff:   illustrator.DrawingsDiff{Removed: 2},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.diff, illustrator.DiffDrawings(testCase.before, testCase.after))
+		})
+	}
+}
+
+func TestActorFromContext(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(illustrator.Actor{Name: illustrator.SystemActor}, illustrator.ActorFromContext(context.Background()))
+
+	actor := illustrator.Actor{Name: "leonardo", RequestID: "f3a1"}
+	ctx := illustrator.ContextWithActor(context.Background(), actor)
+	a.Equal(actor, illustrator.ActorFromContext(ctx))
+}
+
+func TestCleanActorValue(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("leonardo", illustrator.CleanActorValue("  leonardo "))
+	a.Equal(strings.Repeat("a", illustrator.MaxActorValueLength),
+		illustrator.CleanActorValue(strings.Repeat("a", illustrator.MaxActorValueLength+1)))
+
+	// The cut falls before a character which would not fit whole
+	cleaned := illustrator.CleanActorValue("a" + strings.Repeat("é", illustrator.MaxActorValueLength))
+	a.True(utf8.ValidString(cleaned))
+	a.Equal("a"+strings.Repeat("é", illustrator.MaxActorValueLength/2-1), cleaned)
+
+	a.Equal("leo\uFFFDnardo", illustrator.CleanActorValue("leo\xffnardo"))
+}
@@ -0,0 +1,85 @@
+package illustrator_test
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchRequestValidation(t *testing.T) {
+	canvas := &illustrator.CanvasModel{Name: "monalisa", Width: 10, Height: 10}
+	tooLarge := &illustrator.CanvasModel{Name: "monalisa", Width: illustrator.CanvasMaxWidth + 1, Height: 10}
+
+	testTable := []struct {
+		name       string
+		batch      illustrator.BatchRequest
+		validEntry bool
+	}{
+		{
+			name: "Test batch with every operation",
+			batch: illustrator.BatchRequest{Operations: []illustrator.BatchOperation{
+				{Op: illustrator.BatchCreate, Canvas: canvas},
+				{Op: illustrator.BatchUpdate, Canvas: canvas},
+				{Op: illustrator.BatchDelete, Name: "monalisa"},
+			}},
+			validEntry: true,
+		},
+		{
+			name:       "Test batch without operations",
+			batch:      illustrator.BatchRequest{},
+			validEntry: false,
+		},
+		{
+			name: "Test batch with too many operations",
+			batch: illustrator.BatchRequest{
+				Operations: make([]illustrator.BatchOperation, illustrator.BatchMaxOperations+1),
+			},
+			validEntry: false,
+		},
+		{
+			name: "Test batch with unknown operation",
+			batch: illustrator.BatchRequest{Operations: []illustrator.BatchOperation{
+				{Op: "rename", Name: "monalisa"},
+			}},
+			validEntry: false,
+		},
+		{
+			name: "Test batch create without canvas",
+			batch: illustrator.BatchRequest{Operations: []illustrator.BatchOperation{
+				{Op: illustrator.BatchCreate, Name: "monalisa"},
+			}},
+			validEntry: false,
+		},
+		{
+			name: "Test batch delete without name",
+			batch: illustrator.BatchRequest{Operations: []illustrator.BatchOperation{
+				{Op: illustrator.BatchDelete},
+			}},
+			validEntry: false,
+		},
+		{
+			name: "Test batch with invalid canvas",
+			batch: illustrator.BatchRequest{Operations: []illustrator.BatchOperation{
+				{Op: illustrator.BatchUpdate, Canvas: tooLarge},
+			}},
+			validEntry: false,
+		},
+	}
+
+	validator := validator.New()
+	illustrator.RegisterValidation(validator)
+
+	a := assert.New(t)
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Struct(&tt.batch)
+			if tt.validEntry {
+				a.NoError(err)
+			} else {
+				a.Error(err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package illustrator_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/go-playground/validator"
@@ -38,6 +39,7 @@ func TestIllustrator(t *testing.T) {
 		{
 			name: "Test illustrator with valid canvas",
 			canvas: illustrator.CanvasModel{
+				Name:   "MonaLisa",
 				Width:  15,
 				Height: 7,
 				Drawings: []illustrator.DrawingModel{
@@ -113,6 +115,7 @@ func TestIllustrator(t *testing.T) {
 		{
 			name: "Test illustrator with invalid drawing dimensions",
 			canvas: illustrator.CanvasModel{
+				Name:   "MonaLisa",
 				Width:  15,
 				Height: 7,
 				Drawings: []illustrator.DrawingModel{
@@ -131,6 +134,7 @@ func TestIllustrator(t *testing.T) {
 		{
 			name: "Test illustrator with invalid canvas dimensions",
 			canvas: illustrator.CanvasModel{
+				Name:   "MonaLisa",
 				Width:  illustrator.CanvasMaxWidth + 1,
 				Height: 7,
 				Drawings: []illustrator.DrawingModel{
@@ -149,6 +153,7 @@ func TestIllustrator(t *testing.T) {
 		{
 			name: "Test illustrator with invalid filler",
 			canvas: illustrator.CanvasModel{
+				Name:   "MonaLisa",
 				Width:  20,
 				Height: 7,
 				Drawings: []illustrator.DrawingModel{
@@ -167,6 +172,7 @@ func TestIllustrator(t *testing.T) {
 		{
 			name: "Test illustrator with invalid number of drawing coordinates",
 			canvas: illustrator.CanvasModel{
+				Name:   "MonaLisa",
 				Width:  20,
 				Height: 7,
 				Drawings: []illustrator.DrawingModel{
@@ -182,9 +188,28 @@ func TestIllustrator(t *testing.T) {
 			expectedCanvas: "",
 			validEntry:     false,
 		},
+		{
+			name: "Test illustrator with missing drawing coordinates",
+			canvas: illustrator.CanvasModel{
+				Name:   "MonaLisa",
+				Width:  20,
+				Height: 7,
+				Drawings: []illustrator.DrawingModel{
+					{
+						Width:   4,
+						Height:  5,
+						Fill:    &dollerRune,
+						Outline: nil,
+					},
+				},
+			},
+			expectedCanvas: "",
+			validEntry:     false,
+		},
 		{
 			name: "Test illustrator with invalid range of drawing coordinates",
 			canvas: illustrator.CanvasModel{
+				Name:   "MonaLisa",
 				Width:  20,
 				Height: 7,
 				Drawings: []illustrator.DrawingModel{
@@ -200,6 +225,26 @@ func TestIllustrator(t *testing.T) {
 			expectedCanvas: "",
 			validEntry:     false,
 		},
+		{
+			name: "Test illustrator with missing canvas name",
+			canvas: illustrator.CanvasModel{
+				Name:   " ",
+				Width:  20,
+				Height: 7,
+			},
+			expectedCanvas: "",
+			validEntry:     false,
+		},
+		{
+			name: "Test illustrator with too long canvas name",
+			canvas: illustrator.CanvasModel{
+				Name:   strings.Repeat("a", illustrator.CanvasMaxNameSize+1),
+				Width:  20,
+				Height: 7,
+			},
+			expectedCanvas: "",
+			validEntry:     false,
+		},
 	}
 
 	validator := validator.New()
@@ -0,0 +1,60 @@
+package illustrator_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOptionsNormalize(t *testing.T) {
+	a := assert.New(t)
+
+	opts := illustrator.ListOptions{}
+	a.NoError(opts.Normalize())
+	a.Equal(illustrator.ListSortByName, opts.SortBy)
+	a.Equal(illustrator.ListDefaultLimit, opts.Limit)
+
+	invalidOpts := []illustrator.ListOptions{
+		{SortBy: "size"},
+		{Limit: -1},
+		{Limit: illustrator.ListMaxLimit + 1},
+		{MinWidth: -5},
+	}
+	for _, opts := range invalidOpts {
+		a.Error(opts.Normalize())
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	a := assert.New(t)
+	last := &illustrator.CanvasInfo{
+		Key:       "monalisa",
+		CreatedAt: time.Date(2022, 10, 1, 12, 0, 0, 500, time.UTC),
+	}
+
+	opts := illustrator.ListOptions{
+		SortBy: illustrator.ListSortByCreated,
+		Cursor: illustrator.NewListCursor(illustrator.ListSortByCreated, last),
+	}
+	cursor, err := opts.DecodeCursor()
+	a.NoError(err)
+	a.Equal(last.Key, cursor.Key)
+	a.True(last.CreatedAt.Equal(cursor.Time))
+
+	// Cursors are bound to the sort field they were created for
+	opts.SortBy = illustrator.ListSortByName
+	_, err = opts.DecodeCursor()
+	a.True(errors.Is(err, illustrator.ErrInvalidCursor))
+
+	opts.Cursor = "%%%"
+	_, err = opts.DecodeCursor()
+	a.True(errors.Is(err, illustrator.ErrInvalidCursor))
+
+	opts.Cursor = ""
+	cursor, err = opts.DecodeCursor()
+	a.NoError(err)
+	a.Nil(cursor)
+}
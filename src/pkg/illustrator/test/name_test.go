@@ -0,0 +1,97 @@
+package illustrator_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanvasKey(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("monalisa", illustrator.CanvasKey(" MonaLisa "))
+	a.Equal(illustrator.CanvasKeyHash("monalisa"), illustrator.CanvasKeyHash("MonaLisa"))
+
+	// Names used to be stored as SHA-1 hex digest
+	a.Equal("de68a951c1586debd9031e55c96f667072382937", illustrator.LegacyNameHash("monalisa"))
+	a.Equal(illustrator.LegacyNameHash("monalisa"), illustrator.CanvasKeyHash("MonaLisa"))
+	a.NotEqual(illustrator.LegacyNameHash("MonaLisa"), illustrator.CanvasKeyHash("MonaLisa"))
+}
+
+func TestCloneRequestValidation(t *testing.T) {
+	v := validator.New()
+
+	testTable := []struct {
+		name  string
+		clone illustrator.CloneRequest
+		valid bool
+	}{
+		{
+			name:  "Test name",
+			clone: illustrator.CloneRequest{Name: "Gioconda"},
+			valid: true,
+		},
+		{
+			name:  "Test longest name",
+			clone: illustrator.CloneRequest{Name: strings.Repeat("a", 25)},
+			valid: true,
+		},
+		{
+			name:  "Test missing name",
+			clone: illustrator.CloneRequest{},
+		},
+		{
+			name:  "Test name too long",
+			clone: illustrator.CloneRequest{Name: strings.Repeat("a", 26)},
+		},
+		{
+			name:  "Test name not routable",
+			clone: illustrator.CloneRequest{Name: "mona-lisa"},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := v.Struct(testCase.clone)
+			assert.Equal(t, testCase.valid, err == nil, err)
+		})
+	}
+}
+
+func TestRenameRequestValidation(t *testing.T) {
+	v := validator.New()
+
+	testTable := []struct {
+		name   string
+		rename illustrator.RenameRequest
+		valid  bool
+	}{
+		{
+			name:   "Test name",
+			rename: illustrator.RenameRequest{Name: "Gioconda"},
+			valid:  true,
+		},
+		{
+			name:   "Test missing name",
+			rename: illustrator.RenameRequest{},
+		},
+		{
+			name:   "Test name too long",
+			rename: illustrator.RenameRequest{Name: strings.Repeat("a", 26)},
+		},
+		{
+			name:   "Test name not routable",
+			rename: illustrator.RenameRequest{Name: "gioconda2"},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := v.Struct(testCase.rename)
+			assert.Equal(t, testCase.valid, err == nil, err)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package illustrator_test
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookValidation(t *testing.T) {
+	v := validator.New()
+	illustrator.RegisterValidation(v)
+
+	testTable := []struct {
+		name    string
+		webhook illustrator.Webhook
+		valid   bool
+	}{
+		{
+			name:    "Test all events",
+			webhook: illustrator.Webhook{URL: "https://bot.example.com/hook"},
+			valid:   true,
+		},
+		{
+			name:    "Test event filter",
+			webhook: illustrator.Webhook{URL: "http://localhost:8080", Events: []illustrator.AuditAction{"update", "purge"}},
+			valid:   true,
+		},
+		{
+			name:    "Test missing URL",
+			webhook: illustrator.Webhook{},
+		},
+		{
+			name:    "Test relative URL",
+			webhook: illustrator.Webhook{URL: "/hook"},
+		},
+		{
+			name:    "Test unsupported scheme",
+			webhook: illustrator.Webhook{URL: "ftp://bot.example.com"},
+		},
+		{
+			name:    "Test unknown event",
+			webhook: illustrator.Webhook{URL: "https://bot.example.com/hook", Events: []illustrator.AuditAction{"draw"}},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := v.Struct(testCase.webhook)
+			assert.Equal(t, testCase.valid, err == nil, err)
+		})
+	}
+}
+
+func TestWebhookAccepts(t *testing.T) {
+	a := assert.New(t)
+
+	all := illustrator.Webhook{}
+	a.True(all.Accepts(illustrator.AuditPurge))
+
+	filtered := illustrator.Webhook{Events: []illustrator.AuditAction{illustrator.AuditUpdate}}
+	a.True(filtered.Accepts(illustrator.AuditUpdate))
+	a.False(filtered.Accepts(illustrator.AuditDelete))
+}
@@ -0,0 +1,16 @@
+package illustrator
+
+import (
+	"time"
+)
+
+// TrashedCanvas is the metadata of a deleted canvas which was not purged yet.
+// Trashed canvases keep their name, which cannot be taken by another canvas.
+type TrashedCanvas struct {
+	Name         string    `json:"name"`
+	Key          string    `json:"key"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	DrawingCount int       `json:"drawing_count"`
+	DeletedAt    time.Time `json:"deleted_at"`
+}
@@ -2,6 +2,7 @@ package illustrator
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/go-playground/validator"
 )
@@ -12,8 +13,8 @@ const (
 	// - Height max. 100 characters
 	CanvasMaxWidth  int = 50
 	CanvasMaxHeight int = 100
-	// Canvas max. name length
-	CanvasMaxNameSize int = 15
+	// Canvas max. name length in characters, that of the name columns
+	CanvasMaxNameSize int = 50
 	// Drawing ASCII characters lower/higher limit
 	DrawingCharLowerLimit  rune = 32
 	DrawingCharHigherLimit rune = 126
@@ -49,16 +50,16 @@ func DrawingModelValidation(sl validator.StructLevel) {
 		// Validate number of coordinates
 		if len(drawing.Coordinates) != 2 {
 			sl.ReportError(drawing, "Coordinates", "Coordinates", "only two entries allowed", "")
-		}
-
-		// Validate coordinates value - must be within canvas size range
-		if drawing.Coordinates[0] > CanvasMaxHeight {
-			tag := fmt.Sprintf("invalid 'i' coordinate value, must be less or equal than %d", CanvasMaxHeight)
-			sl.ReportError(drawing, "Coordinates", "Coordinates", tag, "")
-		}
-		if drawing.Coordinates[1] > CanvasMaxWidth {
-			tag := fmt.Sprintf("invalid 'j' coordinate value, must be less or equal than %d", CanvasMaxWidth)
-			sl.ReportError(drawing, "Coordinates", "Coordinates", tag, "")
+		} else {
+			// Validate coordinates value - must be within canvas size range
+			if drawing.Coordinates[0] > CanvasMaxHeight {
+				tag := fmt.Sprintf("invalid 'i' coordinate value, must be less or equal than %d", CanvasMaxHeight)
+				sl.ReportError(drawing, "Coordinates", "Coordinates", tag, "")
+			}
+			if drawing.Coordinates[1] > CanvasMaxWidth {
+				tag := fmt.Sprintf("invalid 'j' coordinate value, must be less or equal than %d", CanvasMaxWidth)
+				sl.ReportError(drawing, "Coordinates", "Coordinates", tag, "")
+			}
 		}
 
 		// Validate drawing dimensions - must be within canvas size range
@@ -76,8 +77,8 @@ func DrawingModelValidation(sl validator.StructLevel) {
 func CanvasModelValidation(sl validator.StructLevel) {
 	if canvas, ok := sl.Current().Interface().(CanvasModel); ok {
 		// Validate canvas name max. length
-		if len(canvas.Name) == 0 && len(canvas.Name) > CanvasMaxNameSize {
-			tag := fmt.Sprintf("canvas name max. size %d exceeded", CanvasMaxNameSize)
+		if !ValidCanvasName(canvas.Name) {
+			tag := fmt.Sprintf("canvas name must be 1 - %d characters", CanvasMaxNameSize)
 			sl.ReportError(canvas, "Name", "Name", tag, "")
 		}
 
@@ -93,7 +94,57 @@ func CanvasModelValidation(sl validator.StructLevel) {
 	}
 }
 
+func BatchRequestValidation(sl validator.StructLevel) {
+	if batch, ok := sl.Current().Interface().(BatchRequest); ok {
+		if len(batch.Operations) == 0 || len(batch.Operations) > BatchMaxOperations {
+			tag := fmt.Sprintf("number of operations must be between 1 - %d", BatchMaxOperations)
+			sl.ReportError(batch, "Operations", "Operations", tag, "")
+		}
+	}
+}
+
+func BatchOperationValidation(sl validator.StructLevel) {
+	if op, ok := sl.Current().Interface().(BatchOperation); ok {
+		switch op.Op {
+		case BatchCreate, BatchUpdate:
+			if op.Canvas == nil {
+				sl.ReportError(op, "Canvas", "Canvas", "canvas required for create and update operations", "")
+			}
+		case BatchDelete:
+			if op.Name == "" {
+				sl.ReportError(op, "Name", "Name", "name required for delete operations", "")
+			}
+		default:
+			sl.ReportError(op, "Op", "Op", "operation must be create, update or delete", "")
+		}
+	}
+}
+
+func WebhookValidation(sl validator.StructLevel) {
+	if webhook, ok := sl.Current().Interface().(Webhook); ok {
+		// Validate webhook URL - deliveries are posted over HTTP
+		if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			sl.ReportError(webhook, "URL", "URL", "url must be an absolute http or https URL", "")
+		}
+
+		// Validate event filter
+		for _, event := range webhook.Events {
+			known := false
+			for _, action := range webhookActions {
+				known = known || event == action
+			}
+			if !known {
+				tag := fmt.Sprintf("unknown event '%s', must be one of %v", event, webhookActions)
+				sl.ReportError(webhook, "Events", "Events", tag, "")
+			}
+		}
+	}
+}
+
 func RegisterValidation(v *validator.Validate) {
 	v.RegisterStructValidation(DrawingModelValidation, DrawingModel{})
 	v.RegisterStructValidation(CanvasModelValidation, CanvasModel{})
+	v.RegisterStructValidation(BatchRequestValidation, BatchRequest{})
+	v.RegisterStructValidation(BatchOperationValidation, BatchOperation{})
+	v.RegisterStructValidation(WebhookValidation, Webhook{})
 }
@@ -0,0 +1,76 @@
+package illustrator
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Max. number of deliveries listed per webhook
+const WebhookMaxDeliveries int = 100
+
+// ErrWebhookNotFound is returned when no webhook has the given ID
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookStore is implemented by storages keeping the webhooks subscribed to
+// the change events of canvases, together with a log of their deliveries.
+type WebhookStore interface {
+	// CreateWebhook stores the webhook, setting its ID and creation time
+	CreateWebhook(ctx context.Context, webhook *Webhook) (err error)
+	// ListWebhooks returns all webhooks including their secrets, oldest first
+	ListWebhooks(ctx context.Context) (webhooks []Webhook, err error)
+	// DeleteWebhook removes the webhook together with its delivery log
+	DeleteWebhook(ctx context.Context, id int64) (err error)
+	// RecordWebhookDelivery appends an attempt to deliver an event to the log
+	RecordWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (err error)
+	// ListWebhookDeliveries returns up to limit deliveries of the webhook, newest first
+	ListWebhookDeliveries(ctx context.Context, id int64, limit int) (deliveries []WebhookDelivery, err error)
+	// WebhookDelivered reports whether the event was delivered to the webhook
+	WebhookDelivered(ctx context.Context, id int64, eventID int64) (ok bool, err error)
+}
+
+// Webhook is a URL the change events of canvases are posted to
+type Webhook struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url" validate:"required"`
+	// Actions of the events posted, all when empty
+	Events []AuditAction `json:"events"`
+	// Key of the HMAC-SHA256 signature of the deliveries, only returned when
+	// the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Accepts reports whether events of the given action are posted to the webhook
+func (w *Webhook) Accepts(action AuditAction) (ok bool) {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == action {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery records an attempt to post an event to a webhook
+type WebhookDelivery struct {
+	ID        int64       `json:"id"`
+	WebhookID int64       `json:"webhook_id"`
+	EventID   int64       `json:"event_id"`
+	Action    AuditAction `json:"action"`
+	Name      string      `json:"name"`
+	// Attempt of the delivery, counting from 1 for each dispatch of the event
+	Attempt int `json:"attempt"`
+	// Status code of the response, zero when there was none
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Delivered  bool   `json:"delivered"`
+	// Time the webhook took to respond
+	DurationMsec int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Actions webhooks can subscribe to
+var webhookActions = []AuditAction{AuditCreate, AuditUpdate, AuditDelete, AuditRename, AuditUndelete, AuditPurge}
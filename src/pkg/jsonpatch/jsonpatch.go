@@ -0,0 +1,353 @@
+// Package jsonpatch applies JSON Patch (RFC 6902) and JSON Merge Patch
+// (RFC 7396) documents to JSON documents.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Media type of JSON Patch documents
+	ContentTypeJSONPatch string = "application/json-patch+json"
+	// Media type of JSON Merge Patch documents
+	ContentTypeMergePatch string = "application/merge-patch+json"
+)
+
+var (
+	// ErrInvalidPatch is returned for malformed patches and operations which
+	// do not apply to the document
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed is returned when a test operation does not match the document
+	ErrTestFailed = errors.New("patch test operation failed")
+)
+
+type operation struct {
+	Op   string  `json:"op"`
+	Path *string `json:"path"`
+	From *string `json:"from"`
+	// Left nil when the member is missing, a JSON null is kept as "null"
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies the JSON Patch operations in order, the document is left
+// unchanged if any of them fails
+func Apply(doc []byte, patch []byte) (patched []byte, err error) {
+	var ops []operation
+	if err = json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	root, err := decode(doc)
+	if err != nil {
+		return
+	}
+
+	for i, op := range ops {
+		if root, err = op.apply(root); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+// ApplyMerge merges the patch into the document, members set to null in the
+// patch are removed
+func ApplyMerge(doc []byte, patch []byte) (patched []byte, err error) {
+	root, err := decode(doc)
+	if err != nil {
+		return
+	}
+
+	value, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(merge(root, value))
+}
+
+func merge(target, patch interface{}) (merged interface{}) {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{})
+	}
+	for key, value := range members {
+		if value == nil {
+			delete(object, key)
+		} else {
+			object[key] = merge(object[key], value)
+		}
+	}
+	return object
+}
+
+func (o *operation) apply(root interface{}) (patched interface{}, err error) {
+	if o.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+	path, err := parsePointer(*o.Path)
+	if err != nil {
+		return
+	}
+
+	switch o.Op {
+	case "add", "replace", "test":
+		var value interface{}
+		if value, err = o.value(); err != nil {
+			return
+		}
+		switch o.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			return replace(root, path, value)
+		}
+
+		var current interface{}
+		if current, err = get(root, path); err != nil {
+			return
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w: %s", ErrTestFailed, *o.Path)
+		}
+		return root, nil
+	case "remove":
+		return remove(root, path)
+	case "move", "copy":
+		if o.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+		var from []string
+		if from, err = parsePointer(*o.From); err != nil {
+			return
+		}
+
+		var value interface{}
+		if value, err = get(root, from); err != nil {
+			return
+		}
+		if o.Op == "copy" {
+			return add(root, path, deepCopy(value))
+		}
+
+		if isPrefix(from, path) && len(from) < len(path) {
+			return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+		}
+		if root, err = remove(root, from); err != nil {
+			return
+		}
+		return add(root, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown operation '%s'", ErrInvalidPatch, o.Op)
+	}
+}
+
+func (o *operation) value() (value interface{}, err error) {
+	if o.Value == nil {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+	}
+	return decode(o.Value)
+}
+
+// decode keeps numbers as written, documents are not changed beyond the patch
+func decode(data []byte) (value interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	return
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens
+func parsePointer(pointer string) (tokens []string, err error) {
+	if pointer == "" {
+		return
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path '%s' must start with '/'", ErrInvalidPatch, pointer)
+	}
+
+	tokens = strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return
+}
+
+func isPrefix(prefix, path []string) (ok bool) {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(node interface{}, path []string) (value interface{}, err error) {
+	for _, token := range path {
+		if node, err = child(node, token); err != nil {
+			return
+		}
+	}
+	return node, nil
+}
+
+// child returns the member or element the token refers to
+func child(node interface{}, token string) (value interface{}, err error) {
+	switch container := node.(type) {
+	case map[string]interface{}:
+		value, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: member '%s' not found", ErrInvalidPatch, token)
+		}
+		return value, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		return container[index], nil
+	default:
+		return nil, fmt.Errorf("%w: '%s' does not refer to a container", ErrInvalidPatch, token)
+	}
+}
+
+// arrayIndex parses an array index token, which must not exceed max
+func arrayIndex(token string, max int) (index int, err error) {
+	index, err = strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, fmt.Errorf("%w: invalid array index '%s'", ErrInvalidPatch, token)
+	}
+	if index > max {
+		return 0, fmt.Errorf("%w: array index %d out of range", ErrInvalidPatch, index)
+	}
+	return
+}
+
+// modify calls fn with the container the path points into and the last path
+// token, then stores the modified container in its parents
+func modify(node interface{}, path []string,
+	fn func(container interface{}, token string) (interface{}, error)) (modified interface{}, err error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	value, err := child(node, path[0])
+	if err != nil {
+		return
+	}
+	if value, err = modify(value, path[1:], fn); err != nil {
+		return
+	}
+
+	switch container := node.(type) {
+	case map[string]interface{}:
+		container[path[0]] = value
+	case []interface{}:
+		index, _ := strconv.Atoi(path[0])
+		container[index] = value
+	}
+	return node, nil
+}
+
+func add(root interface{}, path []string, value interface{}) (patched interface{}, err error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modify(root, path, func(node interface{}, token string) (interface{}, error) {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("%w: '%s' does not refer to a container", ErrInvalidPatch, token)
+		}
+	})
+}
+
+func remove(root interface{}, path []string) (patched interface{}, err error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	return modify(root, path, func(node interface{}, token string) (interface{}, error) {
+		if _, err := child(node, token); err != nil {
+			return nil, err
+		}
+		switch container := node.(type) {
+		case map[string]interface{}:
+			delete(container, token)
+			return container, nil
+		default:
+			index, _ := strconv.Atoi(token)
+			slice := node.([]interface{})
+			return append(slice[:index], slice[index+1:]...), nil
+		}
+	})
+}
+
+func replace(root interface{}, path []string, value interface{}) (patched interface{}, err error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modify(root, path, func(node interface{}, token string) (interface{}, error) {
+		if _, err := child(node, token); err != nil {
+			return nil, err
+		}
+		switch container := node.(type) {
+		case map[string]interface{}:
+			container[token] = value
+		case []interface{}:
+			index, _ := strconv.Atoi(token)
+			container[index] = value
+		}
+		return node, nil
+	})
+}
+
+func deepCopy(value interface{}) (clone interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, member := range v {
+			object[key] = deepCopy(member)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, element := range v {
+			array[i] = deepCopy(element)
+		}
+		return array
+	default:
+		return v
+	}
+}
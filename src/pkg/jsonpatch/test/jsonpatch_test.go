@@ -0,0 +1,169 @@
+package jsonpatch_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sketch-home-task/src/pkg/jsonpatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	testTable := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+		err      error
+	}{
+		{
+			name:     "Test add object member",
+			doc:      `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			expected: `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:     "Test add array element",
+			doc:      `{"foo": ["bar", "baz"]}`,
+			patch:    `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			expected: `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:     "Test add to the end of an array",
+			doc:      `{"foo": [1, 2]}`,
+			patch:    `[{"op": "add", "path": "/foo/-", "value": {"a": null}}]`,
+			expected: `{"foo": [1, 2, {"a": null}]}`,
+		},
+		{
+			name:     "Test remove array element",
+			doc:      `{"foo": ["bar", "qux", "baz"]}`,
+			patch:    `[{"op": "remove", "path": "/foo/1"}]`,
+			expected: `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:     "Test replace nested value",
+			doc:      `{"drawings": [{"width": 1.50}]}`,
+			patch:    `[{"op": "replace", "path": "/drawings/0/width", "value": 3}]`,
+			expected: `{"drawings": [{"width": 3}]}`,
+		},
+		{
+			name:     "Test move and copy",
+			doc:      `{"a": {"b": 1}, "c": []}`,
+			patch:    `[{"op": "copy", "from": "/a/b", "path": "/c/0"}, {"op": "move", "from": "/a", "path": "/d"}]`,
+			expected: `{"c": [1], "d": {"b": 1}}`,
+		},
+		{
+			name:     "Test escaped pointer",
+			doc:      `{"a/b": 1, "m~n": 2}`,
+			patch:    `[{"op": "remove", "path": "/a~1b"}, {"op": "test", "path": "/m~0n", "value": 2}]`,
+			expected: `{"m~n": 2}`,
+		},
+		{
+			name:  "Test failed test operation",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "/a", "value": 2}, {"op": "test", "path": "/a", "value": 1}]`,
+			err:   jsonpatch.ErrTestFailed,
+		},
+		{
+			name:  "Test replace missing member",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "/b", "value": 2}]`,
+			err:   jsonpatch.ErrInvalidPatch,
+		},
+		{
+			name:  "Test array index out of range",
+			doc:   `{"a": [1]}`,
+			patch: `[{"op": "add", "path": "/a/2", "value": 2}]`,
+			err:   jsonpatch.ErrInvalidPatch,
+		},
+		{
+			name:  "Test array index with leading zero",
+			doc:   `{"a": [1, 2]}`,
+			patch: `[{"op": "remove", "path": "/a/01"}]`,
+			err:   jsonpatch.ErrInvalidPatch,
+		},
+		{
+			name:  "Test move into itself",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/a/c"}]`,
+			err:   jsonpatch.ErrInvalidPatch,
+		},
+		{
+			name:  "Test missing value",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "add", "path": "/b"}]`,
+			err:   jsonpatch.ErrInvalidPatch,
+		},
+		{
+			name:  "Test unknown operation",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "increment", "path": "/a"}]`,
+			err:   jsonpatch.ErrInvalidPatch,
+		},
+		{
+			name:  "Test patch not an array",
+			doc:   `{"a": 1}`,
+			patch: `{"a": 2}`,
+			err:   jsonpatch.ErrInvalidPatch,
+		},
+	}
+
+	a := assert.New(t)
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := jsonpatch.Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				a.True(errors.Is(err, tt.err), "unexpected error %v", err)
+				return
+			}
+			a.NoError(err)
+			a.JSONEq(tt.expected, string(patched))
+		})
+	}
+}
+
+func TestApplyMerge(t *testing.T) {
+	testTable := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "Test merge members",
+			doc:      `{"a": "b", "c": {"d": "e", "f": "g"}}`,
+			patch:    `{"a": "z", "c": {"f": null}}`,
+			expected: `{"a": "z", "c": {"d": "e"}}`,
+		},
+		{
+			name:     "Test arrays are replaced",
+			doc:      `{"a": [1, 2]}`,
+			patch:    `{"a": [3]}`,
+			expected: `{"a": [3]}`,
+		},
+		{
+			name:     "Test object replaces scalar",
+			doc:      `{"a": 1}`,
+			patch:    `{"a": {"b": null, "c": 2}}`,
+			expected: `{"a": {"c": 2}}`,
+		},
+		{
+			name:     "Test scalar patch replaces document",
+			doc:      `{"a": 1}`,
+			patch:    `[1]`,
+			expected: `[1]`,
+		},
+	}
+
+	a := assert.New(t)
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := jsonpatch.ApplyMerge([]byte(tt.doc), []byte(tt.patch))
+			a.NoError(err)
+			a.JSONEq(tt.expected, string(patched))
+		})
+	}
+
+	_, err := jsonpatch.ApplyMerge([]byte(`{}`), []byte(`{`))
+	a.True(errors.Is(err, jsonpatch.ErrInvalidPatch))
+}
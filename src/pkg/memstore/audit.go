@@ -0,0 +1,38 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// ListAudit returns the audit log of the canvas, oldest change first. Once no
+// canvas holds the name, the audit log of the canvas last purged under it is
+// returned.
+func (s *Storage) ListAudit(ctx context.Context, name string) (entries []illustrator.AuditEntry, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	audit, ok := s.purged[illustrator.CanvasKey(name)]
+	if stored, stays := s.canvases[illustrator.CanvasKeyHash(name)]; stays {
+		audit, ok = stored.Audit, stored.DeletedAt.IsZero()
+	}
+	if !ok {
+		err = illustrator.ErrCanvasNotFound
+		return
+	}
+
+	entries = make([]illustrator.AuditEntry, len(audit))
+	for i, entry := range audit {
+		entries[i] = entry
+		if entry.Diff != nil {
+			diff := *entry.Diff
+			entries[i].Diff = &diff
+		}
+	}
+	return
+}
@@ -0,0 +1,132 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Batch runs the operations holding the write lock, so no other change
+// interleaves. Atomic batches are rolled back to the canvases as they were
+// before the batch when an operation fails.
+func (s *Storage) Batch(ctx context.Context, ops []illustrator.BatchOperation, atomic bool) (results []illustrator.BatchResult,
+	err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.snapshot()
+
+	results = make([]illustrator.BatchResult, 0, len(ops))
+	for i := range ops {
+		result := illustrator.NewBatchResult(i, &ops[i], s.runBatchOperation(ctx, &ops[i]))
+		results = append(results, result)
+
+		if atomic && result.Failed() {
+			err = s.restore(&snapshot)
+			if err != nil {
+				return nil, err
+			}
+			return illustrator.AbortBatch(ops, results), illustrator.ErrBatchAborted
+		}
+	}
+	return
+}
+
+func (s *Storage) runBatchOperation(ctx context.Context, op *illustrator.BatchOperation) (err error) {
+	switch op.Op {
+	case illustrator.BatchCreate:
+		return s.create(ctx, op.Canvas)
+	case illustrator.BatchUpdate:
+		_, err = s.update(ctx, op.Canvas)
+		return
+	case illustrator.BatchDelete:
+		return s.delete(ctx, op.Name)
+	default:
+		return fmt.Errorf("unknown batch operation '%s'", op.Op)
+	}
+}
+
+// WithTx runs fn holding the write lock, so no other change interleaves. The
+// canvases are rolled back to the way they were before fn when it fails.
+// Calls nested in fn join its transaction.
+func (s *Storage) WithTx(ctx context.Context, fn illustrator.TxFunc) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+	if _, ok := s.mu.(heldLock); ok {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.snapshot()
+	if err = fn(&Storage{mu: heldLock{}, tables: s.tables}); err != nil {
+		if restoreErr := s.restore(&snapshot); restoreErr != nil {
+			return restoreErr
+		}
+	}
+	return
+}
+
+// snapshot returns the canvases as they are now. Records and audit logs are
+// replaced rather than modified, a copy of the maps is a snapshot. The rows
+// logged since are told apart on restore. The caller must hold the write lock.
+func (s *Storage) snapshot() (snapshot tables) {
+	snapshot = tables{
+		canvases: make(map[string]*record, len(s.canvases)),
+		purged:   make(map[string][]illustrator.AuditEntry, len(s.purged)),
+		lastID:   s.lastID,
+		dir:      s.dir,
+	}
+	for hash, rec := range s.canvases {
+		snapshot.canvases[hash] = rec
+	}
+	for key, audit := range s.purged {
+		snapshot.purged[key] = audit
+	}
+	return
+}
+
+// restore reverts the canvases changed since the snapshot was taken, the
+// canvas files included. The caller must hold the write lock.
+func (s *Storage) restore(snapshot *tables) (err error) {
+	for hash, rec := range s.canvases {
+		if _, ok := snapshot.canvases[hash]; !ok {
+			if err = s.remove(rec); err != nil {
+				return
+			}
+		}
+	}
+	// Canvases created since, purged ones included, drop their logs. The
+	// logs of the others are cut back when their records are written again.
+	for id := range s.logged {
+		if id <= snapshot.lastID {
+			continue
+		}
+		if err = s.removeLog(versionTableDir, id); err != nil {
+			return
+		}
+		if err = s.removeLog(auditTableDir, id); err != nil {
+			return
+		}
+		delete(s.logged, id)
+	}
+	for hash, previous := range snapshot.canvases {
+		if s.canvases[hash] != previous {
+			if err = s.persist(previous); err != nil {
+				return
+			}
+		}
+	}
+
+	s.canvases = snapshot.canvases
+	s.purged = snapshot.purged
+	s.lastID = snapshot.lastID
+	return
+}
@@ -0,0 +1,89 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// AppendDrawing adds a drawing on top of the canvas drawings
+func (s *Storage) AppendDrawing(ctx context.Context, name string, revision int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	return s.modifyDrawings(ctx, name, revision, -1, check, func(drawings illustrator.DrawingSlice) illustrator.DrawingSlice {
+		return append(drawings, drawing.Clone())
+	})
+}
+
+// ReplaceDrawing overwrites the drawing at the given index
+func (s *Storage) ReplaceDrawing(ctx context.Context, name string, revision int, index int, drawing *illustrator.DrawingModel,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	if index < 0 {
+		return nil, illustrator.ErrDrawingNotFound
+	}
+
+	return s.modifyDrawings(ctx, name, revision, index, check, func(drawings illustrator.DrawingSlice) illustrator.DrawingSlice {
+		drawings[index] = drawing.Clone()
+		return drawings
+	})
+}
+
+// RemoveDrawing deletes the drawing at the given index, the following drawings move down
+func (s *Storage) RemoveDrawing(ctx context.Context, name string, revision int, index int,
+	check illustrator.CanvasCheck) (canvas *illustrator.CanvasModel, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	if index < 0 {
+		return nil, illustrator.ErrDrawingNotFound
+	}
+
+	return s.modifyDrawings(ctx, name, revision, index, check, func(drawings illustrator.DrawingSlice) illustrator.DrawingSlice {
+		return append(drawings[:index], drawings[index+1:]...)
+	})
+}
+
+// modifyDrawings applies modify to a copy of the canvas drawings after checking
+// the revision and the drawing index, a negative index is not checked. The
+// resulting canvas is checked before storing it.
+func (s *Storage) modifyDrawings(ctx context.Context, name string, revision int, index int, check illustrator.CanvasCheck,
+	modify func(drawings illustrator.DrawingSlice) illustrator.DrawingSlice) (canvas *illustrator.CanvasModel, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.live(name)
+	if !ok {
+		return nil, illustrator.ErrCanvasNotFound
+	}
+	if revision != 0 && revision != stored.Canvas.Revision {
+		return nil, illustrator.ErrConflict
+	}
+	if index >= len(stored.Canvas.Drawings) {
+		return nil, illustrator.ErrDrawingNotFound
+	}
+
+	rec := *stored
+	rec.Canvas = stored.Canvas.Clone()
+	rec.Canvas.Drawings = modify(rec.Canvas.Drawings)
+
+	canvas = rec.canvas()
+	canvas.Revision++
+	if check != nil {
+		if err = check(canvas); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.commitRevision(ctx, stored, &rec); err != nil {
+		return nil, err
+	}
+	return
+}
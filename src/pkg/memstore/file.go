@@ -0,0 +1,499 @@
+package memstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+const (
+	// Directory holding one file per canvas, the equivalent of the canvas table
+	canvasTableDir string = "canvas"
+	// Directory holding the versions of the canvases, one file per canvas named
+	// after its ID with a row of the canvas_versions table per line
+	versionTableDir string = "canvas_versions"
+	// Directory holding the audit logs of the canvases, purged ones included,
+	// one file per canvas named after its ID with a row of the canvas_audit
+	// table per line
+	auditTableDir string = "canvas_audit"
+	fileExtension string = ".json"
+	logExtension  string = ".jsonl"
+)
+
+// fileRecord is the on-disk layout of a canvas, column names follow the canvas
+// table
+type fileRecord struct {
+	CanvasID    int64                    `json:"canvas_id"`
+	Name        string                   `json:"name"`
+	DisplayName string                   `json:"display_name"`
+	NameHash    string                   `json:"name_hash"`
+	Width       int                      `json:"width"`
+	Height      int                      `json:"height"`
+	Drawings    illustrator.DrawingSlice `json:"drawings"`
+	Revision    int                      `json:"revision"`
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+	DeletedAt   *time.Time               `json:"deleted_at,omitempty"`
+	ForkedFrom  int64                    `json:"forked_from,omitempty"`
+}
+
+type fileVersion struct {
+	Version   int                      `json:"version"`
+	Width     int                      `json:"width"`
+	Height    int                      `json:"height"`
+	Drawings  illustrator.DrawingSlice `json:"drawings"`
+	CreatedAt time.Time                `json:"created_at"`
+}
+
+// logLengths counts the rows in the version and audit files of a canvas
+type logLengths struct {
+	versions int
+	audit    int
+}
+
+// NewFileStorage returns a storage keeping one JSON file per canvas in dir,
+// next to the append-only files of its versions and audit log. The directory
+// layout is created on startup and existing canvases are loaded.
+func NewFileStorage(dir string) (s illustrator.CanvasStorage, err error) {
+	storage := newStorage(dir)
+
+	if err = storage.createSchema(); err != nil {
+		return
+	}
+	if err = storage.load(); err != nil {
+		return
+	}
+
+	s = storage
+	return
+}
+
+func (s *Storage) createSchema() (err error) {
+	for _, table := range []string{canvasTableDir, versionTableDir, auditTableDir} {
+		if err = os.MkdirAll(filepath.Join(s.dir, table), 0o755); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Storage) load() (err error) {
+	tableDir := filepath.Join(s.dir, canvasTableDir)
+	entries, err := os.ReadDir(tableDir)
+	if err != nil {
+		return
+	}
+
+	// Canvases by ID, to spot the files left by an interrupted rename
+	loaded := make(map[int64]*record, len(entries))
+	for _, entry := range entries {
+		// Skip leftovers of interrupted writes
+		if entry.IsDir() || filepath.Ext(entry.Name()) != fileExtension {
+			continue
+		}
+
+		var data []byte
+		data, err = os.ReadFile(filepath.Join(tableDir, entry.Name()))
+		if err != nil {
+			return
+		}
+
+		var row fileRecord
+		if err = json.Unmarshal(data, &row); err != nil {
+			return fmt.Errorf("failed to load canvas file '%s': %w", entry.Name(), err)
+		}
+
+		rec := &record{
+			ID:       row.CanvasID,
+			Key:      row.Name,
+			NameHash: row.NameHash,
+			Canvas: &illustrator.CanvasModel{
+				Name:     row.DisplayName,
+				Width:    row.Width,
+				Height:   row.Height,
+				Drawings: row.Drawings,
+				Revision: row.Revision,
+			},
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+			ForkedFrom: row.ForkedFrom,
+		}
+		if row.DeletedAt != nil {
+			rec.DeletedAt = *row.DeletedAt
+		}
+
+		// The file written last holds the later revision, the other one is stale
+		if other, ok := loaded[rec.ID]; ok {
+			stale := other
+			if rec.Canvas.Revision < other.Canvas.Revision {
+				stale, rec = rec, other
+			}
+			log.Printf("[INFO] removing stale file of canvas %d named '%s'\n", stale.ID, stale.Key)
+			if err = s.remove(stale); err != nil {
+				return
+			}
+			delete(s.canvases, stale.NameHash)
+		}
+		loaded[rec.ID] = rec
+
+		s.canvases[rec.NameHash] = rec
+		if row.CanvasID > s.lastID {
+			s.lastID = row.CanvasID
+		}
+	}
+
+	for _, rec := range loaded {
+		if err = s.loadLogs(rec); err != nil {
+			return
+		}
+	}
+	return s.loadPurged()
+}
+
+// loadLogs loads the versions and audit log of the canvas
+func (s *Storage) loadLogs(rec *record) (err error) {
+	var logged logLengths
+	logged.versions, err = readLog(s.logPath(versionTableDir, rec.ID), func(row []byte) (err error) {
+		var v fileVersion
+		if err = json.Unmarshal(row, &v); err != nil {
+			return
+		}
+		rec.Versions = append(rec.Versions, versionRecord{
+			Version: v.Version,
+			Canvas: &illustrator.CanvasModel{
+				Width:    v.Width,
+				Height:   v.Height,
+				Drawings: v.Drawings,
+			},
+			CreatedAt: v.CreatedAt,
+		})
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	logged.audit, err = readLog(s.logPath(auditTableDir, rec.ID), func(row []byte) (err error) {
+		var entry illustrator.AuditEntry
+		if err = json.Unmarshal(row, &entry); err != nil {
+			return
+		}
+		rec.Audit = append(rec.Audit, entry)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	s.logged[rec.ID] = logged
+	return
+}
+
+// loadPurged loads the audit logs left by purged canvases, keyed by the name
+// of their purge. Their IDs are not given out again.
+func (s *Storage) loadPurged() (err error) {
+	tableDir := filepath.Join(s.dir, auditTableDir)
+	entries, err := os.ReadDir(tableDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != logExtension {
+			continue
+		}
+		id, parseErr := strconv.ParseInt(strings.TrimSuffix(entry.Name(), logExtension), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		if _, ok := s.logged[id]; ok {
+			continue
+		}
+
+		var audit []illustrator.AuditEntry
+		var count int
+		count, err = readLog(filepath.Join(tableDir, entry.Name()), func(row []byte) (err error) {
+			var entry illustrator.AuditEntry
+			if err = json.Unmarshal(row, &entry); err != nil {
+				return
+			}
+			audit = append(audit, entry)
+			return
+		})
+		if err != nil {
+			return
+		}
+
+		s.logged[id] = logLengths{audit: count}
+		if id > s.lastID {
+			s.lastID = id
+		}
+		if len(audit) == 0 {
+			continue
+		}
+
+		purge := audit[len(audit)-1]
+		key := illustrator.CanvasKey(purge.Name)
+		if other, ok := s.purged[key]; ok && other[len(other)-1].CreatedAt.After(purge.CreatedAt) {
+			continue
+		}
+		s.purged[key] = audit
+	}
+	return
+}
+
+// readLog calls fn with every row of the log file at path, a missing file
+// holds none. A row torn by an interrupted append is cut off.
+func readLog(path string, fn func(row []byte) error) (count int, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return
+	}
+
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		if err = os.Truncate(path, int64(end)); err != nil {
+			return
+		}
+		data = data[:end]
+	}
+
+	for _, row := range bytes.Split(data, []byte{'\n'}) {
+		if len(row) == 0 {
+			continue
+		}
+		if err = fn(row); err != nil {
+			return count, fmt.Errorf("failed to load log file '%s': %w", filepath.Base(path), err)
+		}
+		count++
+	}
+	return
+}
+
+// persist atomically writes the record to its canvas file and appends its new
+// versions and audit entries to their files, a no-op for memory only storage
+func (s *Storage) persist(rec *record) (err error) {
+	if s.dir == "" {
+		return
+	}
+
+	var deletedAt *time.Time
+	if !rec.DeletedAt.IsZero() {
+		deletedAt = &rec.DeletedAt
+	}
+
+	data, err := json.Marshal(&fileRecord{
+		CanvasID:    rec.ID,
+		Name:        rec.Key,
+		DisplayName: rec.Canvas.Name,
+		NameHash:    rec.NameHash,
+		Width:       rec.Canvas.Width,
+		Height:      rec.Canvas.Height,
+		Drawings:    rec.Canvas.Drawings,
+		CreatedAt:   rec.CreatedAt,
+		Revision:    rec.Canvas.Revision,
+		UpdatedAt:   rec.UpdatedAt,
+		DeletedAt:   deletedAt,
+		ForkedFrom:  rec.ForkedFrom,
+	})
+	if err != nil {
+		return
+	}
+	if err = writeFile(s.canvasPath(rec), data); err != nil {
+		return
+	}
+
+	logged := s.logged[rec.ID]
+	err = appendLog(s.logPath(versionTableDir, rec.ID), logged.versions, len(rec.Versions), func(i int) interface{} {
+		v := rec.Versions[i]
+		return &fileVersion{
+			Version:   v.Version,
+			Width:     v.Canvas.Width,
+			Height:    v.Canvas.Height,
+			Drawings:  v.Canvas.Drawings,
+			CreatedAt: v.CreatedAt,
+		}
+	})
+	if err != nil {
+		return
+	}
+	logged.versions = len(rec.Versions)
+	s.logged[rec.ID] = logged
+
+	return s.persistAudit(rec)
+}
+
+// persistAudit appends the new entries of the audit log of the canvas to its
+// file, a no-op for memory only storage
+func (s *Storage) persistAudit(rec *record) (err error) {
+	if s.dir == "" {
+		return
+	}
+
+	logged := s.logged[rec.ID]
+	err = appendLog(s.logPath(auditTableDir, rec.ID), logged.audit, len(rec.Audit), func(i int) interface{} {
+		return &rec.Audit[i]
+	})
+	if err != nil {
+		return
+	}
+	logged.audit = len(rec.Audit)
+	s.logged[rec.ID] = logged
+	return
+}
+
+// appendLog appends the rows past the logged ones to the log file at path. A
+// file holding more rows, the rows of changes rolled back since, is rewritten.
+func appendLog(path string, logged int, count int, row func(i int) interface{}) (err error) {
+	start := logged
+	if logged > count {
+		start = 0
+	}
+
+	var data []byte
+	for i := start; i < count; i++ {
+		var line []byte
+		if line, err = json.Marshal(row(i)); err != nil {
+			return
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if start < logged {
+		return writeFile(path, data)
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	// A failed append is cut off again so the next one starts on a new row
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Truncate(info.Size())
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	// A file created by the append has to be found after a crash as well
+	if info.Size() == 0 {
+		err = syncDir(filepath.Dir(path))
+	}
+	return
+}
+
+// writeFile atomically replaces the file at path by data
+func writeFile(path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	// Make sure the content hits the disk before the rename publishes it
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return
+	}
+	// The rename itself only survives a crash once the directory hits the disk
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes the entries of the directory to disk
+func syncDir(path string) (err error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	if err = dir.Sync(); err != nil {
+		dir.Close()
+		return
+	}
+	return dir.Close()
+}
+
+// remove deletes the canvas file, a no-op for memory only storage
+func (s *Storage) remove(rec *record) (err error) {
+	if s.dir == "" {
+		return
+	}
+	return removeFile(s.canvasPath(rec))
+}
+
+// removeLog deletes the version or audit file of the canvas with the given
+// ID, a no-op for memory only storage
+func (s *Storage) removeLog(table string, id int64) (err error) {
+	if s.dir == "" {
+		return
+	}
+	if err = removeFile(s.logPath(table, id)); err != nil {
+		return
+	}
+
+	logged := s.logged[id]
+	if table == versionTableDir {
+		logged.versions = 0
+	} else {
+		logged.audit = 0
+	}
+	s.logged[id] = logged
+	return
+}
+
+// removeFile deletes the file at path, a missing file is removed already
+func removeFile(path string) (err error) {
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
+// canvasPath returns the file of the canvas, named after its name hash
+func (s *Storage) canvasPath(rec *record) (path string) {
+	return filepath.Join(s.dir, canvasTableDir, rec.NameHash+fileExtension)
+}
+
+// logPath returns the version or audit file of the canvas with the given ID
+func (s *Storage) logPath(table string, id int64) (path string) {
+	return filepath.Join(s.dir, table, strconv.FormatInt(id, 10)+logExtension)
+}
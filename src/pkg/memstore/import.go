@@ -0,0 +1,72 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Import stores a canvas with its timestamps and versions as they are given.
+// The canvas is at the revision of its latest version, its audit log starts
+// with the import.
+func (s *Storage) Import(ctx context.Context, history *illustrator.CanvasHistory) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := newRecord(s.lastID+1, &history.Canvas)
+	if _, ok := s.canvases[rec.NameHash]; ok {
+		return illustrator.ErrCanvasExists
+	}
+
+	rec.CreatedAt = history.CreatedAt
+	rec.UpdatedAt = history.UpdatedAt
+	rec.Canvas.Revision = len(history.Versions)
+	for _, v := range history.Versions {
+		snapshot := v.Canvas.Clone()
+		snapshot.Name = rec.Canvas.Name
+		snapshot.Revision = 0
+		rec.Versions = append(rec.Versions, versionRecord{Version: v.Version, Canvas: snapshot, CreatedAt: v.CreatedAt})
+	}
+	diff := illustrator.DiffDrawings(nil, rec.Canvas.Drawings)
+	rec.recordAudit(ctx, nil, illustrator.AuditEntry{Action: illustrator.AuditCreate, Diff: &diff})
+	if err = s.persist(rec); err != nil {
+		return
+	}
+
+	s.lastID = rec.ID
+	s.canvases[rec.NameHash] = rec
+	return
+}
+
+// LinkFork records parent as the canvas the named one was cloned from, both
+// must be out of the trash
+func (s *Storage) LinkFork(ctx context.Context, name string, parent string) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.live(name)
+	if !ok {
+		return illustrator.ErrCanvasNotFound
+	}
+	forkParent, ok := s.live(parent)
+	if !ok {
+		return illustrator.ErrCanvasNotFound
+	}
+
+	rec := *stored
+	rec.ForkedFrom = forkParent.ID
+	if err = s.persist(&rec); err != nil {
+		return
+	}
+
+	s.canvases[rec.NameHash] = &rec
+	return
+}
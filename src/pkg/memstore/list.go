@@ -0,0 +1,114 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+func (s *Storage) List(ctx context.Context, opts illustrator.ListOptions) (page *illustrator.CanvasPage, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	if err = opts.Normalize(); err != nil {
+		return
+	}
+	cursor, err := opts.DecodeCursor()
+	if err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	byID := make(map[int64]*record, len(s.canvases))
+	for _, rec := range s.canvases {
+		byID[rec.ID] = rec
+	}
+	matches := make([]illustrator.CanvasInfo, 0, len(s.canvases))
+	for _, rec := range s.canvases {
+		// Canvases in the trash are not listed
+		if !rec.DeletedAt.IsZero() {
+			continue
+		}
+		info := rec.info()
+		if parent, ok := byID[rec.ForkedFrom]; ok {
+			info.ForkedFrom = parent.Canvas.Name
+		}
+		if matchesFilters(&info, &opts) {
+			matches = append(matches, info)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return compareInfo(&matches[i], &matches[j], opts.SortBy, opts.Descending) < 0
+	})
+
+	// Skip the canvases up to and including the cursor position
+	start := 0
+	if cursor != nil {
+		last := &illustrator.CanvasInfo{Key: cursor.Key, CreatedAt: cursor.Time, UpdatedAt: cursor.Time}
+		start = sort.Search(len(matches), func(i int) bool {
+			return compareInfo(&matches[i], last, opts.SortBy, opts.Descending) > 0
+		})
+	}
+
+	page = &illustrator.CanvasPage{Canvases: []illustrator.CanvasInfo{}}
+	end := start + opts.Limit
+	if end < len(matches) {
+		page.Canvases = append(page.Canvases, matches[start:end]...)
+		page.NextCursor = illustrator.NewListCursor(opts.SortBy, &matches[end-1])
+	} else {
+		page.Canvases = append(page.Canvases, matches[start:]...)
+	}
+	return
+}
+
+func (r *record) info() (info illustrator.CanvasInfo) {
+	return illustrator.CanvasInfo{
+		Name:         r.Canvas.Name,
+		Key:          r.Key,
+		Width:        r.Canvas.Width,
+		Height:       r.Canvas.Height,
+		DrawingCount: len(r.Canvas.Drawings),
+		CreatedAt:    r.CreatedAt,
+		UpdatedAt:    r.UpdatedAt,
+	}
+}
+
+func matchesFilters(info *illustrator.CanvasInfo, opts *illustrator.ListOptions) (ok bool) {
+	return (opts.MinWidth == 0 || info.Width >= opts.MinWidth) &&
+		(opts.MaxWidth == 0 || info.Width <= opts.MaxWidth) &&
+		(opts.MinHeight == 0 || info.Height >= opts.MinHeight) &&
+		(opts.MaxHeight == 0 || info.Height <= opts.MaxHeight)
+}
+
+// compareInfo orders canvases the same way the Postgres storage does
+func compareInfo(a, b *illustrator.CanvasInfo, sortBy illustrator.ListSortField, descending bool) (cmp int) {
+	switch sortBy {
+	case illustrator.ListSortByCreated:
+		cmp = compareTime(a.CreatedAt, b.CreatedAt)
+	case illustrator.ListSortByUpdated:
+		cmp = compareTime(a.UpdatedAt, b.UpdatedAt)
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(a.Key, b.Key)
+	}
+	if descending {
+		cmp = -cmp
+	}
+	return
+}
+
+func compareTime(a, b time.Time) (cmp int) {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,303 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Storage is an in-memory canvas storage safe for concurrent use. When created
+// with NewFileStorage every change is written through to a directory as well.
+type Storage struct {
+	mu rwLocker
+	*tables
+}
+
+// tables holds the canvases, shared with the storages given to a TxFunc
+type tables struct {
+	// Canvases by hash of their key, the same way the Postgres storage looks them up
+	canvases map[string]*record
+	// Audit logs of purged canvases by the key they were purged under, the
+	// canvas purged last wins
+	purged map[string][]illustrator.AuditEntry
+	lastID int64
+	// Directory the canvases are persisted to, empty for memory only storage
+	dir string
+	// Rows in the version and audit files by canvas ID, purged ones included
+	logged map[int64]logLengths
+}
+
+type rwLocker interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+}
+
+// heldLock stands in for the lock of a storage held by WithTx already
+type heldLock struct{}
+
+func (heldLock) Lock()    {}
+func (heldLock) Unlock()  {}
+func (heldLock) RLock()   {}
+func (heldLock) RUnlock() {}
+
+// record mirrors a row of the canvas table, the canvas name is the display name
+type record struct {
+	ID        int64
+	Key       string
+	NameHash  string
+	Canvas    *illustrator.CanvasModel
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Zero unless the canvas is in the trash
+	DeletedAt time.Time
+	// ID of the canvas this one was cloned from, zero if none
+	ForkedFrom int64
+	// Rows of the canvas_versions table belonging to the canvas, oldest first
+	Versions []versionRecord
+	// Rows of the canvas_audit table belonging to the canvas, oldest first
+	Audit []illustrator.AuditEntry
+}
+
+// versionRecord is an immutable snapshot of the canvas content
+type versionRecord struct {
+	Version   int
+	Canvas    *illustrator.CanvasModel
+	CreatedAt time.Time
+}
+
+func NewStorage() (s illustrator.CanvasStorage) {
+	return newStorage("")
+}
+
+func newStorage(dir string) (s *Storage) {
+	return &Storage{
+		mu: new(sync.RWMutex),
+		tables: &tables{
+			canvases: make(map[string]*record),
+			purged:   make(map[string][]illustrator.AuditEntry),
+			dir:      dir,
+			logged:   make(map[int64]logLengths),
+		},
+	}
+}
+
+func newRecord(id int64, canvas *illustrator.CanvasModel) (rec *record) {
+	return &record{
+		ID:       id,
+		Key:      illustrator.CanvasKey(canvas.Name),
+		NameHash: illustrator.CanvasKeyHash(canvas.Name),
+		Canvas:   canvas.Clone(),
+	}
+}
+
+// canvas returns a copy of the stored canvas
+func (r *record) canvas() (canvas *illustrator.CanvasModel) {
+	return r.Canvas.Clone()
+}
+
+// recordVersion appends the current content to the previous versions of the canvas
+func (r *record) recordVersion(previous []versionRecord) {
+	snapshot := r.Canvas.Clone()
+	snapshot.Revision = 0
+	r.Versions = append(previous, versionRecord{
+		Version:   len(previous) + 1,
+		Canvas:    snapshot,
+		CreatedAt: r.UpdatedAt,
+	})
+}
+
+// recordAudit appends the entry for a change of the canvas, made by the actor
+// of the context, to the previous entries of the canvas
+func (r *record) recordAudit(ctx context.Context, previous []illustrator.AuditEntry, entry illustrator.AuditEntry) {
+	actor := illustrator.ActorFromContext(ctx)
+	entry.Name = r.Canvas.Name
+	entry.Actor = actor.Name
+	entry.RequestID = actor.RequestID
+	entry.Revision = r.Canvas.Revision
+	entry.CreatedAt = timestamp()
+	r.Audit = append(previous, entry)
+}
+
+// live returns the record of a canvas which is not in the trash. The caller
+// must hold the lock.
+func (s *Storage) live(name string) (rec *record, ok bool) {
+	rec, ok = s.canvases[illustrator.CanvasKeyHash(name)]
+	if ok && !rec.DeletedAt.IsZero() {
+		return nil, false
+	}
+	return
+}
+
+// checkContext reports a context which ended before the operation started,
+// the same way the Postgres storage does
+func checkContext(ctx context.Context) (err error) {
+	if err = ctx.Err(); errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %v", illustrator.ErrTimeout, err)
+	}
+	return
+}
+
+func (s *Storage) Close() (err error) {
+	return
+}
+
+func (s *Storage) FindByName(ctx context.Context, name string) (canvas *illustrator.CanvasModel, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.live(name)
+	if !ok {
+		err = illustrator.ErrCanvasNotFound
+		return
+	}
+
+	canvas = stored.canvas()
+	return
+}
+
+func (s *Storage) Create(ctx context.Context, canvas *illustrator.CanvasModel) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.create(ctx, canvas)
+}
+
+func (s *Storage) create(ctx context.Context, canvas *illustrator.CanvasModel) (err error) {
+	return s.insert(ctx, newRecord(s.lastID+1, canvas))
+}
+
+// Clone copies a canvas and records it as the fork parent of the copy
+func (s *Storage) Clone(ctx context.Context, name string, cloneName string) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parent, ok := s.live(name)
+	if !ok {
+		return illustrator.ErrCanvasNotFound
+	}
+
+	canvas := parent.Canvas.Clone()
+	canvas.Name = cloneName
+	rec := newRecord(s.lastID+1, canvas)
+	rec.ForkedFrom = parent.ID
+	return s.insert(ctx, rec)
+}
+
+// insert stores a new canvas record. The caller must hold the write lock.
+func (s *Storage) insert(ctx context.Context, rec *record) (err error) {
+	if _, ok := s.canvases[rec.NameHash]; ok {
+		return illustrator.ErrCanvasExists
+	}
+
+	rec.CreatedAt = timestamp()
+	rec.UpdatedAt = rec.CreatedAt
+	rec.Canvas.Revision = 1
+	rec.recordVersion(nil)
+	diff := illustrator.DiffDrawings(nil, rec.Canvas.Drawings)
+	rec.recordAudit(ctx, nil, illustrator.AuditEntry{Action: illustrator.AuditCreate, Diff: &diff})
+	if err = s.persist(rec); err != nil {
+		return
+	}
+
+	s.lastID = rec.ID
+	s.canvases[rec.NameHash] = rec
+	return
+}
+
+// When the canvas has a revision the update only applies to that revision,
+// otherwise ErrConflict is returned.
+func (s *Storage) Update(ctx context.Context, canvas *illustrator.CanvasModel) (newRevision int, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(ctx, canvas)
+}
+
+func (s *Storage) update(ctx context.Context, canvas *illustrator.CanvasModel) (newRevision int, err error) {
+	stored, ok := s.live(canvas.Name)
+	if !ok {
+		return 0, illustrator.ErrCanvasNotFound
+	}
+	if canvas.Revision != 0 && canvas.Revision != stored.Canvas.Revision {
+		return 0, illustrator.ErrConflict
+	}
+
+	rec := newRecord(stored.ID, canvas)
+	rec.CreatedAt = stored.CreatedAt
+	rec.ForkedFrom = stored.ForkedFrom
+	if err = s.commitRevision(ctx, stored, rec); err != nil {
+		return
+	}
+	return rec.Canvas.Revision, nil
+}
+
+// commitRevision stores rec, holding the new content of the stored record, as
+// its next revision. The caller must hold the write lock.
+func (s *Storage) commitRevision(ctx context.Context, stored, rec *record) (err error) {
+	rec.Canvas.Revision = stored.Canvas.Revision + 1
+	rec.UpdatedAt = timestamp()
+	rec.recordVersion(stored.Versions)
+	diff := illustrator.DiffDrawings(stored.Canvas.Drawings, rec.Canvas.Drawings)
+	rec.recordAudit(ctx, stored.Audit, illustrator.AuditEntry{Action: illustrator.AuditUpdate, Diff: &diff})
+	if err = s.persist(rec); err != nil {
+		return
+	}
+
+	s.canvases[rec.NameHash] = rec
+	return
+}
+
+// Delete moves the canvas to the trash, from where it can be restored until purged
+func (s *Storage) Delete(ctx context.Context, name string) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(ctx, name)
+}
+
+func (s *Storage) delete(ctx context.Context, name string) (err error) {
+	stored, ok := s.live(name)
+	if !ok {
+		return illustrator.ErrCanvasNotFound
+	}
+
+	rec := *stored
+	rec.DeletedAt = timestamp()
+	rec.recordAudit(ctx, stored.Audit, illustrator.AuditEntry{Action: illustrator.AuditDelete})
+	if err = s.persist(&rec); err != nil {
+		return
+	}
+
+	s.canvases[rec.NameHash] = &rec
+	return
+}
+
+// timestamp returns the current time with the precision of a Postgres timestamp
+func timestamp() (t time.Time) {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
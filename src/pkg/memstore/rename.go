@@ -0,0 +1,57 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// Rename changes the name of a canvas, which keeps its history. When a revision
+// is given the rename only applies to that revision, otherwise ErrConflict is
+// returned. Names of trashed canvases are taken as well.
+func (s *Storage) Rename(ctx context.Context, name string, revision int, newName string) (newRevision int, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.live(name)
+	if !ok {
+		return 0, illustrator.ErrCanvasNotFound
+	}
+	if revision != 0 && revision != stored.Canvas.Revision {
+		return 0, illustrator.ErrConflict
+	}
+
+	rec := *stored
+	rec.Key = illustrator.CanvasKey(newName)
+	rec.NameHash = illustrator.CanvasKeyHash(newName)
+	if _, ok := s.canvases[rec.NameHash]; ok && rec.NameHash != stored.NameHash {
+		return 0, illustrator.ErrCanvasExists
+	}
+	rec.Canvas = stored.Canvas.Clone()
+	rec.Canvas.Name = newName
+	rec.Canvas.Revision++
+	rec.UpdatedAt = timestamp()
+	rec.recordAudit(ctx, stored.Audit, illustrator.AuditEntry{Action: illustrator.AuditRename, PreviousName: stored.Canvas.Name})
+
+	// The new file is written first, a failure leaves the canvas under its old name
+	if err = s.persist(&rec); err != nil {
+		return
+	}
+	if rec.NameHash != stored.NameHash {
+		if err = s.remove(stored); err != nil {
+			// Roll back to the old file, which load would see twice otherwise
+			if rollbackErr := s.remove(&rec); rollbackErr == nil {
+				s.persist(stored)
+			}
+			return
+		}
+		delete(s.canvases, stored.NameHash)
+	}
+
+	s.canvases[rec.NameHash] = &rec
+	return rec.Canvas.Revision, nil
+}
@@ -0,0 +1,276 @@
+package memstore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/memstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorageSchema(t *testing.T) {
+	a := assert.New(t)
+	dir := filepath.Join(t.TempDir(), "data")
+
+	_, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	for _, table := range []string{"canvas", "canvas_versions", "canvas_audit"} {
+		info, err := os.Stat(filepath.Join(dir, table))
+		a.NoError(err)
+		a.True(info.IsDir())
+	}
+}
+
+func TestFileStorageReload(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+	hashRune := '#'
+
+	storage, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	first := illustrator.CanvasModel{
+		Name:   "first",
+		Width:  10,
+		Height: 10,
+		Drawings: []illustrator.DrawingModel{
+			{Coordinates: []int{1, 1}, Width: 2, Height: 2, Fill: &hashRune},
+		},
+	}
+	second := illustrator.CanvasModel{Name: "second", Width: 5, Height: 5}
+
+	err = storage.Create(ctx, &first)
+	a.NoError(err)
+	err = storage.Create(ctx, &second)
+	a.NoError(err)
+	second.Width = 7
+	_, err = storage.Update(ctx, &second)
+	a.NoError(err)
+	err = storage.Delete(ctx, first.Name)
+	a.NoError(err)
+	a.NoError(storage.Close())
+
+	// Canvas files are named after the name hash
+	_, err = os.Stat(filepath.Join(dir, "canvas", illustrator.CanvasKeyHash(second.Name)+".json"))
+	a.NoError(err)
+
+	// Versions and audit entries are appended a row per line
+	a.Equal(2, countRows(t, filepath.Join(dir, "canvas_versions", "2.jsonl")))
+	a.Equal(2, countRows(t, filepath.Join(dir, "canvas_audit", "2.jsonl")))
+
+	// A row torn by an interrupted append is cut off
+	auditFile, err := os.OpenFile(filepath.Join(dir, "canvas_audit", "2.jsonl"), os.O_WRONLY|os.O_APPEND, 0o644)
+	a.NoError(err)
+	_, err = auditFile.WriteString(`{"action":"upd`)
+	a.NoError(err)
+	a.NoError(auditFile.Close())
+
+	// Leftover of an interrupted write must be ignored
+	tmpFile := filepath.Join(dir, "canvas", ".leftover.json.tmp123")
+	a.NoError(os.WriteFile(tmpFile, []byte("{"), 0o644))
+
+	reopened, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	_, err = reopened.FindByName(ctx, first.Name)
+	a.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	canvas, err := reopened.FindByName(ctx, second.Name)
+	a.NoError(err)
+	second.Revision = 2
+	a.Equal(second, *canvas)
+
+	versions, err := reopened.ListVersions(ctx, second.Name)
+	a.NoError(err)
+	a.Len(versions, 2)
+	canvas, err = reopened.FindVersion(ctx, second.Name, 1)
+	a.NoError(err)
+	a.Equal(5, canvas.Width)
+	entries, err := reopened.ListAudit(ctx, second.Name)
+	a.NoError(err)
+	a.Len(entries, 2)
+	a.Equal(illustrator.AuditUpdate, entries[1].Action)
+	a.Equal(&illustrator.DrawingsDiff{}, entries[1].Diff)
+
+	// Names stay unique across restarts
+	err = reopened.Create(ctx, &second)
+	a.True(errors.Is(err, illustrator.ErrCanvasExists))
+
+	_, err = reopened.Update(ctx, &second)
+	a.NoError(err)
+	a.Equal(3, countRows(t, filepath.Join(dir, "canvas_audit", "2.jsonl")))
+}
+
+// countRows returns the number of rows in the log file at path
+func countRows(t *testing.T, path string) (count int) {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return bytes.Count(data, []byte{'\n'})
+}
+
+func TestFileStorageBatchRollback(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	storage, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	first := illustrator.CanvasModel{Name: "first", Width: 10, Height: 10}
+	err = storage.Create(ctx, &first)
+	a.NoError(err)
+
+	second := illustrator.CanvasModel{Name: "second", Width: 5, Height: 5}
+	_, err = storage.Batch(ctx, []illustrator.BatchOperation{
+		{Op: illustrator.BatchCreate, Canvas: &second},
+		{Op: illustrator.BatchDelete, Name: first.Name},
+		{Op: illustrator.BatchCreate, Canvas: &second},
+	}, true)
+	a.True(errors.Is(err, illustrator.ErrBatchAborted))
+
+	// The canvas files are rolled back as well
+	reopened, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	_, err = reopened.FindByName(ctx, first.Name)
+	a.NoError(err)
+	_, err = reopened.FindByName(ctx, second.Name)
+	a.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	// So are the logs, the rows of the canvas created in the batch included
+	entries, err := os.ReadDir(filepath.Join(dir, "canvas_versions"))
+	a.NoError(err)
+	a.Len(entries, 1)
+	a.Equal(1, countRows(t, filepath.Join(dir, "canvas_audit", "1.jsonl")))
+	_, err = os.Stat(filepath.Join(dir, "canvas_audit", "2.jsonl"))
+	a.True(errors.Is(err, os.ErrNotExist))
+}
+
+func TestFileStorageTrashReload(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	storage, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	canvas := illustrator.CanvasModel{Name: "trashed", Width: 10, Height: 10}
+	err = storage.Create(ctx, &canvas)
+	a.NoError(err)
+	err = storage.Delete(ctx, canvas.Name)
+	a.NoError(err)
+
+	reopened, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	_, err = reopened.FindByName(ctx, canvas.Name)
+	a.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	trash, err := reopened.ListTrash(ctx)
+	a.NoError(err)
+	a.Len(trash, 1)
+
+	err = reopened.Purge(illustrator.ContextWithActor(ctx, illustrator.Actor{Name: "leonardo"}), canvas.Name)
+	a.NoError(err)
+	for _, table := range []string{"canvas", "canvas_versions"} {
+		entries, err := os.ReadDir(filepath.Join(dir, table))
+		a.NoError(err)
+		a.Empty(entries)
+	}
+
+	// The audit log outlives the canvas, the purge recorded last
+	entries, err := os.ReadDir(filepath.Join(dir, "canvas_audit"))
+	a.NoError(err)
+	if !a.Len(entries, 1) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "canvas_audit", entries[0].Name()))
+	a.NoError(err)
+	var audit []illustrator.AuditEntry
+	for _, row := range bytes.Split(bytes.TrimSpace(data), []byte{'\n'}) {
+		var entry illustrator.AuditEntry
+		a.NoError(json.Unmarshal(row, &entry))
+		audit = append(audit, entry)
+	}
+	if !a.Len(audit, 3) {
+		return
+	}
+	a.Equal(illustrator.AuditPurge, audit[2].Action)
+	a.Equal("trashed", audit[2].Name)
+	a.Equal("leonardo", audit[2].Actor)
+
+	// And is listed once reopened
+	reopened, err = memstore.NewFileStorage(dir)
+	a.NoError(err)
+	listed, err := reopened.ListAudit(ctx, canvas.Name)
+	a.NoError(err)
+	a.Equal(audit, listed)
+}
+
+func TestFileStorageRenameReload(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	storage, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	canvas := illustrator.CanvasModel{Name: "before", Width: 10, Height: 10}
+	err = storage.Create(ctx, &canvas)
+	a.NoError(err)
+	_, err = storage.Rename(ctx, canvas.Name, 0, "after")
+	a.NoError(err)
+
+	reopened, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	_, err = reopened.FindByName(ctx, "before")
+	a.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	renamed, err := reopened.FindByName(ctx, "after")
+	a.NoError(err)
+	a.Equal(2, renamed.Revision)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "canvas"))
+	a.NoError(err)
+	a.Len(entries, 1)
+}
+
+func TestFileStorageStaleRenameFile(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	storage, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	canvas := illustrator.CanvasModel{Name: "before", Width: 10, Height: 10}
+	err = storage.Create(ctx, &canvas)
+	a.NoError(err)
+	oldFile := filepath.Join(dir, "canvas", illustrator.CanvasKeyHash("before")+".json")
+	data, err := os.ReadFile(oldFile)
+	a.NoError(err)
+	_, err = storage.Rename(ctx, canvas.Name, 0, "after")
+	a.NoError(err)
+
+	// A rename interrupted before the old file was removed
+	a.NoError(os.WriteFile(oldFile, data, 0o644))
+
+	reopened, err := memstore.NewFileStorage(dir)
+	a.NoError(err)
+
+	_, err = reopened.FindByName(ctx, "before")
+	a.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	renamed, err := reopened.FindByName(ctx, "after")
+	a.NoError(err)
+	a.Equal(2, renamed.Revision)
+
+	_, err = os.Stat(oldFile)
+	a.True(errors.Is(err, os.ErrNotExist))
+}
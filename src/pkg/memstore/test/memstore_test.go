@@ -0,0 +1,796 @@
+package memstore_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/cache"
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/memstore"
+	"github.com/stretchr/testify/suite"
+)
+
+type MemStorageSuite struct {
+	suite.Suite
+	newStorage func() illustrator.CanvasStorage
+	storage    illustrator.CanvasStorage
+	model      illustrator.CanvasModel
+}
+
+func TestMemStorageSuite(t *testing.T) {
+	suite.Run(t, &MemStorageSuite{
+		newStorage: func() illustrator.CanvasStorage {
+			return memstore.NewStorage()
+		},
+	})
+}
+
+// The file storage must behave exactly like the memory one. This suite is the
+// storage contract: the dba tests assert the SQL sent to a mocked connection
+// and cannot run against a backend without one.
+func TestFileStorageSuite(t *testing.T) {
+	s := &MemStorageSuite{}
+	s.newStorage = func() illustrator.CanvasStorage {
+		storage, err := memstore.NewFileStorage(s.T().TempDir())
+		s.Require().NoError(err)
+		return storage
+	}
+	suite.Run(t, s)
+}
+
+// Canvases served from the cache must not differ from the storage behind it
+func TestCachedStorageSuite(t *testing.T) {
+	suite.Run(t, &MemStorageSuite{
+		newStorage: func() illustrator.CanvasStorage {
+			return cache.NewStorage(memstore.NewStorage(), cache.Options{Size: 2})
+		},
+	})
+}
+
+func (s *MemStorageSuite) SetupTest() {
+	s.storage = s.newStorage()
+
+	asteriskRune := '*'
+	s.model = illustrator.CanvasModel{
+		Name:   "monalisa",
+		Width:  20,
+		Height: 20,
+		Drawings: []illustrator.DrawingModel{
+			{
+				Coordinates: []int{4, 4},
+				Width:       5,
+				Height:      5,
+				Fill:        &asteriskRune,
+				Outline:     &asteriskRune,
+			},
+		},
+	}
+}
+
+func (s *MemStorageSuite) TearDownTest() {
+	s.NoError(s.storage.Close())
+}
+
+func (s *MemStorageSuite) TestStorageFind() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.model.Revision = 1
+	s.Equal(s.model, *canvas)
+
+	// Returned canvas must not alias the stored one
+	*canvas.Drawings[0].Fill = '#'
+	canvas, err = s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal('*', *canvas.Drawings[0].Fill)
+
+	_, err = s.storage.FindByName(context.Background(), "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+}
+
+func (s *MemStorageSuite) TestStorageCreate() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	err = s.storage.Create(context.Background(), &s.model)
+	s.True(errors.Is(err, illustrator.ErrCanvasExists))
+}
+
+func (s *MemStorageSuite) TestStorageUpdate() {
+	_, err := s.storage.Update(context.Background(), &s.model)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	err = s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	s.model.Width = 30
+	_, err = s.storage.Update(context.Background(), &s.model)
+	s.NoError(err)
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(30, canvas.Width)
+}
+
+func (s *MemStorageSuite) TestStorageDelete() {
+	err := s.storage.Delete(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	err = s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	err = s.storage.Delete(context.Background(), s.model.Name)
+	s.NoError(err)
+
+	_, err = s.storage.FindByName(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+}
+
+func (s *MemStorageSuite) TestStorageConcurrentAccess() {
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.storage.Create(context.Background(), &s.model)
+			s.storage.FindByName(context.Background(), s.model.Name)
+			s.storage.Update(context.Background(), &s.model)
+			s.storage.Delete(context.Background(), s.model.Name)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *MemStorageSuite) TestStorageList() {
+	names := []string{"delta", "alpha", "charlie", "bravo"}
+	for i, name := range names {
+		canvas := s.model
+		canvas.Name = name
+		canvas.Width = 10 * (i + 1)
+		err := s.storage.Create(context.Background(), &canvas)
+		s.NoError(err)
+		// Distinct creation timestamps
+		time.Sleep(time.Millisecond)
+	}
+
+	var listed []string
+	opts := illustrator.ListOptions{Limit: 3}
+	for {
+		page, err := s.storage.List(context.Background(), opts)
+		s.NoError(err)
+		for _, info := range page.Canvases {
+			s.Equal(len(s.model.Drawings), info.DrawingCount)
+			s.False(info.CreatedAt.IsZero())
+			listed = append(listed, info.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	s.Equal([]string{"alpha", "bravo", "charlie", "delta"}, listed)
+
+	// Latest created first
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{
+		SortBy:     illustrator.ListSortByCreated,
+		Descending: true,
+		Limit:      1,
+	})
+	s.NoError(err)
+	s.Equal("bravo", page.Canvases[0].Name)
+
+	page, err = s.storage.List(context.Background(), illustrator.ListOptions{
+		SortBy:     illustrator.ListSortByCreated,
+		Descending: true,
+		Cursor:     page.NextCursor,
+	})
+	s.NoError(err)
+	s.Len(page.Canvases, 3)
+	s.Equal("charlie", page.Canvases[0].Name)
+
+	// Filter on dimensions
+	page, err = s.storage.List(context.Background(), illustrator.ListOptions{MinWidth: 20, MaxWidth: 30})
+	s.NoError(err)
+	s.Len(page.Canvases, 2)
+	s.Equal("alpha", page.Canvases[0].Name)
+	s.Equal("charlie", page.Canvases[1].Name)
+
+	_, err = s.storage.List(context.Background(), illustrator.ListOptions{Cursor: page.NextCursor + "x"})
+	s.True(errors.Is(err, illustrator.ErrInvalidCursor))
+}
+
+func (s *MemStorageSuite) TestStorageDisplayName() {
+	s.model.Name = "MonaLisa"
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	// Names are unique regardless of their case
+	conflicting := s.model
+	conflicting.Name = "monalisa"
+	err = s.storage.Create(context.Background(), &conflicting)
+	s.True(errors.Is(err, illustrator.ErrCanvasExists))
+
+	canvas, err := s.storage.FindByName(context.Background(), "monalisa")
+	s.NoError(err)
+	s.Equal("MonaLisa", canvas.Name)
+
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{})
+	s.NoError(err)
+	s.Equal("MonaLisa", page.Canvases[0].Name)
+	s.Equal("monalisa", page.Canvases[0].Key)
+}
+
+func (s *MemStorageSuite) TestStorageVersions() {
+	_, err := s.storage.ListVersions(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	err = s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	updated := *s.model.Clone()
+	updated.Width = 30
+	updated.Drawings = nil
+	_, err = s.storage.Update(context.Background(), &updated)
+	s.NoError(err)
+
+	versions, err := s.storage.ListVersions(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Len(versions, 2)
+	s.Equal(1, versions[0].Version)
+	s.Equal(1, versions[0].DrawingCount)
+	s.Equal(30, versions[1].Width)
+
+	canvas, err := s.storage.FindVersion(context.Background(), s.model.Name, 1)
+	s.NoError(err)
+	s.Equal(s.model, *canvas)
+
+	_, err = s.storage.FindVersion(context.Background(), s.model.Name, 3)
+	s.True(errors.Is(err, illustrator.ErrVersionNotFound))
+
+	// Restores of another revision are rejected
+	_, err = s.storage.RestoreVersion(context.Background(), s.model.Name, 1, 1)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	revision, err := s.storage.RestoreVersion(context.Background(), s.model.Name, 2, 1)
+	s.NoError(err)
+	s.Equal(3, revision)
+
+	canvas, err = s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(3, canvas.Revision)
+	canvas.Revision = 0
+	s.Equal(s.model, *canvas)
+
+	// Restoring records a new version, history is never rewritten
+	versions, err = s.storage.ListVersions(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Len(versions, 3)
+	s.Equal(20, versions[2].Width)
+
+	_, err = s.storage.RestoreVersion(context.Background(), s.model.Name, 0, 4)
+	s.True(errors.Is(err, illustrator.ErrVersionNotFound))
+}
+
+func (s *MemStorageSuite) TestStorageUpdateRevision() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(1, canvas.Revision)
+
+	// Conditional update at the current revision
+	revision, err := s.storage.Update(context.Background(), canvas)
+	s.NoError(err)
+	s.Equal(2, revision)
+
+	// The canvas moved on to revision 2 meanwhile
+	_, err = s.storage.Update(context.Background(), canvas)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	canvas.Revision = 0
+	revision, err = s.storage.Update(context.Background(), canvas)
+	s.NoError(err)
+	s.Equal(3, revision)
+
+	canvas, err = s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(3, canvas.Revision)
+}
+
+func (s *MemStorageSuite) TestStorageDrawings() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	drawing := s.model.Drawings[0].Clone()
+	drawing.Coordinates = []int{1, 1}
+
+	canvas, err := s.storage.AppendDrawing(context.Background(), s.model.Name, 1, &drawing, nil)
+	s.NoError(err)
+	s.Equal(2, canvas.Revision)
+	s.Equal(illustrator.DrawingSlice{s.model.Drawings[0], drawing}, canvas.Drawings)
+
+	drawing.Width = 2
+	canvas, err = s.storage.ReplaceDrawing(context.Background(), s.model.Name, 0, 1, &drawing, nil)
+	s.NoError(err)
+	s.Equal(3, canvas.Revision)
+	s.Equal(2, canvas.Drawings[1].Width)
+
+	canvas, err = s.storage.RemoveDrawing(context.Background(), s.model.Name, 3, 0, nil)
+	s.NoError(err)
+	s.Equal(illustrator.DrawingSlice{drawing}, canvas.Drawings)
+
+	stored, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(canvas, stored)
+
+	versions, err := s.storage.ListVersions(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Len(versions, 4)
+}
+
+func (s *MemStorageSuite) TestStorageDrawingErrors() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	_, err = s.storage.RemoveDrawing(context.Background(), "unknown", 0, 0, nil)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	_, err = s.storage.RemoveDrawing(context.Background(), s.model.Name, 2, 0, nil)
+	s.True(errors.Is(err, illustrator.ErrConflict))
+
+	_, err = s.storage.ReplaceDrawing(context.Background(), s.model.Name, 0, 1, &s.model.Drawings[0], nil)
+	s.True(errors.Is(err, illustrator.ErrDrawingNotFound))
+
+	// A failed check leaves the canvas untouched
+	checkErr := errors.New("invalid canvas")
+	_, err = s.storage.AppendDrawing(context.Background(), s.model.Name, 0, &s.model.Drawings[0],
+		func(canvas *illustrator.CanvasModel) (err error) {
+			return checkErr
+		})
+	s.True(errors.Is(err, checkErr))
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(1, canvas.Revision)
+	s.Len(canvas.Drawings, 1)
+}
+
+func (s *MemStorageSuite) TestStorageBatch() {
+	other := illustrator.CanvasModel{Name: "other", Width: 5, Height: 5}
+	updated := s.model
+	updated.Width = 30
+
+	results, err := s.storage.Batch(context.Background(), []illustrator.BatchOperation{
+		{Op: illustrator.BatchCreate, Canvas: &s.model},
+		{Op: illustrator.BatchCreate, Canvas: &s.model},
+		{Op: illustrator.BatchUpdate, Canvas: &updated},
+		{Op: illustrator.BatchDelete, Name: "unknown"},
+		{Op: illustrator.BatchCreate, Canvas: &other},
+	}, false)
+	s.NoError(err)
+	s.Len(results, 5)
+
+	statuses := []illustrator.BatchStatus{
+		illustrator.BatchStatusOK,
+		illustrator.BatchStatusFailed,
+		illustrator.BatchStatusOK,
+		illustrator.BatchStatusNotFound,
+		illustrator.BatchStatusOK,
+	}
+	for i, result := range results {
+		s.Equal(i, result.Index)
+		s.Equal(statuses[i], result.Status)
+	}
+	s.True(errors.Is(results[1].Err, illustrator.ErrCanvasExists))
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(30, canvas.Width)
+	_, err = s.storage.FindByName(context.Background(), other.Name)
+	s.NoError(err)
+}
+
+func (s *MemStorageSuite) TestStorageWithTx() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	// Changes within the transaction are seen by its later calls
+	err = s.storage.WithTx(context.Background(), func(tx illustrator.CanvasStorage) (err error) {
+		canvas, err := tx.FindByName(context.Background(), s.model.Name)
+		if err != nil {
+			return
+		}
+		canvas.Width = 30
+		if _, err = tx.Update(context.Background(), canvas); err != nil {
+			return
+		}
+		canvas, err = tx.FindByName(context.Background(), s.model.Name)
+		s.NoError(err)
+		s.Equal(30, canvas.Width)
+		return tx.Create(context.Background(), &illustrator.CanvasModel{Name: "other", Width: 5, Height: 5})
+	})
+	s.NoError(err)
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(30, canvas.Width)
+	s.Equal(2, canvas.Revision)
+	_, err = s.storage.FindByName(context.Background(), "other")
+	s.NoError(err)
+}
+
+func (s *MemStorageSuite) TestStorageWithTxRollback() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	failure := errors.New("failure")
+	err = s.storage.WithTx(context.Background(), func(tx illustrator.CanvasStorage) (err error) {
+		if err = tx.Delete(context.Background(), s.model.Name); err != nil {
+			return
+		}
+		if err = tx.Create(context.Background(), &illustrator.CanvasModel{Name: "other", Width: 5, Height: 5}); err != nil {
+			return
+		}
+		// Nested transactions join the outer one
+		return tx.WithTx(context.Background(), func(nested illustrator.CanvasStorage) error {
+			return failure
+		})
+	})
+	s.True(errors.Is(err, failure))
+
+	// Nothing of the transaction applied
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(1, canvas.Revision)
+	_, err = s.storage.FindByName(context.Background(), "other")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	trash, err := s.storage.ListTrash(context.Background())
+	s.NoError(err)
+	s.Empty(trash)
+}
+
+func (s *MemStorageSuite) TestStorageBatchAtomic() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	other := illustrator.CanvasModel{Name: "other", Width: 5, Height: 5}
+	updated := s.model
+	updated.Width = 30
+
+	results, err := s.storage.Batch(context.Background(), []illustrator.BatchOperation{
+		{Op: illustrator.BatchCreate, Canvas: &other},
+		{Op: illustrator.BatchUpdate, Canvas: &updated},
+		{Op: illustrator.BatchDelete, Name: "unknown"},
+		{Op: illustrator.BatchDelete, Name: s.model.Name},
+	}, true)
+	s.True(errors.Is(err, illustrator.ErrBatchAborted))
+	s.Len(results, 4)
+
+	statuses := []illustrator.BatchStatus{
+		illustrator.BatchStatusAborted,
+		illustrator.BatchStatusAborted,
+		illustrator.BatchStatusNotFound,
+		illustrator.BatchStatusAborted,
+	}
+	for i, result := range results {
+		s.Equal(statuses[i], result.Status)
+	}
+
+	// Nothing of the batch applied
+	_, err = s.storage.FindByName(context.Background(), other.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(s.model.Width, canvas.Width)
+	s.Equal(1, canvas.Revision)
+}
+
+func (s *MemStorageSuite) TestStorageTrash() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	err = s.storage.Delete(context.Background(), s.model.Name)
+	s.NoError(err)
+
+	// Trashed canvases are hidden but keep their name
+	_, err = s.storage.FindByName(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{})
+	s.NoError(err)
+	s.Empty(page.Canvases)
+	err = s.storage.Create(context.Background(), &s.model)
+	s.True(errors.Is(err, illustrator.ErrCanvasExists))
+	err = s.storage.Delete(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	trash, err := s.storage.ListTrash(context.Background())
+	s.NoError(err)
+	s.Require().Len(trash, 1)
+	s.Equal(s.model.Name, trash[0].Name)
+	s.Equal("monalisa", trash[0].Key)
+	s.Equal(20, trash[0].Width)
+	s.Equal(20, trash[0].Height)
+	s.Equal(1, trash[0].DrawingCount)
+	s.False(trash[0].DeletedAt.IsZero())
+
+	err = s.storage.Undelete(context.Background(), "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	err = s.storage.Undelete(context.Background(), s.model.Name)
+	s.NoError(err)
+
+	// Only trashed canvases are restored
+	err = s.storage.Undelete(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.model.Revision = 1
+	s.Equal(s.model, *canvas)
+
+	// Only trashed canvases are purged
+	err = s.storage.Purge(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	err = s.storage.Delete(context.Background(), s.model.Name)
+	s.NoError(err)
+	err = s.storage.Purge(context.Background(), s.model.Name)
+	s.NoError(err)
+
+	trash, err = s.storage.ListTrash(context.Background())
+	s.NoError(err)
+	s.Empty(trash)
+
+	// The audit log of the purged canvas is listed until the name is taken again
+	entries, err := s.storage.ListAudit(context.Background(), s.model.Name)
+	s.NoError(err)
+	if s.Len(entries, 5) {
+		s.Equal(illustrator.AuditPurge, entries[4].Action)
+	}
+
+	err = s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+	entries, err = s.storage.ListAudit(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Len(entries, 1)
+}
+
+func (s *MemStorageSuite) TestStoragePurgeTrash() {
+	other := illustrator.CanvasModel{Name: "other", Width: 5, Height: 5}
+	for _, canvas := range []*illustrator.CanvasModel{&s.model, &other} {
+		err := s.storage.Create(context.Background(), canvas)
+		s.NoError(err)
+		err = s.storage.Delete(context.Background(), canvas.Name)
+		s.NoError(err)
+	}
+
+	count, err := s.storage.PurgeTrash(context.Background(), time.Now().Add(-time.Hour))
+	s.NoError(err)
+	s.Equal(int64(0), count)
+
+	count, err = s.storage.PurgeTrash(context.Background(), time.Now().Add(time.Second))
+	s.NoError(err)
+	s.Equal(int64(2), count)
+
+	trash, err := s.storage.ListTrash(context.Background())
+	s.NoError(err)
+	s.Empty(trash)
+}
+
+func (s *MemStorageSuite) TestStorageClone() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	err = s.storage.Clone(context.Background(), s.model.Name, "Copy")
+	s.NoError(err)
+
+	canvas, err := s.storage.FindByName(context.Background(), "copy")
+	s.NoError(err)
+	expected := s.model
+	expected.Name = "Copy"
+	expected.Revision = 1
+	s.Equal(expected, *canvas)
+
+	versions, err := s.storage.ListVersions(context.Background(), "copy")
+	s.NoError(err)
+	s.Len(versions, 1)
+
+	err = s.storage.Clone(context.Background(), s.model.Name, "copy")
+	s.True(errors.Is(err, illustrator.ErrCanvasExists))
+	err = s.storage.Clone(context.Background(), "unknown", "other")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	// The fork parent is listed until purged
+	canvas.Width = 10
+	_, err = s.storage.Update(context.Background(), canvas)
+	s.NoError(err)
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{})
+	s.NoError(err)
+	s.Require().Len(page.Canvases, 2)
+	s.Equal("monalisa", page.Canvases[0].ForkedFrom)
+
+	err = s.storage.Delete(context.Background(), s.model.Name)
+	s.NoError(err)
+	err = s.storage.Purge(context.Background(), s.model.Name)
+	s.NoError(err)
+	page, err = s.storage.List(context.Background(), illustrator.ListOptions{})
+	s.NoError(err)
+	s.Require().Len(page.Canvases, 1)
+	s.Empty(page.Canvases[0].ForkedFrom)
+}
+
+func (s *MemStorageSuite) TestStorageRename() {
+	other := illustrator.CanvasModel{Name: "other", Width: 5, Height: 5}
+	for _, canvas := range []*illustrator.CanvasModel{&s.model, &other} {
+		err := s.storage.Create(context.Background(), canvas)
+		s.NoError(err)
+	}
+
+	revision, err := s.storage.Rename(context.Background(), s.model.Name, 1, "Gioconda")
+	s.NoError(err)
+	s.Equal(2, revision)
+
+	_, err = s.storage.FindByName(context.Background(), s.model.Name)
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	canvas, err := s.storage.FindByName(context.Background(), "gioconda")
+	s.NoError(err)
+	s.Equal("Gioconda", canvas.Name)
+	s.Equal(2, canvas.Revision)
+
+	// History moves along
+	versions, err := s.storage.ListVersions(context.Background(), "gioconda")
+	s.NoError(err)
+	s.Len(versions, 1)
+
+	_, err = s.storage.Rename(context.Background(), "gioconda", 1, "mona")
+	s.True(errors.Is(err, illustrator.ErrConflict))
+	_, err = s.storage.Rename(context.Background(), "gioconda", 0, "Other")
+	s.True(errors.Is(err, illustrator.ErrCanvasExists))
+	_, err = s.storage.Rename(context.Background(), "unknown", 0, "mona")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	// Only the display name changes
+	revision, err = s.storage.Rename(context.Background(), "gioconda", 0, "GIOCONDA")
+	s.NoError(err)
+	s.Equal(3, revision)
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{})
+	s.NoError(err)
+	s.Len(page.Canvases, 2)
+	s.Equal("GIOCONDA", page.Canvases[0].Name)
+}
+
+func (s *MemStorageSuite) TestStorageImport() {
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	first := illustrator.CanvasModel{Name: "MonaLisa", Width: 10, Height: 10}
+	current := s.model
+	current.Name = "MonaLisa"
+	history := &illustrator.CanvasHistory{
+		Canvas:    current,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+		Versions: []illustrator.CanvasSnapshot{
+			{Version: 1, Canvas: first, CreatedAt: createdAt},
+			{Version: 2, Canvas: current, CreatedAt: updatedAt},
+		},
+	}
+	err := s.storage.Import(context.Background(), history)
+	s.NoError(err)
+	err = s.storage.Import(context.Background(), history)
+	s.True(errors.Is(err, illustrator.ErrCanvasExists))
+
+	canvas, err := s.storage.FindByName(context.Background(), "monalisa")
+	s.NoError(err)
+	current.Revision = 2
+	s.Equal(current, *canvas)
+
+	versions, err := s.storage.ListVersions(context.Background(), "monalisa")
+	s.NoError(err)
+	s.Equal([]illustrator.CanvasVersion{
+		{Version: 1, Width: 10, Height: 10, CreatedAt: createdAt},
+		{Version: 2, Width: 20, Height: 20, DrawingCount: 1, CreatedAt: updatedAt},
+	}, versions)
+	canvas, err = s.storage.FindVersion(context.Background(), "monalisa", 1)
+	s.NoError(err)
+	s.Equal(first, *canvas)
+
+	// The import starts the audit log
+	entries, err := s.storage.ListAudit(context.Background(), "monalisa")
+	s.NoError(err)
+	s.Require().Len(entries, 1)
+	s.Equal(illustrator.AuditCreate, entries[0].Action)
+	s.Equal(2, entries[0].Revision)
+
+	other := illustrator.CanvasModel{Name: "copy", Width: 5, Height: 5}
+	s.NoError(s.storage.Create(context.Background(), &other))
+	err = s.storage.LinkFork(context.Background(), "copy", "MonaLisa")
+	s.NoError(err)
+	err = s.storage.LinkFork(context.Background(), "copy", "unknown")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+
+	page, err := s.storage.List(context.Background(), illustrator.ListOptions{})
+	s.NoError(err)
+	s.Require().Len(page.Canvases, 2)
+	s.Equal("MonaLisa", page.Canvases[0].ForkedFrom)
+	s.Equal(createdAt, page.Canvases[1].CreatedAt)
+	s.Equal(updatedAt, page.Canvases[1].UpdatedAt)
+}
+
+func (s *MemStorageSuite) TestStorageContext() {
+	err := s.storage.Create(context.Background(), &s.model)
+	s.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.storage.FindByName(ctx, s.model.Name)
+	s.True(errors.Is(err, context.Canceled))
+
+	// Expired deadlines are reported as timeouts
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_, err = s.storage.Update(ctx, &s.model)
+	s.True(errors.Is(err, illustrator.ErrTimeout))
+	canvas, err := s.storage.FindByName(context.Background(), s.model.Name)
+	s.NoError(err)
+	s.Equal(1, canvas.Revision)
+}
+
+func (s *MemStorageSuite) TestStorageAudit() {
+	ctx := illustrator.ContextWithActor(context.Background(), illustrator.Actor{Name: "leonardo", RequestID: "f3a1"})
+	err := s.storage.Create(ctx, &s.model)
+	s.NoError(err)
+
+	// Changes without actor are made by the system
+	_, err = s.storage.AppendDrawing(context.Background(), s.model.Name, 0, &s.model.Drawings[0], nil)
+	s.NoError(err)
+	_, err = s.storage.Rename(ctx, s.model.Name, 0, "Gioconda")
+	s.NoError(err)
+	s.NoError(s.storage.Delete(ctx, "gioconda"))
+	_, err = s.storage.ListAudit(ctx, "gioconda")
+	s.True(errors.Is(err, illustrator.ErrCanvasNotFound))
+	s.NoError(s.storage.Undelete(ctx, "gioconda"))
+
+	// Failed changes leave no entry
+	_, err = s.storage.Rename(ctx, "gioconda", 1, "mona")
+	s.True(errors.Is(err, illustrator.ErrConflict))
+	_, err = s.storage.Batch(ctx, []illustrator.BatchOperation{
+		{Op: illustrator.BatchDelete, Name: "gioconda"},
+		{Op: illustrator.BatchDelete, Name: "unknown"},
+	}, true)
+	s.True(errors.Is(err, illustrator.ErrBatchAborted))
+
+	entries, err := s.storage.ListAudit(context.Background(), "gioconda")
+	s.NoError(err)
+	s.Require().Len(entries, 5)
+	for _, entry := range entries {
+		s.False(entry.CreatedAt.IsZero())
+	}
+
+	s.Equal(illustrator.AuditCreate, entries[0].Action)
+	s.Equal("monalisa", entries[0].Name)
+	s.Equal("leonardo", entries[0].Actor)
+	s.Equal("f3a1", entries[0].RequestID)
+	s.Equal(1, entries[0].Revision)
+	s.Equal(&illustrator.DrawingsDiff{Added: 1}, entries[0].Diff)
+
+	s.Equal(illustrator.AuditUpdate, entries[1].Action)
+	s.Equal(illustrator.SystemActor, entries[1].Actor)
+	s.Empty(entries[1].RequestID)
+	s.Equal(2, entries[1].Revision)
+	s.Equal(&illustrator.DrawingsDiff{Added: 1}, entries[1].Diff)
+
+	s.Equal(illustrator.AuditRename, entries[2].Action)
+	s.Equal("Gioconda", entries[2].Name)
+	s.Equal("monalisa", entries[2].PreviousName)
+	s.Equal(3, entries[2].Revision)
+	s.Nil(entries[2].Diff)
+
+	s.Equal(illustrator.AuditDelete, entries[3].Action)
+	s.Equal(illustrator.AuditUndelete, entries[4].Action)
+	s.Equal(3, entries[4].Revision)
+}
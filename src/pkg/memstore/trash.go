@@ -0,0 +1,148 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// ListTrash returns the trashed canvases, most recently deleted first
+func (s *Storage) ListTrash(ctx context.Context) (canvases []illustrator.TrashedCanvas, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	canvases = []illustrator.TrashedCanvas{}
+	for _, rec := range s.canvases {
+		if rec.DeletedAt.IsZero() {
+			continue
+		}
+		info := rec.info()
+		canvases = append(canvases, illustrator.TrashedCanvas{
+			Name:         info.Name,
+			Key:          info.Key,
+			Width:        info.Width,
+			Height:       info.Height,
+			DrawingCount: info.DrawingCount,
+			DeletedAt:    rec.DeletedAt,
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(canvases, func(i, j int) bool {
+		if !canvases[i].DeletedAt.Equal(canvases[j].DeletedAt) {
+			return canvases[i].DeletedAt.After(canvases[j].DeletedAt)
+		}
+		return canvases[i].Key < canvases[j].Key
+	})
+	return
+}
+
+// Undelete restores a canvas from the trash as it was when deleted
+func (s *Storage) Undelete(ctx context.Context, name string) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.trashed(name)
+	if !ok {
+		return illustrator.ErrCanvasNotFound
+	}
+
+	rec := *stored
+	rec.DeletedAt = time.Time{}
+	rec.recordAudit(ctx, stored.Audit, illustrator.AuditEntry{Action: illustrator.AuditUndelete})
+	if err = s.persist(&rec); err != nil {
+		return
+	}
+
+	s.canvases[rec.NameHash] = &rec
+	return
+}
+
+// Purge permanently removes a trashed canvas together with its versions. The
+// purge is recorded in the audit log, which the file storage keeps.
+func (s *Storage) Purge(ctx context.Context, name string) (err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.trashed(name)
+	if !ok {
+		return illustrator.ErrCanvasNotFound
+	}
+	return s.purge(ctx, stored)
+}
+
+// PurgeTrash permanently removes the canvases trashed before the given time,
+// recording each purge like Purge does
+func (s *Storage) PurgeTrash(ctx context.Context, deletedBefore time.Time) (count int64, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rec := range s.canvases {
+		if rec.DeletedAt.IsZero() || !rec.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		if err = s.purge(ctx, rec); err != nil {
+			return
+		}
+		count++
+	}
+	return
+}
+
+// trashed returns the record of a canvas in the trash. The caller must hold the lock.
+func (s *Storage) trashed(name string) (rec *record, ok bool) {
+	rec, ok = s.canvases[illustrator.CanvasKeyHash(name)]
+	if ok && rec.DeletedAt.IsZero() {
+		return nil, false
+	}
+	return
+}
+
+// purge removes the record and its files, keeping its audit log with the purge
+// recorded. Forks of the canvas lose their parent. The caller must hold the
+// write lock.
+func (s *Storage) purge(ctx context.Context, rec *record) (err error) {
+	for _, fork := range s.canvases {
+		if fork.ForkedFrom != rec.ID {
+			continue
+		}
+		orphan := *fork
+		orphan.ForkedFrom = 0
+		if err = s.persist(&orphan); err != nil {
+			return
+		}
+		s.canvases[orphan.NameHash] = &orphan
+	}
+
+	purged := *rec
+	purged.recordAudit(ctx, rec.Audit, illustrator.AuditEntry{Action: illustrator.AuditPurge})
+	if err = s.persistAudit(&purged); err != nil {
+		return
+	}
+	if err = s.remove(rec); err != nil {
+		return
+	}
+	if err = s.removeLog(versionTableDir, rec.ID); err != nil {
+		return
+	}
+
+	delete(s.canvases, rec.NameHash)
+	s.purged[rec.Key] = purged.Audit
+	return
+}
@@ -0,0 +1,83 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+func (s *Storage) ListVersions(ctx context.Context, name string) (versions []illustrator.CanvasVersion, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.live(name)
+	if !ok {
+		err = illustrator.ErrCanvasNotFound
+		return
+	}
+
+	for _, v := range stored.Versions {
+		versions = append(versions, illustrator.CanvasVersion{
+			Version:      v.Version,
+			Width:        v.Canvas.Width,
+			Height:       v.Canvas.Height,
+			DrawingCount: len(v.Canvas.Drawings),
+			CreatedAt:    v.CreatedAt,
+		})
+	}
+	return
+}
+
+func (s *Storage) FindVersion(ctx context.Context, name string, version int) (canvas *illustrator.CanvasModel, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.live(name)
+	if !ok || version < 1 || version > len(stored.Versions) {
+		err = illustrator.ErrVersionNotFound
+		return
+	}
+
+	canvas = stored.Versions[version-1].Canvas.Clone()
+	canvas.Name = stored.Canvas.Name
+	return
+}
+
+// RestoreVersion overwrites the canvas with the content of one of its versions,
+// which is recorded as a new version. When a revision is given the restore only
+// applies to that revision, otherwise ErrConflict is returned.
+func (s *Storage) RestoreVersion(ctx context.Context, name string, revision int, version int) (newRevision int, err error) {
+	if err = checkContext(ctx); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.live(name)
+	if !ok {
+		return 0, illustrator.ErrVersionNotFound
+	}
+	if revision != 0 && revision != stored.Canvas.Revision {
+		return 0, illustrator.ErrConflict
+	}
+	if version < 1 || version > len(stored.Versions) {
+		return 0, illustrator.ErrVersionNotFound
+	}
+
+	rec := *stored
+	rec.Canvas = stored.Versions[version-1].Canvas.Clone()
+	rec.Canvas.Name = stored.Canvas.Name
+	if err = s.commitRevision(ctx, stored, &rec); err != nil {
+		return
+	}
+	return rec.Canvas.Revision, nil
+}
@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+const (
+	defaultBatchSize    int           = 100
+	defaultPollInterval time.Duration = time.Second
+	defaultLease        time.Duration = time.Minute
+	defaultMinBackoff   time.Duration = time.Second
+	defaultMaxBackoff   time.Duration = 10 * time.Minute
+)
+
+// Sink delivers change events to a downstream consumer. Failed deliveries are
+// retried, so a sink may see an event more than once.
+type Sink interface {
+	Deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error)
+}
+
+type Options struct {
+	// Max. number of events claimed at once
+	BatchSize int
+	// Time between polls of the outbox once it ran empty
+	PollInterval time.Duration
+	// Time claimed events are held back from other dispatchers, which bounds
+	// the time spent delivering a batch
+	Lease time.Duration
+	// Delay of the first retry of a failed delivery, doubled by every further
+	// failure up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Dispatcher delivers the events of an outbox to every sink, an event is only
+// removed from the outbox once all sinks took it
+type Dispatcher struct {
+	outbox illustrator.EventOutbox
+	sinks  []Sink
+	opts   Options
+}
+
+func NewDispatcher(outbox illustrator.EventOutbox, sinks []Sink, opts Options) (d *Dispatcher) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaultLease
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = defaultMaxBackoff
+		if opts.MaxBackoff < opts.MinBackoff {
+			opts.MaxBackoff = opts.MinBackoff
+		}
+	}
+
+	return &Dispatcher{
+		outbox: outbox,
+		sinks:  sinks,
+		opts:   opts,
+	}
+}
+
+// Run delivers events until the context is done. The outbox is polled again
+// right away as long as batches come back full.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		count, err := d.Dispatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[ERROR] failed to dispatch canvas events: %v\n", err)
+		}
+
+		if err == nil && count == d.opts.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.opts.PollInterval):
+		}
+	}
+}
+
+// Dispatch claims the events due and delivers them in order. Delivered events
+// are removed from the outbox, failed ones are retried after a backoff. The
+// deliveries are bounded by the lease, events not reached within it are left
+// to be claimed again.
+func (d *Dispatcher) Dispatch(ctx context.Context) (count int, err error) {
+	events, err := d.outbox.ClaimEvents(ctx, d.opts.BatchSize, d.opts.Lease)
+	if err != nil {
+		return
+	}
+
+	leaseCtx, cancel := context.WithTimeout(ctx, d.opts.Lease)
+	defer cancel()
+	for i := range events {
+		if leaseCtx.Err() != nil {
+			if ctx.Err() == nil {
+				log.Printf("[INFO] lease of canvas events ran out, %d left to be claimed again\n", len(events)-i)
+			}
+			return
+		}
+
+		event := &events[i]
+		if deliverErr := d.deliver(leaseCtx, event); deliverErr != nil {
+			at := time.Now().Add(d.backoff(event.Attempts))
+			log.Printf("[ERROR] failed to deliver canvas event %d, retrying at %s: %v\n",
+				event.ID, at.Format(time.RFC3339), deliverErr)
+			if err = d.outbox.RetryEvent(ctx, event.ID, at, deliverErr.Error()); err != nil {
+				return
+			}
+			count++
+			continue
+		}
+
+		if err = d.outbox.MarkDelivered(ctx, event.ID); err != nil {
+			return
+		}
+		count++
+	}
+	return
+}
+
+// deliver hands the event to every sink, one failing sink does not keep the
+// event from the others. All sinks get the event again when one of them fails.
+func (d *Dispatcher) deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error) {
+	var failures []string
+	for i, sink := range d.sinks {
+		if sinkErr := sink.Deliver(ctx, event); sinkErr != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("sink %d: %w", i, sinkErr)
+			}
+			failures = append(failures, fmt.Sprintf("sink %d: %v", i, sinkErr))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return
+}
+
+// backoff returns the delay of the next retry after the given number of
+// failed deliveries
+func (d *Dispatcher) backoff(attempts int) (delay time.Duration) {
+	delay = d.opts.MinBackoff
+	for i := 0; i < attempts && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.MaxBackoff {
+		delay = d.opts.MaxBackoff
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+// LogSink writes a line per event to the log
+type LogSink struct{}
+
+func (LogSink) Deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error) {
+	log.Printf("[INFO] canvas event %d: %s '%s' revision %d by %s\n",
+		event.ID, event.Action, event.Name, event.Revision, event.Actor)
+	return
+}
+
+// WebhookSink posts every event as JSON to a URL. The ID of the event is sent
+// in the X-Event-ID header as well, receivers use it to drop duplicates.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string, timeout time.Duration) (sink *WebhookSink) {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *WebhookSink) Deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(event.ID, 10))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return
+}
+
+// FileSink appends every event as a line of JSON to a file
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSink(path string) (sink *FileSink) {
+	return &FileSink{path: path}
+}
+
+func (s *FileSink) Deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Opened per event, so the file can be rotated while the dispatcher runs
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return
+	}
+	if _, err = file.Write(line); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
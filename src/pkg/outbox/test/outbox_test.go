@@ -0,0 +1,292 @@
+package outbox_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// memOutbox keeps events in memory, claims are not leased
+type memOutbox struct {
+	mu        sync.Mutex
+	events    []illustrator.ChangeEvent
+	due       map[int64]time.Time
+	delivered []int64
+	reasons   map[int64]string
+}
+
+func newMemOutbox(events ...illustrator.ChangeEvent) (o *memOutbox) {
+	return &memOutbox{events: events, due: make(map[int64]time.Time), reasons: make(map[int64]string)}
+}
+
+func (o *memOutbox) ClaimEvents(ctx context.Context, limit int, lease time.Duration) (events []illustrator.ChangeEvent,
+	err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, event := range o.events {
+		if len(events) < limit && !o.due[event.ID].After(time.Now()) {
+			events = append(events, event)
+		}
+	}
+	return
+}
+
+func (o *memOutbox) MarkDelivered(ctx context.Context, id int64) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, event := range o.events {
+		if event.ID == id {
+			o.events = append(o.events[:i], o.events[i+1:]...)
+			o.delivered = append(o.delivered, id)
+			return
+		}
+	}
+	return
+}
+
+func (o *memOutbox) RetryEvent(ctx context.Context, id int64, at time.Time, reason string) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.events {
+		if o.events[i].ID == id {
+			o.events[i].Attempts++
+			o.due[id] = at
+			o.reasons[id] = reason
+		}
+	}
+	return
+}
+
+// recordingSink records the delivered events, failing for the events of the
+// canvas named failing
+type recordingSink struct {
+	mu      sync.Mutex
+	events  []int64
+	failing string
+}
+
+func (s *recordingSink) Deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.Name == s.failing {
+		return errors.New("unavailable")
+	}
+	s.events = append(s.events, event.ID)
+	return
+}
+
+// ----------------- DISPATCHER TESTS -----------------
+
+type DispatcherSuite struct {
+	suite.Suite
+	ctx    context.Context
+	outbox *memOutbox
+	sink   *recordingSink
+}
+
+func TestDispatcherSuite(t *testing.T) {
+	suite.Run(t, new(DispatcherSuite))
+}
+
+func (s *DispatcherSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.outbox = newMemOutbox(
+		illustrator.ChangeEvent{ID: 1, Action: illustrator.AuditCreate, Name: "monalisa", Revision: 1},
+		illustrator.ChangeEvent{ID: 2, Action: illustrator.AuditCreate, Name: "scream", Revision: 1},
+		illustrator.ChangeEvent{ID: 3, Action: illustrator.AuditUpdate, Name: "monalisa", Revision: 2},
+	)
+	s.sink = &recordingSink{}
+}
+
+func (s *DispatcherSuite) TestDispatch() {
+	dispatcher := outbox.NewDispatcher(s.outbox, []outbox.Sink{s.sink}, outbox.Options{})
+
+	count, err := dispatcher.Dispatch(s.ctx)
+	s.NoError(err)
+	s.Equal(3, count)
+	s.Equal([]int64{1, 2, 3}, s.sink.events)
+	s.Equal([]int64{1, 2, 3}, s.outbox.delivered)
+
+	count, err = dispatcher.Dispatch(s.ctx)
+	s.NoError(err)
+	s.Equal(0, count)
+}
+
+func (s *DispatcherSuite) TestDispatchBatches() {
+	dispatcher := outbox.NewDispatcher(s.outbox, []outbox.Sink{s.sink}, outbox.Options{BatchSize: 2})
+
+	count, err := dispatcher.Dispatch(s.ctx)
+	s.NoError(err)
+	s.Equal(2, count)
+	s.Equal([]int64{1, 2}, s.sink.events)
+}
+
+func (s *DispatcherSuite) TestDispatchRetry() {
+	s.sink.failing = "scream"
+	other := &recordingSink{}
+	dispatcher := outbox.NewDispatcher(s.outbox, []outbox.Sink{s.sink, other},
+		outbox.Options{MinBackoff: time.Minute, MaxBackoff: 3 * time.Minute})
+
+	start := time.Now()
+	count, err := dispatcher.Dispatch(s.ctx)
+	s.NoError(err)
+	s.Equal(3, count)
+	// The failed event stays in the outbox, the others are delivered
+	s.Equal([]int64{1, 3}, s.outbox.delivered)
+	s.Equal([]int64{1, 3}, s.sink.events)
+	s.Require().Len(s.outbox.events, 1)
+	s.Equal(1, s.outbox.events[0].Attempts)
+	s.Contains(s.outbox.reasons[2], "unavailable")
+	s.WithinDuration(start.Add(time.Minute), s.outbox.due[2], 5*time.Second)
+
+	// Not due yet
+	count, err = dispatcher.Dispatch(s.ctx)
+	s.NoError(err)
+	s.Equal(0, count)
+
+	// The backoff doubles up to the max.
+	for _, backoff := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		s.outbox.due[2] = time.Time{}
+		start = time.Now()
+		_, err = dispatcher.Dispatch(s.ctx)
+		s.NoError(err)
+		s.WithinDuration(start.Add(backoff), s.outbox.due[2], 5*time.Second)
+	}
+
+	// The other sinks see the event on every attempt, the failing one does
+	// not keep it from them
+	s.Equal([]int64{1, 2, 3, 2, 2, 2}, other.events)
+}
+
+// blockingSink takes the events until blocked, then holds on to the event
+// until the context is done
+type blockingSink struct {
+	recordingSink
+	blocked bool
+}
+
+func (s *blockingSink) Deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error) {
+	s.mu.Lock()
+	blocked := s.blocked
+	s.mu.Unlock()
+	if blocked {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	err = s.recordingSink.Deliver(ctx, event)
+	s.mu.Lock()
+	s.blocked = true
+	s.mu.Unlock()
+	return
+}
+
+func (s *DispatcherSuite) TestDispatchLease() {
+	sink := &blockingSink{}
+	dispatcher := outbox.NewDispatcher(s.outbox, []outbox.Sink{sink}, outbox.Options{Lease: 50 * time.Millisecond})
+
+	count, err := dispatcher.Dispatch(s.ctx)
+	s.NoError(err)
+	s.Equal(2, count)
+	s.Equal([]int64{1}, s.outbox.delivered)
+	// The delivery running out of lease is retried, the event not reached
+	// is left to be claimed again
+	s.Require().Len(s.outbox.events, 2)
+	s.Equal(1, s.outbox.events[0].Attempts)
+	s.Equal(0, s.outbox.events[1].Attempts)
+	s.Contains(s.outbox.reasons[2], "deadline exceeded")
+}
+
+func (s *DispatcherSuite) TestRun() {
+	dispatcher := outbox.NewDispatcher(s.outbox, []outbox.Sink{s.sink},
+		outbox.Options{BatchSize: 1, PollInterval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	s.Eventually(func() bool {
+		s.outbox.mu.Lock()
+		defer s.outbox.mu.Unlock()
+		return len(s.outbox.events) == 0
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	s.Equal([]int64{1, 2, 3}, s.sink.events)
+}
+
+// ----------------- SINK TESTS -----------------
+
+func TestWebhookSink(t *testing.T) {
+	a := assert.New(t)
+
+	status := http.StatusNoContent
+	var received illustrator.ChangeEvent
+	var eventID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		a.NoError(json.Unmarshal(body, &received))
+		a.Equal("application/json", req.Header.Get("Content-Type"))
+		eventID = req.Header.Get("X-Event-ID")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := outbox.NewWebhookSink(server.URL, time.Second)
+	event := illustrator.ChangeEvent{ID: 7, Action: illustrator.AuditRename, Name: "scream", PreviousName: "monalisa",
+		Revision: 3, Actor: "leonardo"}
+
+	a.NoError(sink.Deliver(context.Background(), &event))
+	a.Equal("7", eventID)
+	a.Equal(event, received)
+
+	status = http.StatusServiceUnavailable
+	err := sink.Deliver(context.Background(), &event)
+	a.Error(err)
+	a.Contains(err.Error(), "503")
+}
+
+func TestFileSink(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	sink := outbox.NewFileSink(path)
+
+	a.NoError(sink.Deliver(context.Background(), &illustrator.ChangeEvent{ID: 1, Name: "monalisa"}))
+	a.NoError(sink.Deliver(context.Background(), &illustrator.ChangeEvent{ID: 2, Name: "scream"}))
+
+	file, err := os.Open(path)
+	a.NoError(err)
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event illustrator.ChangeEvent
+		a.NoError(json.Unmarshal(scanner.Bytes(), &event))
+		names = append(names, event.Name)
+	}
+	a.Equal([]string{"monalisa", "scream"}, names)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"reflect"
 	"strconv"
@@ -25,6 +27,8 @@ type Router struct {
 type HandlerRequest struct {
 	Context context.Context
 	Vars    map[string]string
+	Query   url.Values
+	Header  http.Header
 	Body    interface{}
 }
 
@@ -34,6 +38,24 @@ type HandlerResponse struct {
 	Status      int
 	// Name of the template file to execute
 	Template string
+	// Additional response headers
+	Header http.Header
+	// Writes the content of streamed responses
+	Stream StreamFunc
+	// Media type of streamed responses
+	StreamType string
+}
+
+// StreamFunc writes the response content, errors can only be logged once
+// writing started. The writer implements http.Flusher where the server
+// supports it, for content sent as it happens.
+type StreamFunc func(w io.Writer) (err error)
+
+func (h *HandlerResponse) SetHeader(key, value string) {
+	if h.Header == nil {
+		h.Header = make(http.Header)
+	}
+	h.Header.Set(key, value)
 }
 
 func (h *HandlerResponse) SetText(resp string, status int) {
@@ -42,6 +64,12 @@ func (h *HandlerResponse) SetText(resp string, status int) {
 	h.Status = status
 }
 
+func (h *HandlerResponse) SetJSON(resp interface{}, status int) {
+	h.Response = resp
+	h.ContentType = ContentTypeJSON
+	h.Status = status
+}
+
 func (h *HandlerResponse) SetHTML(resp interface{}, template string, status int) {
 	h.Response = resp
 	h.Template = template
@@ -49,14 +77,27 @@ func (h *HandlerResponse) SetHTML(resp interface{}, template string, status int)
 	h.Status = status
 }
 
+// SetStream responds with content written by stream as it is produced, for
+// content too large to hold in memory
+func (h *HandlerResponse) SetStream(stream StreamFunc, mediaType string, status int) {
+	h.Stream = stream
+	h.StreamType = mediaType
+	h.ContentType = ContentTypeStream
+	h.Status = status
+}
+
 type HandlerFunc func(req *HandlerRequest) (resp *HandlerResponse)
 
+// Middleware wraps the handling of the requests matching a route
+type Middleware func(next http.Handler) http.Handler
+
 type ContentType int
 
 const (
 	ContentTypeText ContentType = iota
 	ContentTypeHTML
 	ContentTypeJSON
+	ContentTypeStream
 )
 
 func NewRouter(validator *validator.Validate, templatesDir string) (r *Router) {
@@ -64,6 +105,7 @@ func NewRouter(validator *validator.Validate, templatesDir string) (r *Router) {
 	muxSubrouter := muxRouter.Methods(
 		http.MethodPost,
 		http.MethodPut,
+		http.MethodPatch,
 		http.MethodGet,
 		http.MethodDelete).Subrouter()
 
@@ -75,10 +117,17 @@ func NewRouter(validator *validator.Validate, templatesDir string) (r *Router) {
 	}
 }
 
+// Use adds middleware run before the handlers, in the order added
+func (r *Router) Use(middleware Middleware) {
+	r.muxRouter.Use(mux.MiddlewareFunc(middleware))
+}
+
 // ----------------------- Request Handler Methods ----------------------- //
 
+// POST registers a handler for requests carrying a JSON body of the type body
+// points to. Routes expecting no request content pass a nil body.
 func (r *Router) POST(path string, body interface{}, handler HandlerFunc) {
-	if reflect.ValueOf(body).Kind() != reflect.Ptr {
+	if body != nil && reflect.ValueOf(body).Kind() != reflect.Ptr {
 		panic("body is not addressable")
 	}
 	r.handle(http.MethodPost, path, body, handler)
@@ -91,6 +140,18 @@ func (r *Router) PUT(path string, body interface{}, handler HandlerFunc) {
 	r.handle(http.MethodPut, path, body, handler)
 }
 
+// PATCH registers a handler for requests whose content is passed to the handler
+// undecoded as []byte, patch documents come in several formats
+func (r *Router) PATCH(path string, handler HandlerFunc) {
+	r.handle(http.MethodPatch, path, new([]byte), handler)
+}
+
+// POSTStream registers a handler for requests whose content is passed to the
+// handler unread as io.Reader, for content too large to hold in memory
+func (r *Router) POSTStream(path string, handler HandlerFunc) {
+	r.handle(http.MethodPost, path, new(io.Reader), handler)
+}
+
 func (r *Router) GET(path string, handler HandlerFunc) {
 	r.handle(http.MethodGet, path, nil, handler)
 }
@@ -99,40 +160,66 @@ func (r *Router) DELETE(path string, handler HandlerFunc) {
 	r.handle(http.MethodDelete, path, nil, handler)
 }
 
+// GETRaw registers a handler writing the response itself, for requests taking
+// over the connection such as WebSocket upgrades. Route variables are read by Vars.
+func (r *Router) GETRaw(path string, handler http.HandlerFunc) {
+	r.muxRouter.HandleFunc(path, handler).Methods(http.MethodGet)
+}
+
+// Vars returns the route variables of a request passed to a raw handler
+func Vars(req *http.Request) (vars map[string]string) {
+	return mux.Vars(req)
+}
+
 // ----------------------- Router Request Handler ----------------------- //
 
 func (r *Router) handle(method string, path string, body interface{}, handler HandlerFunc) {
 	r.muxRouter.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
-		if http.NoBody == req.Body && (method == http.MethodPost || method == http.MethodPut) {
+		if http.NoBody == req.Body && body != nil &&
+			(method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch) {
 			writeError(w, nil, "request content is empty", http.StatusBadRequest)
 			return
 		}
 
 		// Only JSON requests supported
-		if http.NoBody != req.Body {
+		var reqBody interface{}
+		if _, stream := body.(*io.Reader); stream {
+			// Streamed content is read by the handler
 			defer req.Body.Close()
+			reqBody = req.Body
+		} else if http.NoBody != req.Body && body != nil {
+			defer req.Body.Close()
+
+			// Decode into a new value per request, concurrent requests must not share it
+			reqBody = reflect.New(reflect.TypeOf(body).Elem()).Interface()
 
 			rawBody, err := ioutil.ReadAll(req.Body)
 			if err != nil {
 				writeError(w, err, "unable to read request content", http.StatusInternalServerError)
 				return
 			}
-			if err = json.Unmarshal(rawBody, body); err != nil {
-				writeError(w, err, "failed to process request content", http.StatusBadRequest)
-				return
-			}
-			if r.validator != nil {
-				if err = r.validator.Struct(body); err != nil {
-					writeError(w, err, "request content is invalid", http.StatusBadRequest)
+			if _, raw := body.(*[]byte); raw {
+				reqBody = rawBody
+			} else {
+				if err = json.Unmarshal(rawBody, reqBody); err != nil {
+					writeError(w, err, "failed to process request content", http.StatusBadRequest)
 					return
 				}
+				if r.validator != nil {
+					if err = r.validator.Struct(reqBody); err != nil {
+						writeError(w, err, "request content is invalid", http.StatusBadRequest)
+						return
+					}
+				}
 			}
 		}
 
 		handlerReq := &HandlerRequest{
 			Context: req.Context(),
 			Vars:    mux.Vars(req),
-			Body:    body,
+			Query:   req.URL.Query(),
+			Header:  req.Header,
+			Body:    reqBody,
 		}
 
 		handler(handlerReq).writeResponse(w, r.templatesDir)
@@ -145,6 +232,10 @@ func (h *HandlerResponse) writeResponse(w http.ResponseWriter, templatesDir stri
 	var resp string
 	var contentType string
 
+	for key, values := range h.Header {
+		w.Header()[key] = values
+	}
+
 	switch h.ContentType {
 	case ContentTypeText:
 		resp = h.Response.(string)
@@ -157,6 +248,13 @@ func (h *HandlerResponse) writeResponse(w http.ResponseWriter, templatesDir stri
 		}
 		resp = string(respBytes)
 		contentType = "application/json; charset=utf-8"
+	case ContentTypeStream:
+		w.Header().Set("Content-Type", h.StreamType)
+		w.WriteHeader(h.Status)
+		if err := h.Stream(w); err != nil {
+			log.Printf("[ERROR] failed to stream response: %v\n", err)
+		}
+		return
 	case ContentTypeHTML:
 		templatePath := filepath.Join(templatesDir, h.Template)
 		tpl, err := template.New(h.Template).ParseFiles(templatePath)
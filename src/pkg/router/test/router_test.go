@@ -2,11 +2,13 @@ package router_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -114,6 +116,39 @@ func TestRouterPostHandler(t *testing.T) {
 	runRouterTests(t, testTable, handler)
 }
 
+func TestRouterPostHandlerWithoutBody(t *testing.T) {
+	testTable := []testEntry{
+		{
+			name:   "Test with valid post req without content",
+			status: http.StatusOK,
+			method: http.MethodPost,
+			uri:    "/data/25/action",
+		},
+		{
+			name:       "Test with ignored req content",
+			status:     http.StatusOK,
+			method:     http.MethodPost,
+			uri:        "/data/25/action",
+			reqContent: TestData{Data: "gooddata", Length: 8},
+		},
+	}
+
+	validator := validator.New()
+	handler := router.NewRouter(validator, templatesDir)
+
+	handler.POST("/data/{data_id:[0-9]+}/action", nil, func(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+		resp = new(router.HandlerResponse)
+		resp.SetText("bad content", http.StatusBadRequest)
+
+		if req.Body == nil && req.Vars["data_id"] == "25" {
+			resp.SetText("ok", http.StatusOK)
+		}
+		return
+	})
+
+	runRouterTests(t, testTable, handler)
+}
+
 func TestRouterPutHandler(t *testing.T) {
 	testPath := "/data/{data_id:[0-9]+}"
 	validJSONReq := TestData{
@@ -203,6 +238,8 @@ func TestRouterGetHandler(t *testing.T) {
 		Length: 8,
 	}
 
+	testQueryPath := "/query"
+
 	var validHTMLResp string = `<!DOCTYPE html><html lang="en"><head></head><body><p>test-canvas</p></body></html>`
 
 	testTable := []testEntry{
@@ -223,6 +260,14 @@ func TestRouterGetHandler(t *testing.T) {
 			respContent: validHTMLResp,
 			contentType: router.ContentTypeHTML,
 		},
+		{
+			name:        "Test with valid get query req",
+			status:      http.StatusOK,
+			method:      http.MethodGet,
+			uri:         testQueryPath + "?data=testdata&length=8",
+			respContent: validJSONResp,
+			contentType: router.ContentTypeJSON,
+		},
 		// Invalid test cases
 		{
 			name:   "Test with invalid method",
@@ -230,6 +275,12 @@ func TestRouterGetHandler(t *testing.T) {
 			uri:    "/data/25",
 			method: http.MethodPost,
 		},
+		{
+			name:   "Test with invalid query",
+			status: http.StatusBadRequest,
+			uri:    testQueryPath + "?data=testdata",
+			method: http.MethodGet,
+		},
 		{
 			name:   "Test with invalid uri",
 			status: http.StatusNotFound,
@@ -258,6 +309,19 @@ func TestRouterGetHandler(t *testing.T) {
 		return
 	})
 
+	handler.GET(testQueryPath, func(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+		resp = new(router.HandlerResponse)
+
+		length, err := strconv.Atoi(req.Query.Get("length"))
+		if err != nil {
+			resp.SetText("bad query", http.StatusBadRequest)
+			return
+		}
+
+		resp.SetJSON(TestData{Data: req.Query.Get("data"), Length: length}, http.StatusOK)
+		return
+	})
+
 	handler.GET(testHtmlPath, func(req *router.HandlerRequest) (resp *router.HandlerResponse) {
 		resp = new(router.HandlerResponse)
 		resp.ContentType = router.ContentTypeHTML
@@ -375,3 +439,157 @@ func runRouterTests(t *testing.T, testTable []testEntry, handler http.Handler) {
 		})
 	}
 }
+
+func TestRouterHeaders(t *testing.T) {
+	a := assert.New(t)
+
+	handler := router.NewRouter(validator.New(), templatesDir)
+	handler.GET("/data", func(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+		resp = new(router.HandlerResponse)
+		resp.SetHeader("ETag", req.Header.Get("If-Match"))
+		resp.SetText("ok", http.StatusOK)
+		return
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/data", nil)
+	a.NoError(err)
+	request.Header.Set("If-Match", `"7"`)
+
+	resp, err := server.Client().Do(request)
+	a.NoError(err)
+	defer resp.Body.Close()
+
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.Equal(`"7"`, resp.Header.Get("ETag"))
+	a.Equal("text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+}
+
+func TestRouterPatchHandler(t *testing.T) {
+	a := assert.New(t)
+
+	handler := router.NewRouter(validator.New(), templatesDir)
+	handler.PATCH("/data", func(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+		resp = new(router.HandlerResponse)
+		// Patches are passed through undecoded and unvalidated
+		resp.SetText(string(req.Body.([]byte)), http.StatusOK)
+		return
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	patch := `[{"op": "replace", "path": "/length", "value": 1}]`
+	request, err := http.NewRequest(http.MethodPatch, server.URL+"/data", strings.NewReader(patch))
+	a.NoError(err)
+	request.Header.Set("Content-Type", "application/json-patch+json")
+
+	resp, err := server.Client().Do(request)
+	a.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.Equal(patch, string(body))
+
+	// Empty patches are rejected by the router
+	request, err = http.NewRequest(http.MethodPatch, server.URL+"/data", nil)
+	a.NoError(err)
+
+	resp, err = server.Client().Do(request)
+	a.NoError(err)
+	defer resp.Body.Close()
+	a.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRouterStreamHandler(t *testing.T) {
+	a := assert.New(t)
+
+	handler := router.NewRouter(validator.New(), templatesDir)
+	handler.POSTStream("/data", func(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+		resp = new(router.HandlerResponse)
+		// Streamed content is passed through unread and echoed the same way
+		reader := req.Body.(io.Reader)
+		resp.SetStream(func(w io.Writer) (err error) {
+			_, err = io.Copy(w, reader)
+			return
+		}, "application/x-ndjson", http.StatusOK)
+		return
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	content := "{\"data\": \"a\"}\n{\"data\": \"b\"}\n"
+	resp, err := server.Client().Post(server.URL+"/data", "application/x-ndjson", strings.NewReader(content))
+	a.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.Equal("application/x-ndjson", resp.Header.Get("Content-Type"))
+	a.Equal(content, string(body))
+}
+
+type contextKey struct{}
+
+func TestRouterMiddleware(t *testing.T) {
+	a := assert.New(t)
+
+	handler := router.NewRouter(validator.New(), templatesDir)
+	handler.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Request-ID", "f3a1")
+			ctx := context.WithValue(req.Context(), contextKey{}, req.Header.Get("X-Actor"))
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	})
+	handler.GET("/actor", func(req *router.HandlerRequest) (resp *router.HandlerResponse) {
+		resp = new(router.HandlerResponse)
+		// Values added by the middleware reach the handler through the context
+		resp.SetText(req.Context.Value(contextKey{}).(string), http.StatusOK)
+		return
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/actor", nil)
+	a.NoError(err)
+	req.Header.Set("X-Actor", "leonardo")
+	resp, err := server.Client().Do(req)
+	a.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.Equal("f3a1", resp.Header.Get("X-Request-ID"))
+	a.Equal("leonardo", string(body))
+}
+
+func TestRouterGETRaw(t *testing.T) {
+	a := assert.New(t)
+
+	handler := router.NewRouter(validator.New(), templatesDir)
+	handler.GETRaw("/canvas/{name:[a-z]{1,25}}/raw", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, router.Vars(req)["name"])
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/canvas/monalisa/raw")
+	a.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	a.NoError(err)
+	a.Equal(http.StatusAccepted, resp.StatusCode)
+	a.Equal("monalisa", string(body))
+}
@@ -0,0 +1,229 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+	"github.com/sketch-home-task/src/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// memStore keeps webhooks and their deliveries in memory
+type memStore struct {
+	mu         sync.Mutex
+	webhooks   []illustrator.Webhook
+	deliveries []illustrator.WebhookDelivery
+}
+
+func (m *memStore) CreateWebhook(ctx context.Context, w *illustrator.Webhook) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.ID = int64(len(m.webhooks) + 1)
+	m.webhooks = append(m.webhooks, *w)
+	return
+}
+
+func (m *memStore) ListWebhooks(ctx context.Context) (webhooks []illustrator.Webhook, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append(webhooks, m.webhooks...), nil
+}
+
+func (m *memStore) DeleteWebhook(ctx context.Context, id int64) (err error) {
+	return
+}
+
+func (m *memStore) RecordWebhookDelivery(ctx context.Context, delivery *illustrator.WebhookDelivery) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery.ID = int64(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, *delivery)
+	return
+}
+
+func (m *memStore) ListWebhookDeliveries(ctx context.Context, id int64, limit int) (
+	deliveries []illustrator.WebhookDelivery, err error) {
+	return
+}
+
+func (m *memStore) WebhookDelivered(ctx context.Context, id int64, eventID int64) (ok bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, delivery := range m.deliveries {
+		ok = ok || (delivery.WebhookID == id && delivery.EventID == eventID && delivery.Delivered)
+	}
+	return
+}
+
+// receiver is a webhook endpoint failing the first requests
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	events   []illustrator.ChangeEvent
+	valid    []bool
+	secret   string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	var event illustrator.ChangeEvent
+	json.Unmarshal(body, &event)
+	r.events = append(r.events, event)
+	r.valid = append(r.valid, webhook.Verify(r.secret, body, req.Header.Get(webhook.SignatureHeader)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ----------------- NOTIFIER TESTS -----------------
+
+type NotifierSuite struct {
+	suite.Suite
+	ctx      context.Context
+	store    *memStore
+	receiver *receiver
+	server   *httptest.Server
+	notifier *webhook.Notifier
+	event    illustrator.ChangeEvent
+}
+
+func TestNotifierSuite(t *testing.T) {
+	suite.Run(t, new(NotifierSuite))
+}
+
+func (s *NotifierSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.store = &memStore{}
+	s.receiver = &receiver{secret: "s3cr3t"}
+	s.server = httptest.NewServer(s.receiver)
+	s.notifier = webhook.NewNotifier(s.store, webhook.Options{Timeout: time.Second})
+	s.event = illustrator.ChangeEvent{ID: 7, Action: illustrator.AuditUpdate, Name: "MonaLisa", Revision: 2,
+		Actor: "leonardo"}
+
+	s.Require().NoError(s.store.CreateWebhook(s.ctx, &illustrator.Webhook{URL: s.server.URL, Secret: "s3cr3t"}))
+}
+
+func (s *NotifierSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *NotifierSuite) TestDeliver() {
+	s.NoError(s.notifier.Deliver(s.ctx, &s.event))
+
+	s.Equal([]illustrator.ChangeEvent{s.event}, s.receiver.events)
+	s.Equal([]bool{true}, s.receiver.valid)
+	s.Require().Len(s.store.deliveries, 1)
+	delivery := s.store.deliveries[0]
+	s.Equal(int64(1), delivery.WebhookID)
+	s.Equal(int64(7), delivery.EventID)
+	s.Equal(illustrator.AuditUpdate, delivery.Action)
+	s.Equal(http.StatusNoContent, delivery.StatusCode)
+	s.True(delivery.Delivered)
+
+	// Dispatched again, the event is not posted twice
+	s.NoError(s.notifier.Deliver(s.ctx, &s.event))
+	s.Len(s.receiver.events, 1)
+}
+
+func (s *NotifierSuite) TestDeliverFilter() {
+	s.Require().NoError(s.store.CreateWebhook(s.ctx, &illustrator.Webhook{URL: s.server.URL, Secret: "s3cr3t",
+		Events: []illustrator.AuditAction{illustrator.AuditCreate, illustrator.AuditDelete}}))
+
+	s.NoError(s.notifier.Deliver(s.ctx, &s.event))
+	s.Len(s.receiver.events, 1)
+
+	s.event.ID, s.event.Action = 8, illustrator.AuditDelete
+	s.NoError(s.notifier.Deliver(s.ctx, &s.event))
+	s.Len(s.receiver.events, 3)
+}
+
+func (s *NotifierSuite) TestDeliverRetry() {
+	// One attempt per dispatch, the outbox retries the event
+	s.receiver.failures = 1
+	s.Error(s.notifier.Deliver(s.ctx, &s.event))
+	s.Empty(s.receiver.events)
+	s.Require().Len(s.store.deliveries, 1)
+	s.Equal(1, s.store.deliveries[0].Attempt)
+	s.Equal(http.StatusServiceUnavailable, s.store.deliveries[0].StatusCode)
+	s.Contains(s.store.deliveries[0].Error, "503")
+	s.False(s.store.deliveries[0].Delivered)
+
+	s.event.Attempts = 1
+	s.NoError(s.notifier.Deliver(s.ctx, &s.event))
+	s.Len(s.receiver.events, 1)
+	s.Require().Len(s.store.deliveries, 2)
+	s.Equal(2, s.store.deliveries[1].Attempt)
+	s.True(s.store.deliveries[1].Delivered)
+}
+
+func (s *NotifierSuite) TestDeliverDeadWebhook() {
+	// Never responds in time
+	release := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-release:
+		}
+	}))
+	defer dead.Close()
+	defer close(release)
+	s.Require().NoError(s.store.CreateWebhook(s.ctx, &illustrator.Webhook{URL: dead.URL, Secret: "s3cr3t"}))
+	s.Require().NoError(s.store.CreateWebhook(s.ctx, &illustrator.Webhook{URL: s.server.URL, Secret: "s3cr3t"}))
+
+	// The other webhooks get the event all the same, the dead one holds up the
+	// dispatch by one timeout
+	notifier := webhook.NewNotifier(s.store, webhook.Options{Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	s.Error(notifier.Deliver(s.ctx, &s.event))
+	s.True(time.Since(start) < time.Second)
+	s.Len(s.receiver.events, 2)
+	s.Len(s.store.deliveries, 3)
+
+	s.event.Attempts = 1
+	s.Error(notifier.Deliver(s.ctx, &s.event))
+	s.Len(s.receiver.events, 2)
+	s.Len(s.store.deliveries, 4)
+}
+
+func (s *NotifierSuite) TestDeliverSignature() {
+	// Signed with the secret of the webhook
+	s.store.webhooks[0].Secret = "other"
+	s.NoError(s.notifier.Deliver(s.ctx, &s.event))
+	s.Equal([]bool{false}, s.receiver.valid)
+}
+
+// ----------------- SIGNATURE TESTS -----------------
+
+func TestSign(t *testing.T) {
+	a := assert.New(t)
+
+	body := []byte(`{"id":7}`)
+	signature := webhook.Sign("s3cr3t", body)
+	a.Equal("sha256=db84462d18e49707bf860c195458eca476d8e428904c0c4411aafc2fa212eeaa", signature)
+	a.True(webhook.Verify("s3cr3t", body, signature))
+	a.False(webhook.Verify("other", body, signature))
+	a.False(webhook.Verify("s3cr3t", []byte(`{"id":8}`), signature))
+
+	secret, err := webhook.NewSecret()
+	a.NoError(err)
+	a.Len(secret, 64)
+}
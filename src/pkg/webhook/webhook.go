@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sketch-home-task/src/pkg/illustrator"
+)
+
+const (
+	// Header carrying the signature of a delivery
+	SignatureHeader string = "X-Signature-256"
+	// Header carrying the ID of the event delivered, the same for every attempt
+	EventIDHeader string = "X-Event-ID"
+	// Header carrying the ID of the webhook the event is delivered to
+	WebhookIDHeader string = "X-Webhook-ID"
+
+	defaultTimeout time.Duration = 10 * time.Second
+)
+
+type Options struct {
+	// Time limit of a delivery attempt
+	Timeout time.Duration
+}
+
+// Notifier posts change events to the webhooks subscribed to them. It is a
+// sink of the outbox dispatcher and makes one attempt per webhook and
+// dispatch: an event failing to reach a webhook is dispatched again after the
+// backoff of the outbox, skipping the webhooks it already reached.
+type Notifier struct {
+	store  illustrator.WebhookStore
+	client *http.Client
+	opts   Options
+}
+
+func NewNotifier(store illustrator.WebhookStore, opts Options) (n *Notifier) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	return &Notifier{
+		store:  store,
+		client: &http.Client{Timeout: opts.Timeout},
+		opts:   opts,
+	}
+}
+
+// Deliver posts the event to every webhook accepting it which it did not reach
+// yet, all at once so dead webhooks hold up the dispatch by the timeout of an
+// attempt at most. Each attempt is recorded in the delivery log of the webhook.
+func (n *Notifier) Deliver(ctx context.Context, event *illustrator.ChangeEvent) (err error) {
+	webhooks, err := n.store.ListWebhooks(ctx)
+	if err != nil {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	var pending []*illustrator.Webhook
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if !webhook.Accepts(event.Action) {
+			continue
+		}
+
+		delivered, err := n.store.WebhookDelivered(ctx, webhook.ID, event.ID)
+		if err != nil {
+			return err
+		}
+		if !delivered {
+			pending = append(pending, webhook)
+		}
+	}
+
+	deliveries := make([]illustrator.WebhookDelivery, len(pending))
+	var wg sync.WaitGroup
+	for i, webhook := range pending {
+		wg.Add(1)
+		go func(webhook *illustrator.Webhook, delivery *illustrator.WebhookDelivery) {
+			defer wg.Done()
+			*delivery = n.deliver(ctx, webhook, event, body)
+		}(webhook, &deliveries[i])
+	}
+	wg.Wait()
+
+	var failed int
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		// The delivery is taken, it is retried as well when the log fails
+		if err = n.store.RecordWebhookDelivery(ctx, delivery); err != nil {
+			return
+		}
+		if !delivery.Delivered {
+			log.Printf("[ERROR] failed to deliver canvas event %d to webhook %d: %s\n", event.ID, delivery.WebhookID,
+				delivery.Error)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("delivery to %d webhooks failed", failed)
+	}
+	return
+}
+
+// deliver makes an attempt to post the event to the webhook, numbered after
+// the failed deliveries of the event so far
+func (n *Notifier) deliver(ctx context.Context, webhook *illustrator.Webhook, event *illustrator.ChangeEvent,
+	body []byte) (delivery illustrator.WebhookDelivery) {
+	delivery = illustrator.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		Action:    event.Action,
+		Name:      event.Name,
+		Attempt:   event.Attempts + 1,
+	}
+	if err := n.post(ctx, webhook, event, body, &delivery); err != nil {
+		delivery.Error = err.Error()
+	}
+	delivery.Delivered = delivery.Error == ""
+	return
+}
+
+func (n *Notifier) post(ctx context.Context, webhook *illustrator.Webhook, event *illustrator.ChangeEvent, body []byte,
+	delivery *illustrator.WebhookDelivery) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	req.Header.Set(EventIDHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(WebhookIDHeader, strconv.FormatInt(webhook.ID, 10))
+
+	start := time.Now()
+	resp, err := n.client.Do(req)
+	delivery.DurationMsec = time.Since(start).Milliseconds()
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return
+}
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256 of the
+// body keyed by the secret of the webhook, prefixed by "sha256="
+func Sign(secret string, body []byte) (signature string) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature was made for the body with the secret,
+// for receivers of deliveries
+func Verify(secret string, body []byte, signature string) (ok bool) {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// NewSecret generates a random secret for webhooks registered without one
+func NewSecret() (secret string, err error) {
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return
+	}
+	return hex.EncodeToString(key), nil
+}